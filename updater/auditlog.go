@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// updateAuditLogS3Env names an s3://bucket/key URI that the full audit log
+// is additionally uploaded to, as one newline-delimited JSON object, once
+// the run finishes. Unset, the audit log is only ever written to stdout.
+const updateAuditLogS3Env = "UPDATE_AUDIT_LOG_S3"
+
+// auditPhase names the update lifecycle step an auditEvent records.
+type auditPhase string
+
+const (
+	auditPhaseAlreadyRunning auditPhase = "AlreadyRunning"
+	auditPhaseUpdate         auditPhase = "Update"
+	auditPhaseVerify         auditPhase = "Verify"
+	auditPhaseActivate       auditPhase = "Activate"
+)
+
+// auditOutcome is the terminal result of an audited phase.
+type auditOutcome string
+
+const (
+	auditOutcomeSuccess auditOutcome = "Success"
+	auditOutcomeFailure auditOutcome = "Failure"
+)
+
+// auditEvent is a structured record of one meaningful update action, detailed
+// enough for an operator to reconstruct, after the fact, exactly which
+// instances updated, which failed and at what phase, and which SSM command ID
+// to go investigate.
+type auditEvent struct {
+	Time                time.Time    `json:"time"`
+	Cluster             string       `json:"cluster"`
+	InstanceID          string       `json:"instance_id,omitempty"`
+	ContainerInstanceID string       `json:"container_instance_id,omitempty"`
+	Phase               auditPhase   `json:"phase"`
+	FromVersion         string       `json:"from_version,omitempty"`
+	ToVersion           string       `json:"to_version,omitempty"`
+	SSMCommandID        string       `json:"ssm_command_id,omitempty"`
+	DurationMs          int64        `json:"duration_ms"`
+	Outcome             auditOutcome `json:"outcome"`
+	Error               string       `json:"error,omitempty"`
+}
+
+// AuditSink records auditEvents. Implementations must be safe for concurrent
+// use: updateSupervisor drives multiple instances through these phases at
+// once.
+type AuditSink interface {
+	Record(ctx context.Context, e auditEvent)
+}
+
+// auditFlusher is implemented by AuditSinks that buffer events instead of
+// writing them immediately, so _main can give them a chance to flush once
+// the run finishes.
+type auditFlusher interface {
+	flush(ctx context.Context, client S3API) error
+}
+
+// record emits e through u's configured AuditSink, tolerating updaters built
+// without one, as most existing tests do.
+func (u *updater) record(ctx context.Context, e auditEvent) {
+	if u.auditSink == nil {
+		return
+	}
+	u.auditSink.Record(ctx, e)
+}
+
+// auditOutcomeFor reports auditOutcomeFailure if err is non-nil, and
+// auditOutcomeSuccess otherwise.
+func auditOutcomeFor(err error) auditOutcome {
+	if err != nil {
+		return auditOutcomeFailure
+	}
+	return auditOutcomeSuccess
+}
+
+// errString returns err's message, or "" if err is nil, so auditEvent's Error
+// field can be set unconditionally.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// stdoutAuditSink writes each event as one line of newline-delimited JSON to
+// stdout, so every run leaves a complete audit trail in its own console or
+// container logs without any configuration.
+type stdoutAuditSink struct {
+	mu sync.Mutex
+}
+
+func (s *stdoutAuditSink) Record(_ context.Context, e auditEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to marshal audit event for phase %q: %v", e.Phase, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Println(string(body))
+}
+
+// s3AuditSink buffers audit events in memory and uploads them as a single
+// newline-delimited JSON object when flush is called, since S3 has no API to
+// append to an existing object -- the same constraint UpdatePlan.report works
+// around in dryrun.go.
+type s3AuditSink struct {
+	mu     sync.Mutex
+	bucket string
+	key    string
+	events []auditEvent
+}
+
+func (s *s3AuditSink) Record(_ context.Context, e auditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+func (s *s3AuditSink) flush(ctx context.Context, client S3API) error {
+	s.mu.Lock()
+	events := make([]auditEvent, len(s.events))
+	copy(events, s.events)
+	s.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit event for phase %q: %w", e.Phase, err)
+		}
+		buf.Write(body)
+		buf.WriteByte('\n')
+	}
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload audit log to \"s3://%s/%s\": %w", s.bucket, s.key, err)
+	}
+	log.Printf("Uploaded audit log to \"s3://%s/%s\"", s.bucket, s.key)
+	return nil
+}
+
+// multiAuditSink fans each event out to every configured sink.
+type multiAuditSink struct {
+	sinks []AuditSink
+}
+
+func (m *multiAuditSink) Record(ctx context.Context, e auditEvent) {
+	for _, s := range m.sinks {
+		s.Record(ctx, e)
+	}
+}
+
+// flush gives every sink that buffers events a chance to write them out.
+func (m *multiAuditSink) flush(ctx context.Context, client S3API) error {
+	for _, s := range m.sinks {
+		flusher, ok := s.(auditFlusher)
+		if !ok {
+			continue
+		}
+		if err := flusher.flush(ctx, client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newAuditSinkFromEnv returns an AuditSink that always writes to stdout and,
+// if UPDATE_AUDIT_LOG_S3 is set to an s3://bucket/key URI, additionally
+// uploads the full log there once the run finishes.
+func newAuditSinkFromEnv() (*multiAuditSink, error) {
+	sinks := []AuditSink{&stdoutAuditSink{}}
+	if dest := os.Getenv(updateAuditLogS3Env); dest != "" {
+		bucket, key, err := parseS3URI(dest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", updateAuditLogS3Env, dest, err)
+		}
+		sinks = append(sinks, &s3AuditSink{bucket: bucket, key: key})
+	}
+	return &multiAuditSink{sinks: sinks}, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAuditSink is an in-memory AuditSink for tests to assert exactly
+// which events an instrumented call recorded.
+type recordingAuditSink struct {
+	mu     sync.Mutex
+	events []auditEvent
+}
+
+func (r *recordingAuditSink) Record(_ context.Context, e auditEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestNewAuditSinkFromEnv(t *testing.T) {
+	t.Run("stdout only when unset", func(t *testing.T) {
+		os.Unsetenv(updateAuditLogS3Env)
+		sink, err := newAuditSinkFromEnv()
+		require.NoError(t, err)
+		require.Len(t, sink.sinks, 1)
+		_, ok := sink.sinks[0].(*stdoutAuditSink)
+		assert.True(t, ok)
+	})
+
+	t.Run("adds an s3 sink when set", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateAuditLogS3Env, "s3://my-bucket/audit.ndjson"))
+		defer os.Unsetenv(updateAuditLogS3Env)
+
+		sink, err := newAuditSinkFromEnv()
+		require.NoError(t, err)
+		require.Len(t, sink.sinks, 2)
+		s3Sink, ok := sink.sinks[1].(*s3AuditSink)
+		require.True(t, ok)
+		assert.Equal(t, "my-bucket", s3Sink.bucket)
+		assert.Equal(t, "audit.ndjson", s3Sink.key)
+	})
+
+	t.Run("rejects a malformed destination", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateAuditLogS3Env, "not-an-s3-uri"))
+		defer os.Unsetenv(updateAuditLogS3Env)
+
+		_, err := newAuditSinkFromEnv()
+		assert.Error(t, err)
+	})
+}
+
+func TestMultiAuditSinkFlushUploadsBufferedEventsToS3(t *testing.T) {
+	var uploaded *s3.PutObjectInput
+	mockS3 := MockS3{
+		PutObjectFn: func(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			uploaded = input
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	sink := &multiAuditSink{sinks: []AuditSink{&stdoutAuditSink{}, &s3AuditSink{bucket: "my-bucket", key: "audit.ndjson"}}}
+	sink.Record(context.Background(), auditEvent{Phase: auditPhaseUpdate, Outcome: auditOutcomeSuccess})
+	sink.Record(context.Background(), auditEvent{Phase: auditPhaseVerify, Outcome: auditOutcomeFailure})
+
+	require.NoError(t, sink.flush(context.Background(), mockS3))
+	require.NotNil(t, uploaded)
+	assert.Equal(t, "my-bucket", aws.ToString(uploaded.Bucket))
+	assert.Equal(t, "audit.ndjson", aws.ToString(uploaded.Key))
+}
+
+func TestUpdaterRecordToleratesNilSink(t *testing.T) {
+	u := &updater{}
+	// Should not panic when auditSink is unset, as is the case in most existing tests.
+	u.record(context.Background(), auditEvent{Phase: auditPhaseUpdate})
+}
+
+func TestUpdateInstanceRecordsAuditEvent(t *testing.T) {
+	restore := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = restore }()
+
+	checkOutputJSON := `{"update_state": "Ready", "active_partition": { "image": { "version": "1.0.0"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("check-command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	mockEC2 := MockEC2{
+		DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+			return &ec2.DescribeInstanceStatusOutput{InstanceStatuses: []ec2types.InstanceStatus{{
+				InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+			}}}, nil
+		},
+	}
+	sink := &recordingAuditSink{}
+	u := updater{ssm: mockSSM, ec2: mockEC2, checkDocument: "check-document", rebootDocument: "reboot-document", auditSink: sink}
+	require.NoError(t, u.updateInstance(context.Background(), instance{
+		instanceID:          "instance-id",
+		containerInstanceID: "cont-inst-id",
+		bottlerocketVersion: "1.0.0",
+	}))
+
+	require.Len(t, sink.events, 1)
+	e := sink.events[0]
+	assert.Equal(t, auditPhaseUpdate, e.Phase)
+	assert.Equal(t, "instance-id", e.InstanceID)
+	assert.Equal(t, "cont-inst-id", e.ContainerInstanceID)
+	assert.Equal(t, "check-command-id", e.SSMCommandID)
+	assert.Equal(t, auditOutcomeSuccess, e.Outcome)
+	assert.Empty(t, e.Error)
+}
+
+func TestVerifyUpdateRecordsAuditEventOnFailure(t *testing.T) {
+	ssmErr := assert.AnError
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return nil, ssmErr
+		},
+	}
+	sink := &recordingAuditSink{}
+	u := updater{ssm: mockSSM, checkDocument: "check-document", auditSink: sink}
+	ok, _, _, err := u.verifyUpdate(context.Background(), instance{
+		instanceID:          "instance-id",
+		containerInstanceID: "cont-inst-id",
+		bottlerocketVersion: "1.0.0",
+	})
+	require.Error(t, err)
+	assert.False(t, ok)
+
+	require.Len(t, sink.events, 1)
+	e := sink.events[0]
+	assert.Equal(t, auditPhaseVerify, e.Phase)
+	assert.Equal(t, auditOutcomeFailure, e.Outcome)
+	assert.NotEmpty(t, e.Error)
+}
+
+func TestActivateInstanceRecordsAuditEvent(t *testing.T) {
+	mockECS := MockECS{
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{}, nil
+		},
+	}
+	sink := &recordingAuditSink{}
+	u := updater{ecs: mockECS, auditSink: sink}
+	require.NoError(t, u.activateInstance(context.Background(), "cont-inst-id"))
+
+	require.Len(t, sink.events, 1)
+	e := sink.events[0]
+	assert.Equal(t, auditPhaseActivate, e.Phase)
+	assert.Equal(t, "cont-inst-id", e.ContainerInstanceID)
+	assert.Equal(t, auditOutcomeSuccess, e.Outcome)
+}
+
+func TestAlreadyRunningRecordsAuditEvent(t *testing.T) {
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{"task-1"}}, nil
+		},
+	}
+	sink := &recordingAuditSink{}
+	u := updater{ecs: mockECS, auditSink: sink}
+	running, err := u.alreadyRunning(context.Background(), "family")
+	require.NoError(t, err)
+	assert.False(t, running)
+
+	require.Len(t, sink.events, 1)
+	e := sink.events[0]
+	assert.Equal(t, auditPhaseAlreadyRunning, e.Phase)
+	assert.Equal(t, auditOutcomeSuccess, e.Outcome)
+}
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ecs"
-	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
 )
 
 const (
@@ -22,16 +27,72 @@ const (
 	updateStateStaged    = "Staged"
 	updateStateAvailable = "Available"
 	updateStateReady     = "Ready"
-	waiterDelay          = time.Duration(15) * time.Second
-	waiterMaxAttempts    = 100
 	// If this time is reached and the ssm command has not already started running, it will not run.
 	deliveryTimeoutSeconds = 600
+
+	// maxConcurrentPagesEnv overrides how many SSM pages filterAvailableUpdatesStream
+	// will dispatch at once.
+	maxConcurrentPagesEnv = "MAX_CONCURRENT_PAGES"
+	// defaultMaxConcurrentPages is used when MAX_CONCURRENT_PAGES is unset.
+	defaultMaxConcurrentPages = 4
+
+	// updateModeReboot applies an update with a warm, SSM-triggered reboot.
+	updateModeReboot = "reboot"
+	// updateModeStopStart applies an update by power-cycling the instance
+	// through EC2 Stop/Start, for updates that touch the boot partition and
+	// need a full power cycle to guarantee the new partition set is active.
+	updateModeStopStart = "stop-start"
 )
 
+// errInstancePowerCycleFailed marks an updateInstance failure that happened
+// while stopping/starting the instance in stop-start mode. Unlike a failed
+// warm reboot, the instance's state through a failed power cycle is
+// unknown, so updateOne leaves it DRAINING for an operator to inspect
+// instead of reactivating it.
+var errInstancePowerCycleFailed = errors.New("instance failed to power-cycle")
+
+// errCheckCommandSendFailed marks a filterAvailableUpdatesStream error that
+// happened sending the check document for a whole page of instances, as
+// opposed to an error inspecting a single instance's result. It lets
+// filterAvailableUpdates tell the two apart when deciding whether every
+// attempt failed.
+var errCheckCommandSendFailed = errors.New("check command send failed")
+
 type instance struct {
 	instanceID          string
 	containerInstanceID string
 	bottlerocketVersion string
+	targetVersion       string
+	availabilityZone    string
+	instanceType        string
+	// updatePolicy and updateWindow carry the instance's raw
+	// bottlerocket.updater/policy and bottlerocket.updater/window ECS
+	// attributes, if set, for instanceUpdateGate to consult. See
+	// instance_policy.go.
+	updatePolicy string
+	updateWindow string
+	// updateMaxUnavailable carries the instance's raw
+	// bottlerocket.updater/max-unavailable ECS attribute, if set, for
+	// updateSupervisor.instanceGroupSemaphores to consult. See
+	// instance_policy.go.
+	updateMaxUnavailable string
+	// tags carries every ECS attribute set on the container instance, keyed
+	// by attribute name, for UpdatePolicyDocument's per-tag rules to match
+	// against. These are ECS container-instance attributes, the same
+	// mechanism bottlerocket.updater/policy and bottlerocket.updater/window
+	// use, not ECS resource tags -- reusing them means resolving a policy
+	// rule costs no extra AWS API calls. See update_policy_document.go.
+	tags map[string]string
+}
+
+// instanceResult is one instance's outcome from a check command, published by
+// filterAvailableUpdatesStream as soon as it's known: state is the instance's
+// raw UpdateState and version is the version a Ready/Available update would
+// move it to.
+type instanceResult struct {
+	instance instance
+	version  string
+	state    string
 }
 
 type checkOutput struct {
@@ -41,72 +102,166 @@ type checkOutput struct {
 			Version string `json:"version"`
 		} `json:"image"`
 	} `json:"active_partition"`
+	// ChosenUpdate is populated when UpdateState is Available or Ready and
+	// identifies the version the update would move the instance to.
+	ChosenUpdate struct {
+		Version string `json:"version"`
+	} `json:"chosen_update"`
 }
 
+//go:generate go run go.uber.org/mock/mockgen -source=aws.go -destination=mock_aws_gen.go -package=main
+
+// ECSAPI is the subset of the ECS v2 client used by the updater. Its
+// signatures match *ecs.Client exactly so waiters built from
+// ecs.NewTasksStoppedWaiter(u.ecs) are satisfied directly.
 type ECSAPI interface {
-	ListContainerInstancesPages(*ecs.ListContainerInstancesInput, func(*ecs.ListContainerInstancesOutput, bool) bool) error
-	DescribeContainerInstances(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error)
-	UpdateContainerInstancesState(input *ecs.UpdateContainerInstancesStateInput) (*ecs.UpdateContainerInstancesStateOutput, error)
-	ListTasks(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error)
-	DescribeTasks(input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error)
-	WaitUntilTasksStoppedWithContext(ctx aws.Context, input *ecs.DescribeTasksInput, opts ...request.WaiterOption) error
+	ListContainerInstances(ctx context.Context, input *ecs.ListContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error)
+	DescribeContainerInstances(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error)
+	UpdateContainerInstancesState(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error)
+	ListTasks(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error)
+	DescribeTasks(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
+	ListServices(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error)
+	DescribeServices(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
+	ListTagsForResource(ctx context.Context, input *ecs.ListTagsForResourceInput, optFns ...func(*ecs.Options)) (*ecs.ListTagsForResourceOutput, error)
 }
 
+// SSMAPI is the subset of the SSM v2 client used by the updater.
 type SSMAPI interface {
-	WaitUntilCommandExecutedWithContext(ctx aws.Context, input *ssm.GetCommandInvocationInput, opts ...request.WaiterOption) error
-	SendCommand(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error)
-	GetCommandInvocation(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error)
+	SendCommand(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error)
+	GetCommandInvocation(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error)
+	GetParameter(ctx context.Context, input *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
 }
 
+// EC2API is the subset of the EC2 v2 client used by the updater. DescribeInstances
+// is here to satisfy ec2.NewInstanceStoppedWaiter/NewInstanceRunningWaiter,
+// used by stop/start mode updates, rather than being called directly.
 type EC2API interface {
-	WaitUntilInstanceStatusOk(input *ec2.DescribeInstanceStatusInput) error
+	DescribeInstanceStatus(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error)
+	DescribeInstances(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	StopInstances(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+	StartInstances(ctx context.Context, input *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error)
 }
 
-func (u *updater) alreadyRunning(family string) (bool, error) {
+func (u *updater) alreadyRunning(ctx context.Context, family string) (running bool, err error) {
+	start := time.Now()
+	defer func() {
+		u.record(ctx, auditEvent{
+			Time:       time.Now(),
+			Cluster:    u.cluster,
+			Phase:      auditPhaseAlreadyRunning,
+			DurationMs: time.Since(start).Milliseconds(),
+			Outcome:    auditOutcomeFor(err),
+			Error:      errString(err),
+		})
+	}()
+
 	log.Print("Checking for running updater tasks")
-	list, err := u.ecs.ListTasks(&ecs.ListTasksInput{
-		Cluster: &u.cluster,
-		Family:  aws.String(family),
-	})
+	var list *ecs.ListTasksOutput
+	err = retryWithBackoff(ctx, func() error {
+		var err error
+		list, err = u.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+			Cluster: &u.cluster,
+			Family:  aws.String(family),
+		})
+		return err
+	}, u.policy())
 	if err != nil {
 		return false, fmt.Errorf("failed to list running updater tasks: %w", err)
 	}
 	if len(list.TaskArns) > 1 {
 		return true, nil
 	}
+
+	count, percent, ok := u.updatePolicy.ruleFor(u.cluster, nil).maxUnavailable()
+	if !ok {
+		log.Println("This is the only running updater.")
+		return false, nil
+	}
+	draining, err := u.countDrainingContainerInstances(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to count draining container instances: %w", err)
+	}
+	budget := count
+	if percent > 0 {
+		total, err := u.listContainerInstances(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to determine cluster size for update policy document's max_unavailable: %w", err)
+		}
+		budget = len(total) * percent / 100
+		if budget < 1 {
+			budget = 1
+		}
+	}
+	if budget > 0 && draining >= budget {
+		log.Printf("Cluster %q already has %d instance(s) DRAINING, at or beyond the update policy document's max_unavailable budget of %d; treating as already running", u.cluster, draining, budget)
+		return true, nil
+	}
 	log.Println("This is the only running updater.")
 	return false, nil
 }
 
-func (u *updater) listContainerInstances() ([]*string, error) {
-	log.Printf("Listing active container instances in cluster %q", u.cluster)
-	containerInstances := make([]*string, 0)
-	input := &ecs.ListContainerInstancesInput{
-		Cluster: &u.cluster,
-		Status:  aws.String(ecs.ContainerInstanceStatusActive),
+// countDrainingContainerInstances counts container instances currently in
+// the DRAINING state, for alreadyRunning to compare against the update
+// policy document's max_unavailable budget.
+func (u *updater) countDrainingContainerInstances(ctx context.Context) (int, error) {
+	draining, err := u.listContainerInstancesByStatus(ctx, types.ContainerInstanceStatusDraining)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list draining container instances: %w", err)
 	}
-	if err := u.ecs.ListContainerInstancesPages(input, func(output *ecs.ListContainerInstancesOutput, _ bool) bool {
-		containerInstances = append(containerInstances, output.ContainerInstanceArns...)
-		return true
-	}); err != nil {
+	return len(draining), nil
+}
+
+func (u *updater) listContainerInstances(ctx context.Context) ([]string, error) {
+	log.Printf("Listing active container instances in cluster %q", u.cluster)
+	containerInstances, err := u.listContainerInstancesByStatus(ctx, types.ContainerInstanceStatusActive)
+	if err != nil {
 		return nil, fmt.Errorf("failed to list container instances: %w", err)
 	}
 	log.Printf("Found %d container instances in the cluster", len(containerInstances))
 	return containerInstances, nil
 }
 
+// listContainerInstancesByStatus paginates ListContainerInstances for a
+// single status, shared by listContainerInstances (ACTIVE) and
+// countDrainingContainerInstances (DRAINING).
+func (u *updater) listContainerInstancesByStatus(ctx context.Context, status types.ContainerInstanceStatus) ([]string, error) {
+	containerInstances := make([]string, 0)
+	var nextToken *string
+	for {
+		resp, err := u.ecs.ListContainerInstances(ctx, &ecs.ListContainerInstancesInput{
+			Cluster:   &u.cluster,
+			Status:    status,
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		containerInstances = append(containerInstances, resp.ContainerInstanceArns...)
+		if resp.NextToken == nil {
+			break
+		}
+		nextToken = resp.NextToken
+	}
+	return containerInstances, nil
+}
+
 // filterBottlerocketInstances filters container instances and returns list of
 // instances that are running Bottlerocket OS
-func (u *updater) filterBottlerocketInstances(instances []*string) ([]instance, error) {
+func (u *updater) filterBottlerocketInstances(ctx context.Context, instances []string) ([]instance, error) {
 	log.Printf("Filtering container instances running Bottlerocket OS")
 	bottlerocketInstances := make([]instance, 0)
 	errCount := 0
 	var lastErr error
 	pageCount, err := eachPage(len(instances), ecsPageSize, func(start, stop int) error {
-		resp, err := u.ecs.DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
-			Cluster:            &u.cluster,
-			ContainerInstances: instances[start:stop],
-		})
+		var resp *ecs.DescribeContainerInstancesOutput
+		err := retryWithBackoff(ctx, func() error {
+			var err error
+			resp, err = u.ecs.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+				Cluster:            &u.cluster,
+				ContainerInstances: instances[start:stop],
+			})
+			return err
+		}, u.policy())
 		// count errors per page.
 		if err != nil {
 			log.Printf("Failed to describe container instances from %d to %d: %v", start, stop, err)
@@ -117,10 +272,16 @@ func (u *updater) filterBottlerocketInstances(instances []*string) ([]instance,
 		for _, containerInstance := range resp.ContainerInstances {
 			if containsAttribute(containerInstance.Attributes, "bottlerocket.variant") {
 				bottlerocketInstances = append(bottlerocketInstances, instance{
-					instanceID:          aws.StringValue(containerInstance.Ec2InstanceId),
-					containerInstanceID: aws.StringValue(containerInstance.ContainerInstanceArn),
+					instanceID:           aws.ToString(containerInstance.Ec2InstanceId),
+					containerInstanceID:  aws.ToString(containerInstance.ContainerInstanceArn),
+					availabilityZone:     attributeValue(containerInstance.Attributes, "ecs.availability-zone"),
+					instanceType:         attributeValue(containerInstance.Attributes, "ecs.instance-type"),
+					updatePolicy:         attributeValue(containerInstance.Attributes, instancePolicyAttributeKey),
+					updateWindow:         attributeValue(containerInstance.Attributes, instanceWindowAttributeKey),
+					updateMaxUnavailable: attributeValue(containerInstance.Attributes, instanceMaxUnavailableAttributeKey),
+					tags:                 attributesMap(containerInstance.Attributes),
 				})
-				log.Printf("Bottlerocket instance %q detected.", aws.StringValue(containerInstance.Ec2InstanceId))
+				log.Printf("Bottlerocket instance %q detected.", aws.ToString(containerInstance.Ec2InstanceId))
 			}
 		}
 		return nil
@@ -136,15 +297,36 @@ func (u *updater) filterBottlerocketInstances(instances []*string) ([]instance,
 }
 
 // containsAttribute checks if a slice of ECS Attributes struct contains a specified name.
-func containsAttribute(attrs []*ecs.Attribute, searchString string) bool {
+func containsAttribute(attrs []types.Attribute, searchString string) bool {
 	for _, attr := range attrs {
-		if aws.StringValue(attr.Name) == searchString {
+		if aws.ToString(attr.Name) == searchString {
 			return true
 		}
 	}
 	return false
 }
 
+// attributeValue returns the value of the named ECS container instance
+// attribute, or "" if it isn't present.
+func attributeValue(attrs []types.Attribute, name string) string {
+	for _, attr := range attrs {
+		if aws.ToString(attr.Name) == name {
+			return aws.ToString(attr.Value)
+		}
+	}
+	return ""
+}
+
+// attributesMap returns every ECS container instance attribute as a
+// name-to-value map, for UpdatePolicyDocument's per-tag rule matching.
+func attributesMap(attrs []types.Attribute) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		m[aws.ToString(attr.Name)] = aws.ToString(attr.Value)
+	}
+	return m
+}
+
 // eachPage defines batch processing boundaries for handling paginated results of API calls.
 func eachPage(inputLen int, size int, fn func(start, stop int) error) (int, error) {
 	pageCount := 0
@@ -161,63 +343,146 @@ func eachPage(inputLen int, size int, fn func(start, stop int) error) (int, erro
 	return pageCount, nil
 }
 
-// filterAvailableUpdates returns a list of instances that have updates available
-func (u *updater) filterAvailableUpdates(bottlerocketInstances []instance) ([]instance, error) {
-	log.Printf("Filtering instances with available updates")
-	// make slice of Bottlerocket instances to use with SendCommand and checkCommandOutput
-	instances := make([]string, 0)
-	for _, inst := range bottlerocketInstances {
-		instances = append(instances, inst.instanceID)
-	}
+// filterAvailableUpdates returns a list of instances that have updates
+// available. It's a thin, blocking wrapper around
+// filterAvailableUpdatesStream for callers that want batch semantics.
+func (u *updater) filterAvailableUpdates(ctx context.Context, bottlerocketInstances []instance) ([]instance, error) {
+	resultChan, errChan := u.filterAvailableUpdatesStream(ctx, bottlerocketInstances)
 
-	var lastErr error
-	errCount := 0
 	candidates := make([]instance, 0)
-	pageCount, err := eachPage(len(instances), ssmPageSize, func(start, stop int) error {
-		commandID, err := u.sendCommand(instances[start:stop], u.checkDocument)
-		if err != nil {
-			// errors here are considered non-fatal.
-			log.Printf("Failed to send document %s: %v", u.checkDocument, err)
-			errCount++
-			lastErr = err
-			return nil
-		}
-		for _, inst := range bottlerocketInstances[start:stop] {
-			commandOutput, err := u.getCommandResult(commandID, inst.instanceID)
-			if err != nil {
-				// errors here are considered non-fatal
-				log.Printf("Failed to get output for command %s, document %s and instance %q: %v", commandID, u.checkDocument, inst, err)
+	var lastSendErr error
+	sendErrCount := 0
+	for resultChan != nil || errChan != nil {
+		select {
+		case result, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
 				continue
 			}
-			output, err := parseCommandOutput(commandOutput)
-			if err != nil {
-				log.Printf("Failed to parse command output %q for instance %q: %v", string(commandOutput), inst, err)
+			candidates = append(candidates, result.instance)
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
 				continue
 			}
-			if output.UpdateState == updateStateAvailable || output.UpdateState == updateStateReady {
-				inst.bottlerocketVersion = output.ActivePartition.Image.Version
-				candidates = append(candidates, inst)
+			if errors.Is(err, errCheckCommandSendFailed) {
+				sendErrCount++
+				lastSendErr = err
 			}
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
-	if errCount == pageCount {
-		return nil, fmt.Errorf("all attempts to send SSM document %s failed: %w", u.checkDocument, lastErr)
+
+	pageCount := (len(bottlerocketInstances) + ssmPageSize - 1) / ssmPageSize
+	if len(candidates) == 0 && pageCount > 0 && sendErrCount == pageCount {
+		return nil, fmt.Errorf("all attempts to send SSM document %s failed: %w", u.checkDocument, lastSendErr)
 	}
 	return candidates, nil
 }
 
-// eligible checks the eligibility of container instance for update. It's eligible
-// if all the running tasks were started by a service.
-func (u *updater) eligible(containerInstance string) (bool, error) {
+// pageConcurrency returns u's configured page dispatch concurrency, or
+// defaultMaxConcurrentPages if u was constructed without one (as plain
+// struct literals in tests do).
+func (u *updater) pageConcurrency() int {
+	if u.maxConcurrentPages <= 0 {
+		return defaultMaxConcurrentPages
+	}
+	return u.maxConcurrentPages
+}
+
+// filterAvailableUpdatesStream checks bottlerocketInstances for available
+// updates, publishing each instance's instanceResult to the returned channel
+// as soon as its check command completes instead of blocking until the
+// whole cluster has been checked. Pages are dispatched up to
+// u.pageConcurrency() at a time, each running its own
+// SendCommand+wait+collect pipeline, so a cluster with many pages doesn't
+// wait out every page's full cycle serially; every instance within a page is
+// further fetched and published concurrently, same as before. The error
+// channel receives page-level send failures and per-instance inspection
+// failures; either kind is non-fatal to the other instances still being
+// checked. Both channels are closed once every instance has been accounted
+// for.
+func (u *updater) filterAvailableUpdatesStream(ctx context.Context, bottlerocketInstances []instance) (<-chan instanceResult, <-chan error) {
+	log.Printf("Filtering instances with available updates")
+	resultChan := make(chan instanceResult, len(bottlerocketInstances))
+	errChan := make(chan error, len(bottlerocketInstances))
+
+	instances := make([]string, 0, len(bottlerocketInstances))
+	for _, inst := range bottlerocketInstances {
+		instances = append(instances, inst.instanceID)
+	}
+
+	go func() {
+		defer close(resultChan)
+		defer close(errChan)
+
+		sem := make(chan struct{}, u.pageConcurrency())
+		var pagesWG sync.WaitGroup
+		eachPage(len(instances), ssmPageSize, func(start, stop int) error {
+			pagesWG.Add(1)
+			sem <- struct{}{}
+			go func(start, stop int) {
+				defer pagesWG.Done()
+				defer func() { <-sem }()
+
+				commandID, err := u.sendCommand(ctx, instances[start:stop], u.checkDocument)
+				if err != nil {
+					log.Printf("Failed to send document %s: %v", u.checkDocument, err)
+					errChan <- fmt.Errorf("%w: %v", errCheckCommandSendFailed, err)
+					return
+				}
+				var pageWG sync.WaitGroup
+				for _, inst := range bottlerocketInstances[start:stop] {
+					pageWG.Add(1)
+					go u.streamCheckResult(ctx, commandID, inst, resultChan, errChan, &pageWG)
+				}
+				pageWG.Wait()
+			}(start, stop)
+			return nil
+		})
+		pagesWG.Wait()
+	}()
+
+	return resultChan, errChan
+}
+
+// streamCheckResult fetches and parses a single instance's check command
+// output, publishing an instanceResult to resultChan when an update is
+// available for it, or an error to errChan. It's the per-instance unit of
+// work behind filterAvailableUpdatesStream's goroutines.
+func (u *updater) streamCheckResult(ctx context.Context, commandID string, inst instance, resultChan chan<- instanceResult, errChan chan<- error, wg *sync.WaitGroup) {
+	defer wg.Done()
+	output, err := u.checkCommandOutput(ctx, commandID, inst.instanceID)
+	if err != nil {
+		errChan <- fmt.Errorf("failed to get output for command %s, document %s and instance %q: %w", commandID, u.checkDocument, inst.instanceID, err)
+		return
+	}
+	if output.UpdateState != updateStateAvailable && output.UpdateState != updateStateReady {
+		return
+	}
+	currentVersion := output.ActivePartition.Image.Version
+	if ok, reason := u.versionPolicy.Allow(currentVersion, output.ChosenUpdate.Version); !ok {
+		log.Printf("Skipping instance %q: %s", inst.instanceID, reason)
+		return
+	}
+	inst.bottlerocketVersion = currentVersion
+	inst.targetVersion = output.ChosenUpdate.Version
+	resultChan <- instanceResult{instance: inst, version: output.ChosenUpdate.Version, state: output.UpdateState}
+}
+
+// eligible checks the eligibility of container instance for update. It's
+// eligible if u.eligibilityPolicy (ServiceStartedPolicy if unset) permits
+// every task currently running on it.
+func (u *updater) eligible(ctx context.Context, containerInstance string) (bool, error) {
 	log.Printf("Checking eligiblity for update of container instance %q", containerInstance)
-	list, err := u.ecs.ListTasks(&ecs.ListTasksInput{
-		Cluster:           &u.cluster,
-		ContainerInstance: aws.String(containerInstance),
-	})
+	var list *ecs.ListTasksOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		list, err = u.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+			Cluster:           &u.cluster,
+			ContainerInstance: aws.String(containerInstance),
+		})
+		return err
+	}, u.policy())
 	if err != nil {
 		return false, fmt.Errorf("failed to list tasks: %w", err)
 	}
@@ -226,68 +491,221 @@ func (u *updater) eligible(containerInstance string) (bool, error) {
 		return true, nil
 	}
 
-	desc, err := u.ecs.DescribeTasks(&ecs.DescribeTasksInput{
-		Cluster: &u.cluster,
-		Tasks:   taskARNs,
-	})
+	var desc *ecs.DescribeTasksOutput
+	err = retryWithBackoff(ctx, func() error {
+		var err error
+		desc, err = u.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &u.cluster,
+			Tasks:   taskARNs,
+		})
+		return err
+	}, u.policy())
 	if err != nil {
 		return false, fmt.Errorf("failed to describe tasks: %w", err)
 	}
-	for _, listResult := range desc.Tasks {
-		startedBy := aws.StringValue(listResult.StartedBy)
-		if !strings.HasPrefix(startedBy, "ecs-svc/") {
-			log.Printf("Container instance %q has a non-service task running: %s", containerInstance, aws.StringValue(listResult.TaskArn))
+
+	policy := u.eligibilityPolicy
+	if policy == nil {
+		policy = ServiceStartedPolicy{}
+	}
+	for _, task := range desc.Tasks {
+		ok, err := policy.Eligible(ctx, u, containerInstance, task)
+		if err != nil {
+			return false, fmt.Errorf("failed to evaluate eligibility policy: %w", err)
+		}
+		if !ok {
+			log.Printf("Container instance %q has a task that blocks update eligibility: %s", containerInstance, aws.ToString(task.TaskArn))
 			return false, nil
 		}
 	}
 	return true, nil
 }
 
-func (u *updater) drainInstance(containerInstance string) error {
+// drainInstance drains containerInstance and returns the names of the
+// services that had tasks running on it beforehand, so the caller can
+// confirm those services recover once the instance is reactivated.
+func (u *updater) drainInstance(ctx context.Context, containerInstance string) ([]string, error) {
+	start := time.Now()
+	defer func() {
+		u.publishMetric(ctx, metricDrainDurationSeconds, time.Since(start).Seconds(), cloudwatchtypes.StandardUnitSeconds)
+	}()
+
 	log.Printf("Starting drain on container instance %q", containerInstance)
-	resp, err := u.ecs.UpdateContainerInstancesState(&ecs.UpdateContainerInstancesStateInput{
-		Cluster:            &u.cluster,
-		ContainerInstances: aws.StringSlice([]string{containerInstance}),
-		Status:             aws.String("DRAINING"),
-	})
+	services, err := u.servicesOnInstance(ctx, containerInstance)
 	if err != nil {
-		return fmt.Errorf("failed to change instance state to DRAINING: %w", err)
+		return nil, fmt.Errorf("failed to determine services running on instance: %w", err)
+	}
+
+	var resp *ecs.UpdateContainerInstancesStateOutput
+	err = retryWithBackoff(ctx, func() error {
+		var err error
+		resp, err = u.ecs.UpdateContainerInstancesState(ctx, &ecs.UpdateContainerInstancesStateInput{
+			Cluster:            &u.cluster,
+			ContainerInstances: []string{containerInstance},
+			Status:             types.ContainerInstanceStatusDraining,
+		})
+		return err
+	}, u.policy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to change instance state to DRAINING: %w", err)
 	}
 	if len(resp.Failures) != 0 {
 		log.Printf("There are API failures in draining the container instance %q, therefore attempting to"+
 			" re-activate", containerInstance)
-		err = u.activateInstance(containerInstance)
+		err = u.activateInstance(ctx, containerInstance)
 		if err != nil {
 			log.Printf("Instance failed to re-activate after failing to change state to DRAINING: %v", err)
+			u.publish(ctx, updateEvent{
+				Cluster:             u.cluster,
+				ContainerInstanceID: containerInstance,
+				Status:              eventInstanceReactivationFailed,
+				Timestamp:           time.Now(),
+				ErrorMessage:        err.Error(),
+			})
 		}
-		return fmt.Errorf("failures in API call: %v", resp.Failures)
+		return nil, fmt.Errorf("failures in API call: %v", resp.Failures)
 	}
 	log.Printf("Container instance state changed to DRAINING")
 
-	err = u.waitUntilDrained(containerInstance)
+	err = u.waitUntilDrained(ctx, containerInstance)
 	if err != nil {
 		log.Printf("Container instance %q failed to drain, therefore attempting to re-activate", containerInstance)
-		err2 := u.activateInstance(containerInstance)
+		err2 := u.activateInstance(ctx, containerInstance)
 		if err2 != nil {
 			log.Printf("Instance failed to re-activate after failing to wait for drain to complete: %v", err2)
+			u.publish(ctx, updateEvent{
+				Cluster:             u.cluster,
+				ContainerInstanceID: containerInstance,
+				Status:              eventInstanceReactivationFailed,
+				Timestamp:           time.Now(),
+				ErrorMessage:        err2.Error(),
+			})
 		}
-		return fmt.Errorf("error while waiting to drain: %w", err)
+		return nil, fmt.Errorf("error while waiting to drain: %w", err)
 	}
 	log.Printf("Container instance %q drained successfully!", containerInstance)
-	return nil
+	u.publish(ctx, updateEvent{
+		Cluster:             u.cluster,
+		ContainerInstanceID: containerInstance,
+		Status:              eventInstanceDrained,
+		Timestamp:           time.Now(),
+	})
+	return services, nil
+}
+
+// servicesOnInstance returns the distinct names of the services with tasks
+// running on containerInstance, derived from each task's Group field (which
+// ECS sets to "service:<name>" for service-started tasks). Tasks not started
+// by a service are ignored.
+func (u *updater) servicesOnInstance(ctx context.Context, containerInstance string) ([]string, error) {
+	var list *ecs.ListTasksOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		list, err = u.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+			Cluster:           &u.cluster,
+			ContainerInstance: aws.String(containerInstance),
+		})
+		return err
+	}, u.policy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	if len(list.TaskArns) == 0 {
+		return nil, nil
+	}
+
+	var desc *ecs.DescribeTasksOutput
+	err = retryWithBackoff(ctx, func() error {
+		var err error
+		desc, err = u.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &u.cluster,
+			Tasks:   list.TaskArns,
+		})
+		return err
+	}, u.policy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe tasks: %w", err)
+	}
+
+	serviceNames := map[string]bool{}
+	for _, task := range desc.Tasks {
+		if name, ok := strings.CutPrefix(aws.ToString(task.Group), "service:"); ok {
+			serviceNames[name] = true
+		}
+	}
+	services := make([]string, 0, len(serviceNames))
+	for name := range serviceNames {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	return services, nil
 }
 
-func (u *updater) activateInstance(containerInstance string) error {
-	resp, err := u.ecs.UpdateContainerInstancesState(&ecs.UpdateContainerInstancesStateInput{
-		Cluster:            &u.cluster,
-		ContainerInstances: aws.StringSlice([]string{containerInstance}),
-		Status:             aws.String("ACTIVE"),
+// describeServicesMaxBatch is the maximum number of services accepted by a
+// single ECS DescribeServices call.
+const describeServicesMaxBatch = 10
+
+// waitForServicesStable blocks until every named service reports its
+// deployments as COMPLETED and its running count back at its desired count,
+// confirming the workloads that were on a drained instance came back up
+// elsewhere rather than just that the host itself recovered. services is
+// split into batches of describeServicesMaxBatch to stay within DescribeServices'
+// own limit on how many services it accepts per call.
+func (u *updater) waitForServicesStable(ctx context.Context, services []string) error {
+	if len(services) == 0 {
+		return nil
+	}
+	log.Printf("Waiting for services to stabilize: %v", services)
+	policy := u.policy()
+	waiter := ecs.NewServicesStableWaiter(u.ecs, func(o *ecs.ServicesStableWaiterOptions) {
+		policy.servicesStableWaiterOptions(o)
 	})
+	for len(services) > 0 {
+		batch := services
+		if len(batch) > describeServicesMaxBatch {
+			batch = batch[:describeServicesMaxBatch]
+		}
+		err := waiter.Wait(ctx, &ecs.DescribeServicesInput{
+			Cluster:  &u.cluster,
+			Services: batch,
+		}, waiterMaxDuration)
+		if err != nil {
+			return err
+		}
+		services = services[len(batch):]
+	}
+	return nil
+}
+
+func (u *updater) activateInstance(ctx context.Context, containerInstance string) (err error) {
+	start := time.Now()
+	defer func() {
+		u.record(ctx, auditEvent{
+			Time:                time.Now(),
+			Cluster:             u.cluster,
+			ContainerInstanceID: containerInstance,
+			Phase:               auditPhaseActivate,
+			DurationMs:          time.Since(start).Milliseconds(),
+			Outcome:             auditOutcomeFor(err),
+			Error:               errString(err),
+		})
+	}()
+
+	var resp *ecs.UpdateContainerInstancesStateOutput
+	err = retryWithBackoff(ctx, func() error {
+		var err error
+		resp, err = u.ecs.UpdateContainerInstancesState(ctx, &ecs.UpdateContainerInstancesStateInput{
+			Cluster:            &u.cluster,
+			ContainerInstances: []string{containerInstance},
+			Status:             types.ContainerInstanceStatusActive,
+		})
+		return err
+	}, u.policy())
 	if err != nil {
 		return fmt.Errorf("failed to change state to ACTIVE: %w", err)
 	}
 	if len(resp.Failures) != 0 {
-		if aws.StringValue(resp.Failures[0].Reason) == "INACTIVE" {
+		if aws.ToString(resp.Failures[0].Reason) == "INACTIVE" {
 			log.Printf("Container instance %q is in INACTIVE state", containerInstance)
 			return nil
 		}
@@ -297,12 +715,17 @@ func (u *updater) activateInstance(containerInstance string) error {
 	return nil
 }
 
-func (u *updater) waitUntilDrained(containerInstance string) error {
+func (u *updater) waitUntilDrained(ctx context.Context, containerInstance string) error {
 	log.Printf("Waiting for container instance %q to drain", containerInstance)
-	list, err := u.ecs.ListTasks(&ecs.ListTasksInput{
-		Cluster:           &u.cluster,
-		ContainerInstance: aws.String(containerInstance),
-	})
+	var list *ecs.ListTasksOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		list, err = u.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+			Cluster:           &u.cluster,
+			ContainerInstance: aws.String(containerInstance),
+		})
+		return err
+	}, u.policy())
 	if err != nil {
 		return fmt.Errorf("failed to list tasks: %w", err)
 	}
@@ -313,33 +736,53 @@ func (u *updater) waitUntilDrained(containerInstance string) error {
 		return nil
 	}
 
-	return u.ecs.WaitUntilTasksStoppedWithContext(aws.BackgroundContext(), &ecs.DescribeTasksInput{
+	policy := u.policy()
+	waiter := ecs.NewTasksStoppedWaiter(u.ecs, func(o *ecs.TasksStoppedWaiterOptions) {
+		policy.tasksStoppedWaiterOptions(o)
+	})
+	return waiter.Wait(ctx, &ecs.DescribeTasksInput{
 		Cluster: &u.cluster,
 		Tasks:   taskARNs,
-	},
-		request.WithWaiterMaxAttempts(waiterMaxAttempts),
-		request.WithWaiterDelay(request.ConstantWaiterDelay(waiterDelay)),
-	)
+	}, waiterMaxDuration)
 }
 
 // updateInstance starts an update process on an instance.
-func (u *updater) updateInstance(inst instance) error {
+func (u *updater) updateInstance(ctx context.Context, inst instance) (err error) {
+	start := time.Now()
+	var ssmCommandID string
+	defer func() {
+		u.record(ctx, auditEvent{
+			Time:                time.Now(),
+			Cluster:             u.cluster,
+			InstanceID:          inst.instanceID,
+			ContainerInstanceID: inst.containerInstanceID,
+			Phase:               auditPhaseUpdate,
+			FromVersion:         inst.bottlerocketVersion,
+			SSMCommandID:        ssmCommandID,
+			DurationMs:          time.Since(start).Milliseconds(),
+			Outcome:             auditOutcomeFor(err),
+			Error:               errString(err),
+		})
+		u.publishMetric(ctx, metricUpdateDurationSeconds, time.Since(start).Seconds(), cloudwatchtypes.StandardUnitSeconds)
+	}()
+
 	log.Printf("Starting update on instance %q", inst.instanceID)
+	u.publish(ctx, updateEvent{
+		Cluster:             u.cluster,
+		ContainerInstanceID: inst.containerInstanceID,
+		EC2InstanceID:       inst.instanceID,
+		FromVersion:         inst.bottlerocketVersion,
+		Status:              eventUpdateStarted,
+		Timestamp:           time.Now(),
+	})
 	ec2IDs := []string{inst.instanceID}
 	log.Printf("Checking current update state of instance %q", inst.instanceID)
 
-	commandID, err := u.sendCommand(ec2IDs, u.checkDocument)
-	if err != nil {
-		return fmt.Errorf("failed to send check command: %w", err)
-	}
-	output, err := u.getCommandResult(commandID, inst.instanceID)
+	check, commandID, err := u.runCheckCommand(ctx, inst.instanceID)
+	ssmCommandID = commandID
 	if err != nil {
 		return fmt.Errorf("failed to get check command output: %w", err)
 	}
-	check, err := parseCommandOutput(output)
-	if err != nil {
-		return fmt.Errorf("failed to parse command output %q: %w", string(output), err)
-	}
 
 	switch check.UpdateState {
 	case updateStateIdle:
@@ -349,89 +792,266 @@ func (u *updater) updateInstance(inst instance) error {
 		return fmt.Errorf("unexpected update state %q; skipping instance", check.UpdateState)
 	case updateStateAvailable:
 		log.Printf("Starting update apply on instance %q", inst.instanceID)
-		_, err := u.sendCommand(ec2IDs, u.applyDocument)
+		applyCommandID, err := u.sendCommand(ctx, ec2IDs, u.applyDocument)
+		ssmCommandID = applyCommandID
 		if err != nil {
+			u.publish(ctx, updateEvent{
+				Cluster:             u.cluster,
+				ContainerInstanceID: inst.containerInstanceID,
+				EC2InstanceID:       inst.instanceID,
+				FromVersion:         inst.bottlerocketVersion,
+				Status:              eventUpdateFailed,
+				Timestamp:           time.Now(),
+				ErrorMessage:        err.Error(),
+			})
 			return fmt.Errorf("failed to send update apply command: %w", err)
 		}
+		u.publish(ctx, updateEvent{
+			Cluster:             u.cluster,
+			ContainerInstanceID: inst.containerInstanceID,
+			EC2InstanceID:       inst.instanceID,
+			FromVersion:         inst.bottlerocketVersion,
+			SSMCommandID:        applyCommandID,
+			Status:              eventUpdateApplied,
+			Timestamp:           time.Now(),
+		})
 	case updateStateReady:
 		log.Printf("Update is previously applied on instance %q", inst.instanceID)
 	default:
 		return fmt.Errorf("unknown update state %q", check.UpdateState)
 	}
 
+	if u.updateMode == updateModeStopStart {
+		return u.stopStartInstance(ctx, inst.instanceID)
+	}
+	return u.rebootInPlace(ctx, inst.instanceID)
+}
+
+// rebootInPlace applies a previously-staged update with a warm reboot
+// triggered through u.rebootDocument.
+func (u *updater) rebootInPlace(ctx context.Context, ec2ID string) error {
 	// occasionally instance goes into reboot before reporting command output, therefore
 	// we do not poll for command output. Instead we rely on verifyUpdate to confirm update
 	// success or failure.
-	log.Printf("Sending SSM document %q on instance %q", u.rebootDocument, inst.instanceID)
+	log.Printf("Sending SSM document %q on instance %q", u.rebootDocument, ec2ID)
 	// SendCommand is directly called here because we do not want to wait on command complete.
-	resp, err := u.ssm.SendCommand(&ssm.SendCommandInput{
+	resp, err := u.ssm.SendCommand(ctx, &ssm.SendCommandInput{
 		DocumentName:    aws.String(u.rebootDocument),
 		DocumentVersion: aws.String("$DEFAULT"),
-		InstanceIds:     aws.StringSlice(ec2IDs),
-		TimeoutSeconds:  aws.Int64(deliveryTimeoutSeconds),
+		InstanceIds:     []string{ec2ID},
+		TimeoutSeconds:  aws.Int32(deliveryTimeoutSeconds),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to send reboot command: %w", err)
 	}
-	rebootID := *resp.Command.CommandId
+	rebootID := aws.ToString(resp.Command.CommandId)
 	log.Printf("SSM document %q posted with command ID %q", u.rebootDocument, rebootID)
 
 	// added some sleep time for reboot to start before we check instance state
-	time.Sleep(15 * time.Second)
-	err = u.waitUntilOk(inst.instanceID)
+	sleep(15 * time.Second)
+	err = u.waitUntilOk(ctx, ec2ID)
 	if err != nil {
 		return fmt.Errorf("failed to reach Ok status after reboot: %w", err)
 	}
 	return nil
 }
 
-// verifyUpdate verifies if instance was properly updated
-func (u *updater) verifyUpdate(inst instance) (bool, error) {
-	log.Println("Verifying update by checking there is no new version available to update" +
-		" and validate the active version")
-	ec2IDs := []string{inst.instanceID}
-	updateStatus, err := u.sendCommand(ec2IDs, u.checkDocument)
+// stopStartInstance applies a previously-staged update by power-cycling the
+// instance: EC2 Stop, wait for Stopped, EC2 Start, wait for Running, then
+// wait for the usual EC2 status checks to pass. Any failure is wrapped in
+// errInstancePowerCycleFailed so the caller knows not to reactivate the
+// container instance afterward.
+func (u *updater) stopStartInstance(ctx context.Context, ec2ID string) error {
+	log.Printf("Stopping instance %q for power-cycle update", ec2ID)
+	err := retryWithBackoff(ctx, func() error {
+		_, err := u.ec2.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{ec2ID}})
+		return err
+	}, u.policy())
 	if err != nil {
-		return false, fmt.Errorf("failed to send update check command: %w", err)
+		return fmt.Errorf("%w: failed to stop instance: %v", errInstancePowerCycleFailed, err)
+	}
+	if err := u.waitUntilStopped(ctx, ec2ID); err != nil {
+		return fmt.Errorf("%w: failed waiting for instance to stop: %v", errInstancePowerCycleFailed, err)
 	}
 
-	updateResult, err := u.getCommandResult(updateStatus, inst.instanceID)
+	log.Printf("Starting instance %q", ec2ID)
+	err = retryWithBackoff(ctx, func() error {
+		_, err := u.ec2.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{ec2ID}})
+		return err
+	}, u.policy())
 	if err != nil {
-		return false, fmt.Errorf("failed to get check command output: %w", err)
+		return fmt.Errorf("%w: failed to start instance: %v", errInstancePowerCycleFailed, err)
 	}
-	output, err := parseCommandOutput(updateResult)
+	if err := u.waitUntilRunning(ctx, ec2ID); err != nil {
+		return fmt.Errorf("%w: failed waiting for instance to reach running state: %v", errInstancePowerCycleFailed, err)
+	}
+
+	if err := u.waitUntilOk(ctx, ec2ID); err != nil {
+		return fmt.Errorf("%w: failed to reach Ok status after power-cycle: %v", errInstancePowerCycleFailed, err)
+	}
+	return nil
+}
+
+// verifyUpdate checks an already-applied update's outcome: shouldUpdate
+// reports whether inst ended up on an acceptable version, targetVersion is
+// the version it's actually running (or, on a pin violation, the version the
+// policy document wants instead), and reason explains a shouldUpdate=false
+// outcome. err is non-nil both when verification itself couldn't be
+// completed (the check command failed, in which case targetVersion/reason
+// are empty) and when the resulting version violates VersionPolicy or the
+// update policy document's pin/skip_versions rules (in which case
+// targetVersion/reason are populated) -- supervisor.go's poll loop treats any
+// non-nil err as "not ready yet, keep polling" and only stops once err is
+// nil, so it captures targetVersion/reason on every call, not just the
+// terminal one, to still have them for its failure message if the deadline
+// is reached while err keeps coming back non-nil.
+func (u *updater) verifyUpdate(ctx context.Context, inst instance) (shouldUpdate bool, targetVersion string, reason string, err error) {
+	start := time.Now()
+	var ssmCommandID string
+	defer func() {
+		outcome := auditOutcomeFor(err)
+		if err == nil && !shouldUpdate {
+			outcome = auditOutcomeFailure
+		}
+		u.record(ctx, auditEvent{
+			Time:                time.Now(),
+			Cluster:             u.cluster,
+			InstanceID:          inst.instanceID,
+			ContainerInstanceID: inst.containerInstanceID,
+			Phase:               auditPhaseVerify,
+			FromVersion:         inst.bottlerocketVersion,
+			ToVersion:           targetVersion,
+			SSMCommandID:        ssmCommandID,
+			DurationMs:          time.Since(start).Milliseconds(),
+			Outcome:             outcome,
+			Error:               errString(err),
+		})
+		u.publishMetric(ctx, metricVerifyDurationSeconds, time.Since(start).Seconds(), cloudwatchtypes.StandardUnitSeconds)
+	}()
+
+	log.Println("Verifying update by checking there is no new version available to update" +
+		" and validate the active version")
+	output, commandID, err := u.runCheckCommand(ctx, inst.instanceID)
+	ssmCommandID = commandID
 	if err != nil {
-		return false, fmt.Errorf("failed to parse command output %q, manual verification required: %w", string(updateResult), err)
+		return false, "", "", fmt.Errorf("failed to get check command output, manual verification required: %w", err)
 	}
 	updatedVersion := output.ActivePartition.Image.Version
+	targetVersion = updatedVersion
+	if updatedVersion != inst.bottlerocketVersion {
+		if ok, reason := u.versionPolicy.Allow(inst.bottlerocketVersion, updatedVersion); !ok {
+			log.Printf("Container instance %q updated to a version that violates the version policy: %s", inst.containerInstanceID, reason)
+			u.publish(ctx, updateEvent{
+				Cluster:             u.cluster,
+				ContainerInstanceID: inst.containerInstanceID,
+				EC2InstanceID:       inst.instanceID,
+				FromVersion:         inst.bottlerocketVersion,
+				ToVersion:           updatedVersion,
+				SSMCommandID:        ssmCommandID,
+				Status:              eventUpdateFailed,
+				Timestamp:           time.Now(),
+				ErrorMessage:        reason,
+			})
+			return false, updatedVersion, reason, fmt.Errorf("updated version violates version policy: %s", reason)
+		}
+		rule := u.updatePolicy.ruleFor(u.cluster, inst.tags)
+		if ok, ruleTarget, ruleReason := rule.resolve(updatedVersion); !ok {
+			log.Printf("Container instance %q updated to a version that violates the update policy document: %s", inst.containerInstanceID, ruleReason)
+			u.publish(ctx, updateEvent{
+				Cluster:             u.cluster,
+				ContainerInstanceID: inst.containerInstanceID,
+				EC2InstanceID:       inst.instanceID,
+				FromVersion:         inst.bottlerocketVersion,
+				ToVersion:           updatedVersion,
+				SSMCommandID:        ssmCommandID,
+				Status:              eventUpdateFailed,
+				Timestamp:           time.Now(),
+				ErrorMessage:        ruleReason,
+			})
+			return false, ruleTarget, ruleReason, fmt.Errorf("updated version violates update policy document: %s", ruleReason)
+		}
+	}
 	if updatedVersion == inst.bottlerocketVersion {
 		log.Printf("Container instance %q did not update, its current "+
 			"version %s and updated version %s are the same", inst.containerInstanceID, inst.bottlerocketVersion, updatedVersion)
-		return false, nil
+		u.publish(ctx, updateEvent{
+			Cluster:             u.cluster,
+			ContainerInstanceID: inst.containerInstanceID,
+			EC2InstanceID:       inst.instanceID,
+			FromVersion:         inst.bottlerocketVersion,
+			ToVersion:           updatedVersion,
+			SSMCommandID:        ssmCommandID,
+			Status:              eventUpdateFailed,
+			Timestamp:           time.Now(),
+			ErrorMessage:        "instance did not update",
+		})
+		return false, updatedVersion, "instance did not update", nil
 	} else if output.UpdateState == updateStateAvailable {
 		log.Printf("Container instance %q was updated to version %q successfully, however another newer version was recently released;"+
 			" Instance will be updated to newer version in next iteration.", inst.containerInstanceID, updatedVersion)
-		return true, nil
+		u.publish(ctx, updateEvent{
+			Cluster:             u.cluster,
+			ContainerInstanceID: inst.containerInstanceID,
+			EC2InstanceID:       inst.instanceID,
+			FromVersion:         inst.bottlerocketVersion,
+			ToVersion:           updatedVersion,
+			SSMCommandID:        ssmCommandID,
+			Status:              eventUpdateVerified,
+			Timestamp:           time.Now(),
+		})
+		return true, updatedVersion, "", nil
 	}
 	log.Printf("Container instance %q updated to version %q", inst.containerInstanceID, updatedVersion)
-	return true, nil
+	u.publish(ctx, updateEvent{
+		Cluster:             u.cluster,
+		ContainerInstanceID: inst.containerInstanceID,
+		EC2InstanceID:       inst.instanceID,
+		FromVersion:         inst.bottlerocketVersion,
+		ToVersion:           updatedVersion,
+		SSMCommandID:        ssmCommandID,
+		Status:              eventUpdateVerified,
+		Timestamp:           time.Now(),
+	})
+	return true, updatedVersion, "", nil
 }
 
-func (u *updater) sendCommand(instanceIDs []string, ssmDocument string) (string, error) {
+// runCheckCommand sends u's check document to instanceID and returns its
+// parsed result along with the SSM command ID used, consolidating the
+// send-command/wait/get-invocation sequence that updateInstance and
+// verifyUpdate both otherwise repeat. Throttling and the eventual-consistency
+// InvocationDoesNotExist error right after SendCommand are retried
+// transparently by sendCommand's and checkCommandOutput's own backoff (see
+// retriable and SSMWaiterConfig).
+func (u *updater) runCheckCommand(ctx context.Context, instanceID string) (checkOutput, string, error) {
+	commandID, err := u.sendCommand(ctx, []string{instanceID}, u.checkDocument)
+	if err != nil {
+		return checkOutput{}, "", fmt.Errorf("failed to send check command: %w", err)
+	}
+	output, err := u.checkCommandOutput(ctx, commandID, instanceID)
+	return output, commandID, err
+}
+
+func (u *updater) sendCommand(ctx context.Context, instanceIDs []string, ssmDocument string) (string, error) {
 	log.Printf("Sending SSM document %q", ssmDocument)
-	resp, err := u.ssm.SendCommand(&ssm.SendCommandInput{
-		DocumentName:    aws.String(ssmDocument),
-		DocumentVersion: aws.String("$DEFAULT"),
-		InstanceIds:     aws.StringSlice(instanceIDs),
-		TimeoutSeconds:  aws.Int64(deliveryTimeoutSeconds),
-	})
+	var resp *ssm.SendCommandOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		resp, err = u.ssm.SendCommand(ctx, &ssm.SendCommandInput{
+			DocumentName:    aws.String(ssmDocument),
+			DocumentVersion: aws.String("$DEFAULT"),
+			InstanceIds:     instanceIDs,
+			TimeoutSeconds:  aws.Int32(deliveryTimeoutSeconds),
+		})
+		return err
+	}, u.policy())
 	if err != nil {
 		return "", fmt.Errorf("send command failed: %w", err)
 	}
-	commandID := *resp.Command.CommandId
+	commandID := aws.ToString(resp.Command.CommandId)
 	log.Printf("SSM document %q posted with command id %q", ssmDocument, commandID)
 
 	// Wait for the sent commands to complete.
+	policy := u.policy()
 	wg := sync.WaitGroup{}
 	instanceCount := len(instanceIDs)
 	errChan := make(chan error, instanceCount)
@@ -440,65 +1060,153 @@ func (u *updater) sendCommand(instanceIDs []string, ssmDocument string) (string,
 		wg.Add(1)
 		go func(instanceID string) {
 			defer wg.Done()
-			err = u.ssm.WaitUntilCommandExecutedWithContext(aws.BackgroundContext(), &ssm.GetCommandInvocationInput{
+			waiter := ssm.NewCommandExecutedWaiter(u.ssm, func(o *ssm.CommandExecutedWaiterOptions) {
+				policy.commandExecutedWaiterOptions(o)
+				u.ssmWaiterConfig.commandExecutedWaiterOptions(o)
+			})
+			err := waiter.Wait(ctx, &ssm.GetCommandInvocationInput{
 				CommandId:  aws.String(commandID),
 				InstanceId: aws.String(instanceID),
-			},
-				request.WithWaiterMaxAttempts(waiterMaxAttempts),
-				request.WithWaiterDelay(request.ConstantWaiterDelay(waiterDelay)))
+			}, waiterMaxDuration)
 			if err != nil {
 				errChan <- err
 				log.Printf("Error encountered while awaiting document %q execution for instance: %q: %s", ssmDocument, instanceID, err)
-				u.logCommmandOutput(commandID, instanceID)
+				u.logCommmandOutput(ctx, commandID, instanceID)
 			}
-		}(aws.StringValue(&v))
+		}(v)
 	}
 	wg.Wait()
 	close(errChan)
 
 	errCount := 0
-	for err = range errChan {
+	var lastErr error
+	for err := range errChan {
 		errCount++
+		lastErr = err
 		if errCount == instanceCount {
-			return "", fmt.Errorf("too many failures while awaiting document execution: %w", err)
+			return "", fmt.Errorf("too many failures while awaiting document execution: %w", lastErr)
 		}
 	}
 	return commandID, nil
 }
 
-func (u *updater) getCommandResult(commandID string, instanceID string) ([]byte, error) {
-	resp, err := u.ssm.GetCommandInvocation(&ssm.GetCommandInvocationInput{
+// fetchCommandInvocation makes a single, non-retrying GetCommandInvocation
+// call for commandID/instanceID.
+func (u *updater) fetchCommandInvocation(ctx context.Context, commandID string, instanceID string) (*ssm.GetCommandInvocationOutput, error) {
+	return u.ssm.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
 		CommandId:  aws.String(commandID),
 		InstanceId: aws.String(instanceID),
 	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve command invocation output: %w", err)
+}
+
+// retriableCheckStatus reports whether status means commandID's invocation
+// hasn't finished yet, as opposed to a terminal status (Success, or a
+// terminal failure like Failed/Cancelled/TimedOut/Cancelling).
+func retriableCheckStatus(status ssmtypes.CommandInvocationStatus) bool {
+	switch status {
+	case ssmtypes.CommandInvocationStatusPending, ssmtypes.CommandInvocationStatusInProgress, ssmtypes.CommandInvocationStatusDelayed:
+		return true
+	default:
+		return false
 	}
-	commandResults := []byte(aws.StringValue(resp.StandardOutputContent))
-	if aws.StringValue(resp.Status) != ssm.CommandInvocationStatusSuccess {
-		return nil, fmt.Errorf("command %s has not reached success status, current status %q", commandID, aws.StringValue(resp.Status))
+}
+
+// checkCommandOutput fetches and parses commandID's check output for
+// instanceID, retrying with u.retries()'s full-jitter backoff while the
+// result looks transient: a retriable GetCommandInvocation error (see
+// retriable), an invocation that hasn't reached a terminal status yet, or
+// output that fails to parse. A terminal failure status (Failed, Cancelled,
+// TimedOut, Cancelling) is returned immediately, and a parse failure is only
+// terminal once every attempt has been spent -- both without sleeping out
+// the rest of the retry budget.
+func (u *updater) checkCommandOutput(ctx context.Context, commandID string, instanceID string) (checkOutput, error) {
+	policy := u.retries()
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return checkOutput{}, err
+		}
+		retry := false
+		resp, err := u.fetchCommandInvocation(ctx, commandID, instanceID)
+		switch {
+		case err != nil:
+			lastErr = fmt.Errorf("failed to retrieve command invocation output: %w", err)
+			retry = retriable(err)
+		case resp.Status == ssmtypes.CommandInvocationStatusSuccess:
+			commandOutput := []byte(aws.ToString(resp.StandardOutputContent))
+			output, parseErr := parseCommandOutput(commandOutput)
+			if parseErr == nil {
+				return output, nil
+			}
+			lastErr = fmt.Errorf("failed to parse command output %q for instance %q: %w", string(commandOutput), instanceID, parseErr)
+			retry = true
+		case retriableCheckStatus(resp.Status):
+			lastErr = fmt.Errorf("command %s has not reached a terminal status yet, current status %q", commandID, resp.Status)
+			retry = true
+		default:
+			if stderr := aws.ToString(resp.StandardErrorContent); stderr != "" {
+				return checkOutput{}, fmt.Errorf("command %s has not reached success status, current status %q, stderr: %s", commandID, resp.Status, stderr)
+			}
+			return checkOutput{}, fmt.Errorf("command %s has not reached success status, current status %q", commandID, resp.Status)
+		}
+		if !retry {
+			return checkOutput{}, lastErr
+		}
+		if attempt == maxAttempts-1 {
+			break
+		}
+		sleep(policy.delay(attempt))
 	}
-	return commandResults, nil
+	return checkOutput{}, fmt.Errorf("gave up after %d attempts: %w", maxAttempts, lastErr)
 }
 
 // logCommmandOutput logs the ssm command invocation response
-func (u *updater) logCommmandOutput(commandID string, instanceID string) {
-	resp, err := u.ssm.GetCommandInvocation(&ssm.GetCommandInvocationInput{
-		CommandId:  aws.String(commandID),
-		InstanceId: aws.String(instanceID),
-	})
+func (u *updater) logCommmandOutput(ctx context.Context, commandID string, instanceID string) {
+	resp, err := u.fetchCommandInvocation(ctx, commandID, instanceID)
 	if err != nil {
 		log.Printf("Failed to get invocation output for instance %q: %v", instanceID, err)
 	}
-	log.Printf("Invocation output for instance %q: %#q", instanceID, resp)
+	log.Printf("Invocation output for instance %q: %+v", instanceID, resp)
 }
 
 // waitUntilOk takes an EC2 ID as a parameter and waits until the specified EC2 instance is in an Ok status.
-func (u *updater) waitUntilOk(ec2ID string) error {
+func (u *updater) waitUntilOk(ctx context.Context, ec2ID string) error {
 	log.Printf("Waiting for instance %q to reach Ok status", ec2ID)
-	return u.ec2.WaitUntilInstanceStatusOk(&ec2.DescribeInstanceStatusInput{
-		InstanceIds: []*string{aws.String(ec2ID)},
+	policy := u.policy()
+	waiter := ec2.NewInstanceStatusOkWaiter(u.ec2, func(o *ec2.InstanceStatusOkWaiterOptions) {
+		policy.instanceStatusOkWaiterOptions(o)
+	})
+	return waiter.Wait(ctx, &ec2.DescribeInstanceStatusInput{
+		InstanceIds: []string{ec2ID},
+	}, waiterMaxDuration)
+}
+
+// waitUntilStopped blocks until ec2ID reports the EC2 "stopped" state.
+func (u *updater) waitUntilStopped(ctx context.Context, ec2ID string) error {
+	log.Printf("Waiting for instance %q to stop", ec2ID)
+	policy := u.policy()
+	waiter := ec2.NewInstanceStoppedWaiter(u.ec2, func(o *ec2.InstanceStoppedWaiterOptions) {
+		policy.instanceStoppedWaiterOptions(o)
+	})
+	return waiter.Wait(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{ec2ID},
+	}, waiterMaxDuration)
+}
+
+// waitUntilRunning blocks until ec2ID reports the EC2 "running" state.
+func (u *updater) waitUntilRunning(ctx context.Context, ec2ID string) error {
+	log.Printf("Waiting for instance %q to reach running state", ec2ID)
+	policy := u.policy()
+	waiter := ec2.NewInstanceRunningWaiter(u.ec2, func(o *ec2.InstanceRunningWaiterOptions) {
+		policy.instanceRunningWaiterOptions(o)
 	})
+	return waiter.Wait(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{ec2ID},
+	}, waiterMaxDuration)
 }
 
 // parseCommandOutput takes raw bytes of ssm command output and converts it into a struct
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// TestUpdateOneCallOrder locks the drain -> reboot -> verify -> activate
+// sequence that updateOne must follow for a single instance, using the
+// generated gomock mocks so that any reordering (e.g. activating before the
+// update is verified) fails the test even though every individual call
+// succeeds in isolation. See the doc comment atop mock_test.go for why the
+// rest of the suite still builds the hand-written mocks instead of these.
+func TestUpdateOneCallOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockECS := NewMockECSAPI(ctrl)
+	mockSSM := NewMockSSMAPI(ctrl)
+	mockEC2 := NewMockEC2API(ctrl)
+
+	const (
+		cluster             = "arn:aws:ecs:us-west-2:123456789012:cluster/test-cluster"
+		containerInstanceID = "ci-1"
+		ec2InstanceID       = "i-1"
+		checkDocument       = "check-document"
+		applyDocument       = "apply-document"
+		rebootDocument      = "reboot-document"
+	)
+
+	isCluster := func(cl *string) bool { return aws.ToString(cl) == cluster }
+	hasInstance := func(ids []string) bool { return len(ids) == 1 && ids[0] == ec2InstanceID }
+	hasContainerInstance := func(ids []string) bool { return len(ids) == 1 && ids[0] == containerInstanceID }
+	isDocument := func(name *string, want string) bool { return aws.ToString(name) == want }
+
+	checkOutput := []byte(`{"update_state": "Available", "active_partition": {"image": {"version": "0.0.0"}}}`)
+	verifyOutput := []byte(`{"update_state": "Idle", "active_partition": {"image": {"version": "1.0.0"}}}`)
+
+	// GetCommandInvocation backs both the per-instance waiter inside
+	// sendCommand and the follow-up fetch in getCommandResult. Its relative
+	// order doesn't carry meaning on its own, so it's left unordered here and
+	// keyed off the command ID instead.
+	commandOutputs := map[string][]byte{
+		"command-check":  checkOutput,
+		"command-apply":  verifyOutput,
+		"command-verify": verifyOutput,
+	}
+	mockSSM.EXPECT().
+		GetCommandInvocation(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ssm.GetCommandInvocationInput)
+			return ok && hasInstance([]string{aws.ToString(in.InstanceId)})
+		}), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, in *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			out, ok := commandOutputs[aws.ToString(in.CommandId)]
+			require.True(t, ok, "unexpected command id %q", aws.ToString(in.CommandId))
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(string(out)),
+			}, nil
+		}).
+		AnyTimes()
+
+	isListTasksInput := func(x any) bool {
+		in, ok := x.(*ecs.ListTasksInput)
+		return ok && isCluster(in.Cluster) && aws.ToString(in.ContainerInstance) == containerInstanceID
+	}
+
+	// eligible() and drainInstance's own pre-drain service snapshot both call
+	// ListTasks before updateOne reaches the actual DRAINING state change.
+	// Reporting no tasks for both marks the instance eligible and leaves it
+	// with no services to wait on post-reactivation, without pulling in
+	// DescribeTasks a second time here.
+	eligibilityCheck := mockECS.EXPECT().
+		ListTasks(gomock.Any(), gomock.Cond(isListTasksInput), gomock.Any()).
+		Return(&ecs.ListTasksOutput{TaskArns: []string{}}, nil).
+		Times(2)
+
+	drain := mockECS.EXPECT().
+		UpdateContainerInstancesState(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ecs.UpdateContainerInstancesStateInput)
+			return ok && isCluster(in.Cluster) && hasContainerInstance(in.ContainerInstances) && in.Status == types.ContainerInstanceStatusDraining
+		}), gomock.Any()).
+		Return(&ecs.UpdateContainerInstancesStateOutput{}, nil).
+		Times(1).
+		After(eligibilityCheck)
+
+	listTasks := mockECS.EXPECT().
+		ListTasks(gomock.Any(), gomock.Cond(isListTasksInput)).
+		Return(&ecs.ListTasksOutput{TaskArns: []string{"task-1"}}, nil).
+		Times(1).
+		After(drain)
+
+	waitStopped := mockECS.EXPECT().
+		DescribeTasks(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ecs.DescribeTasksInput)
+			return ok && isCluster(in.Cluster)
+		}), gomock.Any()).
+		Return(&ecs.DescribeTasksOutput{Tasks: []types.Task{{LastStatus: aws.String("STOPPED")}}}, nil).
+		Times(1).
+		After(listTasks)
+
+	sendCheck := mockSSM.EXPECT().
+		SendCommand(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ssm.SendCommandInput)
+			return ok && isDocument(in.DocumentName, checkDocument) && hasInstance(in.InstanceIds)
+		}), gomock.Any()).
+		Return(&ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-check")}}, nil).
+		Times(1).
+		After(waitStopped)
+
+	sendApply := mockSSM.EXPECT().
+		SendCommand(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ssm.SendCommandInput)
+			return ok && isDocument(in.DocumentName, applyDocument) && hasInstance(in.InstanceIds)
+		}), gomock.Any()).
+		Return(&ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-apply")}}, nil).
+		Times(1).
+		After(sendCheck)
+
+	sendReboot := mockSSM.EXPECT().
+		SendCommand(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ssm.SendCommandInput)
+			return ok && isDocument(in.DocumentName, rebootDocument) && hasInstance(in.InstanceIds)
+		}), gomock.Any()).
+		Return(&ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-reboot")}}, nil).
+		Times(1).
+		After(sendApply)
+
+	waitInstanceOk := mockEC2.EXPECT().
+		DescribeInstanceStatus(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ec2.DescribeInstanceStatusInput)
+			return ok && hasInstance(in.InstanceIds)
+		}), gomock.Any()).
+		Return(&ec2.DescribeInstanceStatusOutput{InstanceStatuses: []ec2types.InstanceStatus{{
+			InstanceState:  &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+			InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+			SystemStatus:   &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+		}}}, nil).
+		Times(1).
+		After(sendReboot)
+
+	activate := mockECS.EXPECT().
+		UpdateContainerInstancesState(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ecs.UpdateContainerInstancesStateInput)
+			return ok && isCluster(in.Cluster) && hasContainerInstance(in.ContainerInstances) && in.Status == types.ContainerInstanceStatusActive
+		}), gomock.Any()).
+		Return(&ecs.UpdateContainerInstancesStateOutput{}, nil).
+		Times(1).
+		After(waitInstanceOk)
+
+	mockSSM.EXPECT().
+		SendCommand(gomock.Any(), gomock.Cond(func(x any) bool {
+			in, ok := x.(*ssm.SendCommandInput)
+			return ok && isDocument(in.DocumentName, checkDocument) && hasInstance(in.InstanceIds)
+		}), gomock.Any()).
+		Return(&ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-verify")}}, nil).
+		Times(1).
+		After(activate)
+
+	restoreSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = restoreSleep }()
+
+	policy, restorePolicy := tinyWaiterPolicy(t)
+	defer restorePolicy()
+
+	u := &updater{
+		cluster:        cluster,
+		checkDocument:  checkDocument,
+		applyDocument:  applyDocument,
+		rebootDocument: rebootDocument,
+		ecs:            mockECS,
+		ssm:            mockSSM,
+		ec2:            mockEC2,
+		backoffPolicy:  policy,
+	}
+
+	i := instance{instanceID: ec2InstanceID, containerInstanceID: containerInstanceID, bottlerocketVersion: "0.0.0", targetVersion: "1.0.0"}
+	outcome, failed := u.updateOne(context.Background(), i, time.Second)
+	require.False(t, failed, "outcome: %s", outcome)
+}
@@ -1,60 +1,68 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ecs"
-	"github.com/aws/aws-sdk-go/service/ssm"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// tinyWaiterPolicy overrides waiterMaxDuration and returns a BackoffPolicy
+// with a tiny MinDelay/MaxDelay, so tests exercising a waiter that never
+// succeeds converge to a timeout in milliseconds instead of minutes. The
+// returned func restores waiterMaxDuration and must be deferred.
+func tinyWaiterPolicy(t *testing.T) (BackoffPolicy, func()) {
+	t.Helper()
+	restore := waiterMaxDuration
+	waiterMaxDuration = 50 * time.Millisecond
+	return BackoffPolicy{
+			InitialInterval: time.Millisecond,
+			MaxInterval:     5 * time.Millisecond,
+			MaxAttempts:     1,
+		}, func() {
+			waiterMaxDuration = restore
+		}
+}
+
+// assertWaitTimeoutErr checks that err reflects a waiter that exhausted
+// waiterMaxDuration. Depending on scheduling, the SDK either reports its own
+// "exceeded max wait time" message or has its sleep interrupted first by the
+// context deadline it derives from that same duration.
+func assertWaitTimeoutErr(t *testing.T, err error) {
+	t.Helper()
+	require.Error(t, err)
+	assert.True(t,
+		strings.Contains(err.Error(), "exceeded max wait time") || strings.Contains(err.Error(), "context deadline exceeded"),
+		"expected a wait-timeout error, got: %v", err)
+}
+
 func TestFilterAvailableUpdates(t *testing.T) {
 	instances := []instance{
-		{
-			instanceID:          "inst-id-1",
-			containerInstanceID: "cont-inst-1",
-		},
-		{
-			instanceID:          "inst-id-2",
-			containerInstanceID: "cont-inst-2",
-		},
-		{
-			instanceID:          "inst-id-3",
-			containerInstanceID: "cont-inst-3",
-		},
-		{
-			instanceID:          "inst-id-4",
-			containerInstanceID: "cont-inst-4",
-		},
-		{
-			instanceID:          "inst-id-5",
-			containerInstanceID: "cont-inst-5",
-		},
+		{instanceID: "inst-id-1", containerInstanceID: "cont-inst-1"},
+		{instanceID: "inst-id-2", containerInstanceID: "cont-inst-2"},
+		{instanceID: "inst-id-3", containerInstanceID: "cont-inst-3"},
+		{instanceID: "inst-id-4", containerInstanceID: "cont-inst-4"},
+		{instanceID: "inst-id-5", containerInstanceID: "cont-inst-5"},
 	}
 	expected := []instance{
-		{
-			instanceID:          "inst-id-1",
-			containerInstanceID: "cont-inst-1",
-			bottlerocketVersion: "v1.0.5",
-		},
-		{
-			instanceID:          "inst-id-2",
-			containerInstanceID: "cont-inst-2",
-			bottlerocketVersion: "v1.0.5",
-		},
-		{
-			instanceID:          "inst-id-5",
-			containerInstanceID: "cont-inst-5",
-			bottlerocketVersion: "v1.0.5",
-		},
+		{instanceID: "inst-id-1", containerInstanceID: "cont-inst-1", bottlerocketVersion: "v1.0.5"},
+		{instanceID: "inst-id-2", containerInstanceID: "cont-inst-2", bottlerocketVersion: "v1.0.5"},
+		{instanceID: "inst-id-5", containerInstanceID: "cont-inst-5", bottlerocketVersion: "v1.0.5"},
 	}
 	responses := map[string]string{
 		"inst-id-1": `{"update_state": "Available", "active_partition": { "image": { "version": "v1.0.5"}}}`,
@@ -64,44 +72,37 @@ func TestFilterAvailableUpdates(t *testing.T) {
 		"inst-id-5": `{"update_state": "Available", "active_partition": { "image": { "version": "v1.0.5"}}}`,
 	}
 
-	// mutex needed to prevent race condition when incrementing counter in concurrent
-	// execution of WaitUntilCommandExecutedWithContextFn
 	var m sync.Mutex
 	sendCommandCalls := 0
-	commandWaiterCalls := 0
 	getCommandInvocationCalls := 0
 	mockSSM := MockSSM{
-		GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			m.Lock()
 			getCommandInvocationCalls++
+			m.Unlock()
 			return &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
-				StandardOutputContent: aws.String(responses[*input.InstanceId]),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(responses[aws.ToString(input.InstanceId)]),
 			}, nil
 		},
-		SendCommandFn: func(_ *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
 			sendCommandCalls++
 			return &ssm.SendCommandOutput{
-				Command: &ssm.Command{
+				Command: &ssmtypes.Command{
 					CommandId:    aws.String("command-id"),
 					DocumentName: aws.String("check-document"),
 				},
 			}, nil
 		},
-		WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-			m.Lock()
-			commandWaiterCalls++
-			m.Unlock()
-			assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-			return nil
-		},
 	}
-	u := updater{ssm: mockSSM, checkDocument: "check-document"}
-	actual, err := u.filterAvailableUpdates(instances)
+	u := updater{ssm: mockSSM, checkDocument: "check-document", versionPolicy: &VersionPolicy{}}
+	actual, err := u.filterAvailableUpdates(context.Background(), instances)
 	require.NoError(t, err)
-	assert.Equal(t, expected, actual, "Should only contain instances in Aavailable or Ready update state")
+	assert.ElementsMatch(t, expected, actual, "Should only contain instances in Available or Ready update state")
 	assert.Equal(t, 1, sendCommandCalls, "should send commands for each page")
-	assert.Equal(t, 5, commandWaiterCalls, "should wait for each instance")
-	assert.Equal(t, 5, getCommandInvocationCalls, "should collect output for each instance")
+	// Every instance is polled once by sendCommand's waiter and once by
+	// getCommandResult to fetch the check output.
+	assert.Equal(t, 2*len(instances), getCommandInvocationCalls, "should poll for wait and collect output for each instance")
 }
 
 func TestPaginatedFilterAvailableUpdatesSuccess(t *testing.T) {
@@ -109,82 +110,67 @@ func TestPaginatedFilterAvailableUpdatesSuccess(t *testing.T) {
 	expected := make([]instance, 0)
 	instances := make([]instance, 0)
 	getOut := &ssm.GetCommandInvocationOutput{
-		Status:                aws.String("Success"),
+		Status:                ssmtypes.CommandInvocationStatusSuccess,
 		StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable, "v1.0.5")),
 	}
 
-	for i := 0; i < 100; i++ { // 100 is chosen here to reprsent 2 full pages of SSM (limited to 50 per page)
+	for i := 0; i < 100; i++ { // 100 is chosen here to represent 2 full pages of SSM (limited to 50 per page)
 		containerID := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: containerID,
-		})
-		expected = append(expected, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: containerID,
-			bottlerocketVersion: "v1.0.5",
-		})
+		instances = append(instances, instance{instanceID: ec2ID, containerInstanceID: containerID})
+		expected = append(expected, instance{instanceID: ec2ID, containerInstanceID: containerID, bottlerocketVersion: "v1.0.5"})
 	}
 
-	// mutex needed to prevent race condition when incrementing counter in concurrent
-	// execution of WaitUntilCommandExecutedWithContextFn
 	var m sync.Mutex
 	sendCommandCalls := 0
-	commandWaiterCalls := 0
 	getCommandInvocationCalls := 0
 	mockSSM := MockSSM{
-		GetCommandInvocationFn: func(_ *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			m.Lock()
 			getCommandInvocationCalls++
+			m.Unlock()
 			return getOut, nil
 		},
-		SendCommandFn: func(_ *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			m.Lock()
 			sendCommandCalls++
+			m.Unlock()
 			return &ssm.SendCommandOutput{
-				Command: &ssm.Command{
+				Command: &ssmtypes.Command{
 					CommandId:    aws.String("command-id"),
 					DocumentName: aws.String("check-document"),
 				},
 			}, nil
 		},
-		WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-			m.Lock()
-			commandWaiterCalls++
-			m.Unlock()
-			assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-			return nil
-		},
 	}
-	u := updater{ssm: mockSSM}
-	actual, err := u.filterAvailableUpdates(instances)
+	u := updater{ssm: mockSSM, versionPolicy: &VersionPolicy{}}
+	actual, err := u.filterAvailableUpdates(context.Background(), instances)
 	require.NoError(t, err)
-	assert.EqualValues(t, expected, actual, "should contain all instances")
+	assert.ElementsMatch(t, expected, actual, "should contain all instances")
 	assert.Equal(t, 2, sendCommandCalls, "should send commands for each page")
-	assert.Equal(t, 100, commandWaiterCalls, "should wait for each instance")
-	assert.Equal(t, 100, getCommandInvocationCalls, "should collect output for each instance")
+	assert.Equal(t, 2*len(instances), getCommandInvocationCalls, "should poll for wait and collect output for each instance")
 }
 
 func TestPaginatedFilterAvailableUpdatesAllFail(t *testing.T) {
 	instances := make([]instance, 0)
-
 	for i := 0; i < 100; i++ {
 		containerID := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: containerID,
-		})
+		instances = append(instances, instance{instanceID: ec2ID, containerInstanceID: containerID})
 	}
 
+	var m sync.Mutex
 	sendCommandCalls := 0
 	mockSSM := MockSSM{
-		SendCommandFn: func(_ *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			m.Lock()
 			sendCommandCalls++
+			m.Unlock()
 			return nil, errors.New("Failed to send document")
 		},
 	}
-	u := updater{ssm: mockSSM}
-	actual, err := u.filterAvailableUpdates(instances)
+	u := updater{ssm: mockSSM, versionPolicy: &VersionPolicy{}}
+	actual, err := u.filterAvailableUpdates(context.Background(), instances)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "Failed to send document")
 	assert.Empty(t, actual)
@@ -197,63 +183,75 @@ func TestPaginatedFilterAvailableUpdatesInPageFailures(t *testing.T) {
 	for i := 0; i < 120; i++ { // 120 chosen here to ensure multiple pages are tested and that number instances divides by 3 evenly
 		containerID := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: containerID,
-		})
+		instances = append(instances, instance{instanceID: ec2ID, containerInstanceID: containerID})
 	}
 
-	// mutex needed to prevent race condition when incrementing counter in concurrent
-	// execution of WaitUntilCommandExecutedWithContextFn
+	// waiterRemaining tracks how many of the calls for the page currently in
+	// flight still belong to sendCommand's per-instance wait, so those calls
+	// (which must report a terminal status or the waiter spins until
+	// timeout) aren't mixed in with the 1-in-3 getCommandResult pattern below.
 	var m sync.Mutex
+	waiterRemaining := 0
 	sendCommandCalls := 0
-	commandWaiterCalls := 0
 	getCommandInvocationCalls := 0
-	count := 0
+	resultCount := 0
 	mockSSM := MockSSM{
-		GetCommandInvocationFn: func(_ *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-			count++
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			sendCommandCalls++
+			m.Lock()
+			waiterRemaining = len(input.InstanceIds)
+			m.Unlock()
+			return &ssm.SendCommandOutput{
+				Command: &ssmtypes.Command{
+					CommandId:    aws.String("command-id"),
+					DocumentName: aws.String("check-document"),
+				},
+			}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			m.Lock()
 			getCommandInvocationCalls++
-			switch count % 3 {
+			isWaiterCall := waiterRemaining > 0
+			if isWaiterCall {
+				waiterRemaining--
+			}
+			m.Unlock()
+			if isWaiterCall {
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
+			}
+			m.Lock()
+			resultCount++
+			n := resultCount
+			m.Unlock()
+			switch n % 3 {
 			case 0:
 				return nil, errors.New("Failed to get command output") // validate getCommandResult failure
 			case 1:
 				return &ssm.GetCommandInvocationOutput{
-					Status:                aws.String("Success"),
+					Status:                ssmtypes.CommandInvocationStatusSuccess,
 					StandardOutputContent: aws.String("{}"),
 				}, nil // validates parseCommandOutput failure
-			case 2:
+			default:
 				return &ssm.GetCommandInvocationOutput{
-					Status:                aws.String("Success"),
+					Status:                ssmtypes.CommandInvocationStatusSuccess,
 					StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable, "v1.0.5")),
 				}, nil // validate success case
 			}
-			return nil, nil
-		},
-		SendCommandFn: func(_ *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-			sendCommandCalls++
-			return &ssm.SendCommandOutput{
-				Command: &ssm.Command{
-					CommandId:    aws.String("command-id"),
-					DocumentName: aws.String("check-document"),
-				},
-			}, nil
-		},
-		WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-			assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-			m.Lock()
-			commandWaiterCalls++
-			m.Unlock()
-			return nil
 		},
 	}
-	u := updater{ssm: mockSSM}
-	actual, err := u.filterAvailableUpdates(instances)
+	// Retries are disabled here: this test exercises pagination and
+	// per-instance failure isolation, not checkCommandOutput's retry
+	// behavior (covered separately by TestCheckCommandOutput), and its
+	// mock's global resultCount counter would otherwise advance on every
+	// retried attempt too, making the 1-in-3 failure pattern nondeterministic.
+	// Pages are forced to run one at a time (maxConcurrentPages: 1) since
+	// waiterRemaining above tracks only the page currently in flight.
+	u := updater{ssm: mockSSM, versionPolicy: &VersionPolicy{}, retryPolicy: RetryPolicy{MaxAttempts: 1}, maxConcurrentPages: 1}
+	actual, err := u.filterAvailableUpdates(context.Background(), instances)
 	require.NoError(t, err)
 	assert.EqualValues(t, 40, len(actual), "Every 3rd instance of 120 should succeed")
 	assert.Equal(t, 3, sendCommandCalls, "should send commands for each page")
-	assert.Equal(t, 120, commandWaiterCalls, "should wait for each instance")
-	assert.Equal(t, 120, getCommandInvocationCalls, "should collect output for each instance")
+	assert.Equal(t, 2*len(instances), getCommandInvocationCalls, "should poll for wait and collect output for each instance")
 }
 
 func TestPaginatedFilterAvailableUpdatesSingleErr(t *testing.T) {
@@ -261,146 +259,387 @@ func TestPaginatedFilterAvailableUpdatesSingleErr(t *testing.T) {
 	expected := make([]instance, 0)
 	instances := make([]instance, 0)
 	getOut := &ssm.GetCommandInvocationOutput{
-		Status:                aws.String("Success"),
+		Status:                ssmtypes.CommandInvocationStatusSuccess,
 		StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable, "v1.0.5")),
 	}
 
 	for i := 0; i < 100; i++ {
 		containerID := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: containerID,
-		})
-		expected = append(expected, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: containerID,
-			bottlerocketVersion: "v1.0.5",
-		})
+		instances = append(instances, instance{instanceID: ec2ID, containerInstanceID: containerID})
+		expected = append(expected, instance{instanceID: ec2ID, containerInstanceID: containerID, bottlerocketVersion: "v1.0.5"})
 	}
 
 	pageErrors := []error{errors.New("Failed to send document"), nil}
 
-	// mutex needed to prevent race condition when incrementing counter in concurrent
-	// execution of WaitUntilCommandExecutedWithContextFn
 	var m sync.Mutex
 	sendCommandCalls := 0
-	commandWaiterCalls := 0
 	getCommandInvocationCalls := 0
 	callCount := 0
 	mockSSM := MockSSM{
-		GetCommandInvocationFn: func(_ *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			m.Lock()
 			getCommandInvocationCalls++
+			m.Unlock()
 			return getOut, nil
 		},
-		SendCommandFn: func(_ *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			m.Lock()
 			require.Less(t, callCount, len(pageErrors))
 			failErr := pageErrors[callCount]
 			callCount++
 			sendCommandCalls++
+			m.Unlock()
 			return &ssm.SendCommandOutput{
-				Command: &ssm.Command{
+				Command: &ssmtypes.Command{
 					CommandId:    aws.String("command-id"),
 					DocumentName: aws.String("check-document"),
 				},
 			}, failErr
 		},
-		WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-			assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-			m.Lock()
-			commandWaiterCalls++
-			m.Unlock()
-			return nil
-		},
 	}
-	u := updater{ssm: mockSSM}
-	actual, err := u.filterAvailableUpdates(instances)
+	// Pages are forced to run one at a time (maxConcurrentPages: 1) so
+	// pageErrors[callCount] deterministically targets the first page.
+	u := updater{ssm: mockSSM, versionPolicy: &VersionPolicy{}, maxConcurrentPages: 1}
+	actual, err := u.filterAvailableUpdates(context.Background(), instances)
 
 	require.NoError(t, err)
-	assert.EqualValues(t, actual, expected[50:], "Should only contain instances from the 2nd page")
+	assert.ElementsMatch(t, expected[50:], actual, "Should only contain instances from the 2nd page")
 	assert.Equal(t, 2, sendCommandCalls, "should send commands for each page")
-	assert.Equal(t, 50, commandWaiterCalls, "should wait for each instance")
-	assert.Equal(t, 50, getCommandInvocationCalls, "should collect output for each instance")
+	assert.Equal(t, 2*50, getCommandInvocationCalls, "should poll for wait and collect output for only the successful page")
 }
 
-func TestGetCommandResult(t *testing.T) {
-	cases := []struct {
-		name            string
-		invocationOut   *ssm.GetCommandInvocationOutput
-		expectedError   string
-		expectedOut     []byte
-		invocationError error
-	}{
-		{
-			name: "getCommand success",
-			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
-				StandardOutputContent: aws.String("OutputContent"),
-			},
-			expectedOut: []byte(aws.StringValue(aws.String("OutputContent"))),
+func TestPaginatedFilterAvailableUpdatesPageConcurrencyCapped(t *testing.T) {
+	const maxConcurrentPages = 2
+	instances := make([]instance, 0)
+	for i := 0; i < 200; i++ { // 200 instances is 4 pages of 50, twice maxConcurrentPages
+		containerID := "cont-inst-br" + strconv.Itoa(i)
+		ec2ID := "ec2-id-br" + strconv.Itoa(i)
+		instances = append(instances, instance{instanceID: ec2ID, containerInstanceID: containerID})
+	}
+
+	var inFlight, observedMax int32
+	started := make(chan struct{}, maxConcurrentPages)
+	release := make(chan struct{})
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				old := atomic.LoadInt32(&observedMax)
+				if n <= old || atomic.CompareAndSwapInt32(&observedMax, old, n) {
+					break
+				}
+			}
+			started <- struct{}{}
+			<-release
+			atomic.AddInt32(&inFlight, -1)
+			return &ssm.SendCommandOutput{
+				Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
+			}, nil
 		},
-		{
-			name:            "getCommand fail",
-			invocationError: errors.New("failed to get command invocation"),
-			expectedError:   "failed to retrieve command invocation output: failed to get command invocation",
-			invocationOut:   nil,
-			expectedOut:     nil,
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
 		},
-		{
-			name: "command status non-Success",
-			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("TimedOut"),
-				StandardOutputContent: nil,
-			},
-			expectedError: "command command-id has not reached success status, current status \"TimedOut\"",
-			expectedOut:   nil,
+	}
+	u := updater{ssm: mockSSM, versionPolicy: &VersionPolicy{}, maxConcurrentPages: maxConcurrentPages}
+
+	// Don't let any page's SendCommand return until maxConcurrentPages of
+	// them are blocked on it at once, proving the pool actually dispatches
+	// pages in parallel rather than happening to never queue.
+	go func() {
+		for i := 0; i < maxConcurrentPages; i++ {
+			<-started
+		}
+		close(release)
+	}()
+
+	_, err := u.filterAvailableUpdates(context.Background(), instances)
+	require.NoError(t, err)
+	assert.EqualValues(t, maxConcurrentPages, observedMax, "should dispatch exactly maxConcurrentPages pages at once, never more")
+}
+
+func TestPaginatedFilterAvailableUpdatesMergesOutOfOrderPages(t *testing.T) {
+	checkPattern := `{"update_state": "%s", "active_partition": { "image": { "version": "%s"}}}`
+	instances := make([]instance, 0)
+	expected := make([]instance, 0)
+	for i := 0; i < 150; i++ { // 3 pages of 50
+		containerID := "cont-inst-br" + strconv.Itoa(i)
+		ec2ID := "ec2-id-br" + strconv.Itoa(i)
+		instances = append(instances, instance{instanceID: ec2ID, containerInstanceID: containerID})
+		expected = append(expected, instance{instanceID: ec2ID, containerInstanceID: containerID, bottlerocketVersion: "v1.0.5"})
+	}
+
+	// Hold the first page's SendCommand back until the last page's has
+	// already been sent, so the pages complete in the reverse of their
+	// dispatch order.
+	holdFirstPage := make(chan struct{})
+	var lastPageSent int32
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			if input.InstanceIds[0] == instances[0].instanceID {
+				<-holdFirstPage
+			} else if input.InstanceIds[0] == instances[100].instanceID {
+				atomic.StoreInt32(&lastPageSent, 1)
+				close(holdFirstPage)
+			}
+			return &ssm.SendCommandOutput{
+				Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
+			}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable, "v1.0.5")),
+			}, nil
 		},
 	}
-	for _, tc := range cases {
-		t.Run(tc.name, func(t *testing.T) {
-			mockSSM := MockSSM{
-				GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-					return tc.invocationOut, tc.invocationError
-				},
+	u := updater{ssm: mockSSM, versionPolicy: &VersionPolicy{}, maxConcurrentPages: 3}
+
+	actual, err := u.filterAvailableUpdates(context.Background(), instances)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&lastPageSent), "the last page must have been sent before the first page was released")
+	assert.ElementsMatch(t, expected, actual, "should merge every page's results regardless of completion order")
+}
+
+// drainStream drains a filterAvailableUpdatesStream result/error pair until
+// both channels are closed, tolerating any interleaving of the two.
+func drainStream(resultChan <-chan instanceResult, errChan <-chan error) ([]instanceResult, []error) {
+	var results []instanceResult
+	var errs []error
+	for resultChan != nil || errChan != nil {
+		select {
+		case result, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
+				continue
 			}
-			u := updater{ssm: mockSSM}
-			actual, err := u.getCommandResult("command-id", "instance-id")
-			if tc.expectedOut != nil {
-				require.NoError(t, err)
-				assert.EqualValues(t, tc.expectedOut, actual)
-			} else {
-				require.Error(t, err)
-				assert.EqualError(t, err, tc.expectedError)
+			results = append(results, result)
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
 			}
-		})
+			errs = append(errs, err)
+		}
+	}
+	return results, errs
+}
+
+func TestFilterAvailableUpdatesStreamPublishesResultsAsTheyComplete(t *testing.T) {
+	checkPattern := `{"update_state": "%s", "active_partition": { "image": { "version": "%s"}}, "chosen_update": { "version": "%s"}}`
+	instances := []instance{
+		{instanceID: "inst-id-1", containerInstanceID: "cont-inst-1"},
+		{instanceID: "inst-id-2", containerInstanceID: "cont-inst-2"},
+		{instanceID: "inst-id-3", containerInstanceID: "cont-inst-3"},
+	}
+
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable, "v1.0.5", "v1.0.5")),
+			}, nil
+		},
+	}
+	u := updater{ssm: mockSSM, checkDocument: "check-document", versionPolicy: &VersionPolicy{}}
+
+	resultChan, errChan := u.filterAvailableUpdatesStream(context.Background(), instances)
+	results, errs := drainStream(resultChan, errChan)
+
+	assert.Empty(t, errs)
+	require.Len(t, results, len(instances))
+	var got []instance
+	for _, r := range results {
+		assert.Equal(t, "v1.0.5", r.version)
+		assert.Equal(t, updateStateAvailable, r.state)
+		got = append(got, r.instance)
+	}
+	expected := make([]instance, len(instances))
+	for i, inst := range instances {
+		inst.bottlerocketVersion = "v1.0.5"
+		inst.targetVersion = "v1.0.5"
+		expected[i] = inst
+	}
+	// Results arrive in whatever order their goroutines finish in, not
+	// necessarily the order the instances were given in.
+	assert.ElementsMatch(t, expected, got, "should publish a result for every instance regardless of completion order")
+}
+
+func TestFilterAvailableUpdatesStreamInstanceErrorDoesNotBlockOthers(t *testing.T) {
+	instances := []instance{
+		{instanceID: "inst-id-1", containerInstanceID: "cont-inst-1"},
+		{instanceID: "inst-id-2", containerInstanceID: "cont-inst-2"},
 	}
+	checkOutputJSON := `{"update_state": "Available", "active_partition": { "image": { "version": "v1.0.5"}}}`
+
+	// The first GetCommandInvocation call per instance is sendCommand's own
+	// waiter; only fail the one made afterwards, to fetch inst-id-1's result.
+	var m sync.Mutex
+	seenOnce := map[string]bool{}
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			instanceID := aws.ToString(input.InstanceId)
+			m.Lock()
+			isWaiterCall := !seenOnce[instanceID]
+			seenOnce[instanceID] = true
+			m.Unlock()
+			if isWaiterCall {
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
+			}
+			if instanceID == "inst-id-1" {
+				return nil, errors.New("throttled")
+			}
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	u := updater{ssm: mockSSM, checkDocument: "check-document", versionPolicy: &VersionPolicy{}}
+
+	resultChan, errChan := u.filterAvailableUpdatesStream(context.Background(), instances)
+	results, errs := drainStream(resultChan, errChan)
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "throttled")
+	require.Len(t, results, 1, "the failing instance must not prevent the other instance's result from being published")
+	assert.Equal(t, "inst-id-2", results[0].instance.instanceID)
+}
+
+func TestCheckCommandOutput(t *testing.T) {
+	checkOutputJSON := `{"update_state": "Available", "active_partition": { "image": { "version": "v1.0.5"}}}`
+
+	t.Run("succeeds on third attempt after throttling", func(t *testing.T) {
+		restore := sleep
+		sleep = func(time.Duration) {}
+		defer func() { sleep = restore }()
+
+		calls := 0
+		mockSSM := MockSSM{
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				calls++
+				if calls < 3 {
+					return nil, apiErr("ThrottlingException")
+				}
+				return &ssm.GetCommandInvocationOutput{
+					Status:                ssmtypes.CommandInvocationStatusSuccess,
+					StandardOutputContent: aws.String(checkOutputJSON),
+				}, nil
+			},
+		}
+		u := updater{ssm: mockSSM}
+		output, err := u.checkCommandOutput(context.Background(), "command-id", "instance-id")
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, updateStateAvailable, output.UpdateState)
+	})
+
+	t.Run("terminal failure status short-circuits without spending retry budget", func(t *testing.T) {
+		restore := sleep
+		sleep = func(time.Duration) {}
+		defer func() { sleep = restore }()
+
+		calls := 0
+		mockSSM := MockSSM{
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				calls++
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusFailed}, nil
+			},
+		}
+		u := updater{ssm: mockSSM}
+		_, err := u.checkCommandOutput(context.Background(), "command-id", "instance-id")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `has not reached success status, current status "Failed"`)
+		assert.Equal(t, 1, calls, "a terminal status must not be retried")
+	})
+
+	t.Run("terminal failure status surfaces stderr for manual diagnosis", func(t *testing.T) {
+		restore := sleep
+		sleep = func(time.Duration) {}
+		defer func() { sleep = restore }()
+
+		mockSSM := MockSSM{
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				return &ssm.GetCommandInvocationOutput{
+					Status:               ssmtypes.CommandInvocationStatusFailed,
+					StandardErrorContent: aws.String("update.sh: partition not found"),
+				}, nil
+			},
+		}
+		u := updater{ssm: mockSSM}
+		_, err := u.checkCommandOutput(context.Background(), "command-id", "instance-id")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `has not reached success status, current status "Failed"`)
+		assert.Contains(t, err.Error(), "stderr: update.sh: partition not found")
+	})
+
+	t.Run("non-retriable error short-circuits without spending retry budget", func(t *testing.T) {
+		restore := sleep
+		sleep = func(time.Duration) {}
+		defer func() { sleep = restore }()
+
+		calls := 0
+		wantErr := errors.New("not an aws error")
+		mockSSM := MockSSM{
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				calls++
+				return nil, wantErr
+			},
+		}
+		u := updater{ssm: mockSSM, retryPolicy: RetryPolicy{MaxAttempts: 5}}
+		_, err := u.checkCommandOutput(context.Background(), "command-id", "instance-id")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, wantErr)
+		assert.Equal(t, 1, calls, "a non-retriable error must not be retried")
+	})
+
+	t.Run("exhausts retry budget on a non-terminal status", func(t *testing.T) {
+		restore := sleep
+		sleep = func(time.Duration) {}
+		defer func() { sleep = restore }()
+
+		calls := 0
+		mockSSM := MockSSM{
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				calls++
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress}, nil
+			},
+		}
+		u := updater{ssm: mockSSM, retryPolicy: RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxAttempts: 3}}
+		_, err := u.checkCommandOutput(context.Background(), "command-id", "instance-id")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "gave up after 3 attempts")
+		assert.Equal(t, 3, calls)
+	})
 }
 
 func TestSendCommandSuccess(t *testing.T) {
 	instances := []string{"inst-id-1", "inst-id-2"}
-	// mutex needed to prevent race condition when appending to instances slice in concurrent
-	// execution of WaitUntilCommandExecutedWithContextFn
 	var m sync.Mutex
 	waitInstanceIDs := []string{}
 	mockSSM := MockSSM{
-		SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-			assert.Equal(t, "test-doc", aws.StringValue(input.DocumentName))
-			assert.Equal(t, "$DEFAULT", aws.StringValue(input.DocumentVersion))
-			assert.Equal(t, aws.StringSlice(instances), input.InstanceIds)
-			return &ssm.SendCommandOutput{Command: &ssm.Command{CommandId: aws.String("command-id")}}, nil
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			assert.Equal(t, "test-doc", aws.ToString(input.DocumentName))
+			assert.Equal(t, "$DEFAULT", aws.ToString(input.DocumentVersion))
+			assert.Equal(t, instances, input.InstanceIds)
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
 		},
-		WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-			assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			assert.Equal(t, "command-id", aws.ToString(input.CommandId))
 			m.Lock()
-			waitInstanceIDs = append(waitInstanceIDs, aws.StringValue(input.InstanceId))
+			waitInstanceIDs = append(waitInstanceIDs, aws.ToString(input.InstanceId))
 			m.Unlock()
-			return nil
+			return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
 		},
 	}
 	u := updater{ssm: mockSSM}
-	commandID, err := u.sendCommand(instances, "test-doc")
+	commandID, err := u.sendCommand(context.Background(), instances, "test-doc")
 	require.NoError(t, err)
 	assert.EqualValues(t, "command-id", commandID)
 	assert.ElementsMatch(t, instances, waitInstanceIDs)
@@ -410,19 +649,18 @@ func TestSendCommandErr(t *testing.T) {
 	instances := []string{"inst-id-1", "inst-id-2"}
 	sendError := errors.New("failed to send command")
 	mockSSM := MockSSM{
-		SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-			assert.Equal(t, "test-doc", aws.StringValue(input.DocumentName))
-			assert.Equal(t, "$DEFAULT", aws.StringValue(input.DocumentVersion))
-			assert.Equal(t, aws.StringSlice(instances), input.InstanceIds)
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			assert.Equal(t, "test-doc", aws.ToString(input.DocumentName))
+			assert.Equal(t, "$DEFAULT", aws.ToString(input.DocumentVersion))
+			assert.Equal(t, instances, input.InstanceIds)
 			return nil, sendError
 		},
 	}
 	u := updater{ssm: mockSSM}
-	commandID, err := u.sendCommand(instances, "test-doc")
+	commandID, err := u.sendCommand(context.Background(), instances, "test-doc")
 	require.Error(t, err)
 	assert.Equal(t, "", commandID)
 	assert.ErrorIs(t, err, sendError)
-
 }
 
 func TestSendCommandWaitErr(t *testing.T) {
@@ -441,92 +679,78 @@ func TestSendCommandWaitErr(t *testing.T) {
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			waitError := errors.New("exceeded max attempts")
-			failedInstanceIDs := []string{}
+			policy, restore := tinyWaiterPolicy(t)
+			defer restore()
+
 			mockSSM := MockSSM{
-				SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-					assert.Equal(t, "test-doc", aws.StringValue(input.DocumentName))
-					assert.Equal(t, aws.StringSlice(tc.instances), input.InstanceIds)
+				SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+					assert.Equal(t, "test-doc", aws.ToString(input.DocumentName))
+					assert.Equal(t, tc.instances, input.InstanceIds)
 					return &ssm.SendCommandOutput{
-						Command: &ssm.Command{CommandId: aws.String("command-id")},
+						Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
 					}, nil
 				},
-				WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					return waitError
-				},
-				GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					failedInstanceIDs = append(failedInstanceIDs, aws.StringValue(input.InstanceId))
-					return &ssm.GetCommandInvocationOutput{}, nil
+				GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+					assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+					return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress}, nil
 				},
 			}
-			u := updater{ssm: mockSSM}
-			commandID, err := u.sendCommand(tc.instances, "test-doc")
-			require.Error(t, err)
-			assert.ErrorIs(t, err, waitError)
+			u := updater{ssm: mockSSM, backoffPolicy: policy}
+			commandID, err := u.sendCommand(context.Background(), tc.instances, "test-doc")
+			assertWaitTimeoutErr(t, err)
 			assert.Equal(t, "", commandID)
-			assert.ElementsMatch(t, tc.instances, failedInstanceIDs, "should match instances for which wait fails")
 		})
 	}
 }
 
 func TestSendCommandWaitSuccess(t *testing.T) {
-	mockSendCommand := func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-		assert.Equal(t, "test-doc", aws.StringValue(input.DocumentName))
+	mockSendCommand := func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+		assert.Equal(t, "test-doc", aws.ToString(input.DocumentName))
 		return &ssm.SendCommandOutput{
-			Command: &ssm.Command{CommandId: aws.String("command-id")},
+			Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
 		}, nil
 	}
 	t.Run("wait one success", func(t *testing.T) {
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
 		// commandSuccessInstance indicates an instance for which the command should succeed
 		const commandSuccessInstance = "inst-success"
 		instances := []string{"inst-id-1", "inst-id-2", commandSuccessInstance}
-		expectedFailInstances := []string{"inst-id-1", "inst-id-2"}
-		failedInstanceIDs := []string{}
 		mockSSM := MockSSM{
 			SendCommandFn: mockSendCommand,
-			WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-				if aws.StringValue(input.InstanceId) == commandSuccessInstance {
-					return nil
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				if aws.ToString(input.InstanceId) == commandSuccessInstance {
+					return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
 				}
-				return errors.New("exceeded max attempts")
-			},
-			GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				failedInstanceIDs = append(failedInstanceIDs, aws.StringValue(input.InstanceId))
-				return &ssm.GetCommandInvocationOutput{}, nil
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress}, nil
 			},
 		}
-		u := updater{ssm: mockSSM}
-		commandID, err := u.sendCommand(instances, "test-doc")
-		require.NoError(t, err)
+		u := updater{ssm: mockSSM, backoffPolicy: policy}
+		commandID, err := u.sendCommand(context.Background(), instances, "test-doc")
+		require.NoError(t, err, "command should still succeed since not every instance timed out")
 		assert.Equal(t, "command-id", commandID)
-		assert.ElementsMatch(t, expectedFailInstances, failedInstanceIDs, "should match instances for which wait fails")
 	})
 	t.Run("wait all success", func(t *testing.T) {
 		instances := []string{"inst-id-1", "inst-id-2"}
-		// mutex needed to prevent race condition when appending to instances slice in concurrent
-		// execution of WaitUntilCommandExecutedWithContextFn
 		var m sync.Mutex
 		waitInstanceIDs := []string{}
 		mockSSM := MockSSM{
 			SendCommandFn: mockSendCommand,
-			WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				assert.Equal(t, "command-id", aws.ToString(input.CommandId))
 				m.Lock()
-				waitInstanceIDs = append(waitInstanceIDs, aws.StringValue(input.InstanceId))
+				waitInstanceIDs = append(waitInstanceIDs, aws.ToString(input.InstanceId))
 				m.Unlock()
-				return nil
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
 			},
 		}
 		u := updater{ssm: mockSSM}
-		commandID, err := u.sendCommand(instances, "test-doc")
+		commandID, err := u.sendCommand(context.Background(), instances, "test-doc")
 		require.NoError(t, err)
 		assert.Equal(t, "command-id", commandID)
 		assert.ElementsMatch(t, instances, waitInstanceIDs, "should match instances for which wait succeeds")
 	})
-
 }
 
 func TestListContainerInstances(t *testing.T) {
@@ -536,50 +760,32 @@ func TestListContainerInstances(t *testing.T) {
 		listOutput2   *ecs.ListContainerInstancesOutput
 		listError     error
 		expectedError string
-		expectedOut   []*string
+		expectedOut   []string
 	}{
 		{
 			name: "with instances",
 			listOutput: &ecs.ListContainerInstancesOutput{
-				ContainerInstanceArns: []*string{
-					aws.String("cont-inst-arn1"),
-					aws.String("cont-inst-arn2"),
-					aws.String("cont-inst-arn3")},
-				NextToken: aws.String("token"),
+				ContainerInstanceArns: []string{"cont-inst-arn1", "cont-inst-arn2", "cont-inst-arn3"},
+				NextToken:             aws.String("token"),
 			},
 			listOutput2: &ecs.ListContainerInstancesOutput{
-				ContainerInstanceArns: []*string{
-					aws.String("cont-inst-arn4"),
-					aws.String("cont-inst-arn5"),
-					aws.String("cont-inst-arn6")},
-				NextToken: nil,
-			},
-			expectedOut: []*string{
-				aws.String("cont-inst-arn1"),
-				aws.String("cont-inst-arn2"),
-				aws.String("cont-inst-arn3"),
-				aws.String("cont-inst-arn4"),
-				aws.String("cont-inst-arn5"),
-				aws.String("cont-inst-arn6")},
+				ContainerInstanceArns: []string{"cont-inst-arn4", "cont-inst-arn5", "cont-inst-arn6"},
+				NextToken:             nil,
+			},
+			expectedOut: []string{"cont-inst-arn1", "cont-inst-arn2", "cont-inst-arn3", "cont-inst-arn4", "cont-inst-arn5", "cont-inst-arn6"},
 		},
 		{
 			name: "without instances",
 			listOutput: &ecs.ListContainerInstancesOutput{
-				ContainerInstanceArns: []*string{},
-			},
-			listOutput2: &ecs.ListContainerInstancesOutput{
-				ContainerInstanceArns: []*string{},
+				ContainerInstanceArns: []string{},
 			},
-			expectedOut: []*string{},
+			expectedOut: []string{},
 		},
 		{
 			name:      "list fail",
 			listError: errors.New("failed to list instances"),
 			listOutput: &ecs.ListContainerInstancesOutput{
-				ContainerInstanceArns: []*string{},
-			},
-			listOutput2: &ecs.ListContainerInstancesOutput{
-				ContainerInstanceArns: []*string{},
+				ContainerInstanceArns: []string{},
 			},
 			expectedError: "failed to list container instances",
 		},
@@ -587,21 +793,32 @@ func TestListContainerInstances(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
+			pages := []*ecs.ListContainerInstancesOutput{tc.listOutput}
+			if tc.listOutput2 != nil {
+				pages = append(pages, tc.listOutput2)
+			}
+			callCount := 0
 			mockECS := MockECS{
-				ListContainerInstancesPagesFn: func(input *ecs.ListContainerInstancesInput, fn func(*ecs.ListContainerInstancesOutput, bool) bool) error {
-					assert.Equal(t, ecs.ContainerInstanceStatusActive, aws.StringValue(input.Status))
-					fn(tc.listOutput, true)
-					fn(tc.listOutput2, false)
-					return tc.listError
+				ListContainerInstancesFn: func(ctx context.Context, input *ecs.ListContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+					assert.Equal(t, types.ContainerInstanceStatusActive, input.Status)
+					if tc.listError != nil {
+						return nil, tc.listError
+					}
+					require.Less(t, callCount, len(pages))
+					page := pages[callCount]
+					callCount++
+					return page, nil
 				},
 			}
 			u := updater{ecs: mockECS}
-			actual, err := u.listContainerInstances()
-			if tc.expectedOut != nil {
+			actual, err := u.listContainerInstances(context.Background())
+			if tc.expectedError == "" {
+				require.NoError(t, err)
 				assert.EqualValues(t, tc.expectedOut, actual)
-				assert.NoError(t, err)
+				assert.Equal(t, len(pages), callCount, "should follow NextToken until exhausted")
 			} else {
 				assert.Empty(t, actual)
+				require.Error(t, err)
 				assert.ErrorIs(t, err, tc.listError)
 				assert.Contains(t, err.Error(), tc.expectedError)
 			}
@@ -611,14 +828,14 @@ func TestListContainerInstances(t *testing.T) {
 
 func TestFilterBottlerocketInstances(t *testing.T) {
 	output := &ecs.DescribeContainerInstancesOutput{
-		ContainerInstances: []*ecs.ContainerInstance{{
+		ContainerInstances: []types.ContainerInstance{{
 			// Bottlerocket with single attribute
-			Attributes:           []*ecs.Attribute{{Name: aws.String("bottlerocket.variant")}},
+			Attributes:           []types.Attribute{{Name: aws.String("bottlerocket.variant")}},
 			ContainerInstanceArn: aws.String("cont-inst-br1"),
 			Ec2InstanceId:        aws.String("ec2-id-br1"),
 		}, {
 			// Bottlerocket with extra attribute
-			Attributes: []*ecs.Attribute{
+			Attributes: []types.Attribute{
 				{Name: aws.String("different-attribute")},
 				{Name: aws.String("bottlerocket.variant")},
 			},
@@ -626,7 +843,7 @@ func TestFilterBottlerocketInstances(t *testing.T) {
 			Ec2InstanceId:        aws.String("ec2-id-br2"),
 		}, {
 			// Not Bottlerocket, single attribute
-			Attributes: []*ecs.Attribute{
+			Attributes: []types.Attribute{
 				{Name: aws.String("different-attribute")},
 			},
 			ContainerInstanceArn: aws.String("cont-inst-not1"),
@@ -635,60 +852,55 @@ func TestFilterBottlerocketInstances(t *testing.T) {
 			// Not Bottlerocket, no attribute
 			ContainerInstanceArn: aws.String("cont-inst-not2"),
 			Ec2InstanceId:        aws.String("ec2-id-not2"),
+		}, {
+			// Bottlerocket with an update-policy opt-out attribute
+			Attributes: []types.Attribute{
+				{Name: aws.String("bottlerocket.variant")},
+				{Name: aws.String("bottlerocket.updater/policy"), Value: aws.String("disabled")},
+			},
+			ContainerInstanceArn: aws.String("cont-inst-br3"),
+			Ec2InstanceId:        aws.String("ec2-id-br3"),
 		}},
 	}
 	expected := []instance{
-		{
-			instanceID:          "ec2-id-br1",
-			containerInstanceID: "cont-inst-br1",
-		},
-		{
-			instanceID:          "ec2-id-br2",
-			containerInstanceID: "cont-inst-br2",
-		},
+		{instanceID: "ec2-id-br1", containerInstanceID: "cont-inst-br1", tags: map[string]string{"bottlerocket.variant": ""}},
+		{instanceID: "ec2-id-br2", containerInstanceID: "cont-inst-br2", tags: map[string]string{"bottlerocket.variant": "", "different-attribute": ""}},
+		{instanceID: "ec2-id-br3", containerInstanceID: "cont-inst-br3", updatePolicy: "disabled", tags: map[string]string{"bottlerocket.variant": "", "bottlerocket.updater/policy": "disabled"}},
 	}
 
 	mockECS := MockECS{
-		DescribeContainerInstancesFn: func(_ *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
 			return output, nil
 		},
 	}
 	u := updater{ecs: mockECS}
 
-	actual, err := u.filterBottlerocketInstances([]*string{
-		aws.String("ec2-id-br1"),
-		aws.String("ec2-id-br2"),
-		aws.String("ec2-id-not1"),
-		aws.String("ec2-id-not2"),
+	actual, err := u.filterBottlerocketInstances(context.Background(), []string{
+		"ec2-id-br1", "ec2-id-br2", "ec2-id-not1", "ec2-id-not2", "ec2-id-br3",
 	})
 	require.NoError(t, err)
 	assert.EqualValues(t, expected, actual)
 }
 
 func TestPaginatedFilterBottlerocketInstancesAllFail(t *testing.T) {
-	instances := make([]*string, 0)
+	instances := make([]string, 0)
 	for i := 0; i < 150; i++ {
-		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, aws.String(ec2ID))
+		instances = append(instances, "ec2-id-br"+strconv.Itoa(i))
 	}
 
 	responses := []struct {
 		inputLen           int
-		ContainerInstances []*ecs.ContainerInstance
+		ContainerInstances []types.ContainerInstance
 		err                error
 	}{{
-		100,
-		nil,
-		errors.New("Failed to describe container instances"),
+		100, nil, errors.New("Failed to describe container instances"),
 	}, {
-		50,
-		nil,
-		errors.New("Failed to describe container instances"),
+		50, nil, errors.New("Failed to describe container instances"),
 	}}
 
 	callCount := 0
 	mockECS := MockECS{
-		DescribeContainerInstancesFn: func(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
 			require.Less(t, callCount, len(responses))
 			resp := responses[callCount]
 			callCount++
@@ -698,48 +910,41 @@ func TestPaginatedFilterBottlerocketInstancesAllFail(t *testing.T) {
 	}
 
 	u := updater{ecs: mockECS}
-	actual, err := u.filterBottlerocketInstances(instances)
+	actual, err := u.filterBottlerocketInstances(context.Background(), instances)
 	require.Error(t, err)
 	assert.Empty(t, actual)
 	assert.Contains(t, err.Error(), "Failed to describe container instances")
 }
 
 func TestPaginatedFilterBottlerocketInstancesSingleFailure(t *testing.T) {
-	descOut := make([]*ecs.ContainerInstance, 0)
-	instances := make([]*string, 0)
+	descOut := make([]types.ContainerInstance, 0)
+	instances := make([]string, 0)
 	expected := make([]instance, 0)
 	for i := 0; i < 150; i++ {
 		instanceARN := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, aws.String(ec2ID))
-		descOut = append(descOut, &ecs.ContainerInstance{
-			Attributes:           []*ecs.Attribute{{Name: aws.String("bottlerocket.variant")}},
+		instances = append(instances, ec2ID)
+		descOut = append(descOut, types.ContainerInstance{
+			Attributes:           []types.Attribute{{Name: aws.String("bottlerocket.variant")}},
 			ContainerInstanceArn: aws.String(instanceARN),
 			Ec2InstanceId:        aws.String(ec2ID),
 		})
-		expected = append(expected, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: instanceARN,
-		})
+		expected = append(expected, instance{instanceID: ec2ID, containerInstanceID: instanceARN, tags: map[string]string{"bottlerocket.variant": ""}})
 	}
 
 	responses := []struct {
 		inputLen           int
-		ContainerInstances []*ecs.ContainerInstance
+		ContainerInstances []types.ContainerInstance
 		err                error
 	}{{
-		100,
-		nil,
-		errors.New("Failed to describe container instances"),
+		100, nil, errors.New("Failed to describe container instances"),
 	}, {
-		50,
-		descOut[100:],
-		nil,
+		50, descOut[100:], nil,
 	}}
 
 	callCount := 0
 	mockECS := MockECS{
-		DescribeContainerInstancesFn: func(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
 			require.Less(t, callCount, len(responses))
 			resp := responses[callCount]
 			callCount++
@@ -749,20 +954,20 @@ func TestPaginatedFilterBottlerocketInstancesSingleFailure(t *testing.T) {
 	}
 
 	u := updater{ecs: mockECS}
-	actual, err := u.filterBottlerocketInstances(instances)
+	actual, err := u.filterBottlerocketInstances(context.Background(), instances)
 	require.NoError(t, err)
-	assert.EqualValues(t, expected[100:], actual, "should contain only the last 50 instnaces")
+	assert.EqualValues(t, expected[100:], actual, "should contain only the last 50 instances")
 }
 
 func TestPaginatedFilterBottlerocketInstancesNoBR(t *testing.T) {
-	descOut := make([]*ecs.ContainerInstance, 0)
-	instances := make([]*string, 0)
+	descOut := make([]types.ContainerInstance, 0)
+	instances := make([]string, 0)
 	for i := 0; i < 150; i++ {
 		instanceARN := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, aws.String(ec2ID))
-		descOut = append(descOut, &ecs.ContainerInstance{
-			Attributes:           []*ecs.Attribute{{Name: aws.String("nottlerocket.variant")}},
+		instances = append(instances, ec2ID)
+		descOut = append(descOut, types.ContainerInstance{
+			Attributes:           []types.Attribute{{Name: aws.String("nottlerocket.variant")}},
 			ContainerInstanceArn: aws.String(instanceARN),
 			Ec2InstanceId:        aws.String(ec2ID),
 		})
@@ -770,21 +975,17 @@ func TestPaginatedFilterBottlerocketInstancesNoBR(t *testing.T) {
 
 	responses := []struct {
 		inputLen           int
-		ContainerInstances []*ecs.ContainerInstance
+		ContainerInstances []types.ContainerInstance
 		err                error
 	}{{
-		100,
-		descOut[:100],
-		nil,
+		100, descOut[:100], nil,
 	}, {
-		50,
-		descOut[100:],
-		nil,
+		50, descOut[100:], nil,
 	}}
 
 	callCount := 0
 	mockECS := MockECS{
-		DescribeContainerInstancesFn: func(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
 			require.Less(t, callCount, len(responses))
 			resp := responses[callCount]
 			callCount++
@@ -794,47 +995,40 @@ func TestPaginatedFilterBottlerocketInstancesNoBR(t *testing.T) {
 	}
 
 	u := updater{ecs: mockECS}
-	actual, err := u.filterBottlerocketInstances(instances)
+	actual, err := u.filterBottlerocketInstances(context.Background(), instances)
 	require.NoError(t, err)
 	assert.Empty(t, actual)
 }
 
 func TestPaginatedFilterBottlerocketInstancesAllBRInstances(t *testing.T) {
-	descOut := make([]*ecs.ContainerInstance, 0)
-	instances := make([]*string, 0)
+	descOut := make([]types.ContainerInstance, 0)
+	instances := make([]string, 0)
 	expected := make([]instance, 0)
 	for i := 0; i < 150; i++ {
 		instanceARN := "cont-inst-br" + strconv.Itoa(i)
 		ec2ID := "ec2-id-br" + strconv.Itoa(i)
-		instances = append(instances, aws.String(ec2ID))
-		descOut = append(descOut, &ecs.ContainerInstance{
-			Attributes:           []*ecs.Attribute{{Name: aws.String("bottlerocket.variant")}},
+		instances = append(instances, ec2ID)
+		descOut = append(descOut, types.ContainerInstance{
+			Attributes:           []types.Attribute{{Name: aws.String("bottlerocket.variant")}},
 			ContainerInstanceArn: aws.String(instanceARN),
 			Ec2InstanceId:        aws.String(ec2ID),
 		})
-		expected = append(expected, instance{
-			instanceID:          ec2ID,
-			containerInstanceID: instanceARN,
-		})
+		expected = append(expected, instance{instanceID: ec2ID, containerInstanceID: instanceARN, tags: map[string]string{"bottlerocket.variant": ""}})
 	}
 
 	responses := []struct {
 		inputLen           int
-		ContainerInstances []*ecs.ContainerInstance
+		ContainerInstances []types.ContainerInstance
 		err                error
 	}{{
-		100,
-		descOut[:100],
-		nil,
+		100, descOut[:100], nil,
 	}, {
-		50,
-		descOut[100:],
-		nil,
+		50, descOut[100:], nil,
 	}}
 
 	callCount := 0
 	mockECS := MockECS{
-		DescribeContainerInstancesFn: func(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
 			require.Less(t, callCount, len(responses))
 			resp := responses[callCount]
 			callCount++
@@ -844,7 +1038,7 @@ func TestPaginatedFilterBottlerocketInstancesAllBRInstances(t *testing.T) {
 	}
 
 	u := updater{ecs: mockECS}
-	actual, err := u.filterBottlerocketInstances(instances)
+	actual, err := u.filterBottlerocketInstances(context.Background(), instances)
 	require.NoError(t, err)
 	assert.EqualValues(t, expected, actual, "should contain all the instances")
 }
@@ -859,34 +1053,28 @@ func TestEligible(t *testing.T) {
 		{
 			name: "only service tasks",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{
-					aws.String("task-arn-1"),
-				},
+				TaskArns: []string{"task-arn-1"},
 			},
 			describeOut: &ecs.DescribeTasksOutput{
-				Tasks: []*ecs.Task{
-					{
-						// contains proper prefix "ecs-svc" for task started by service
-						StartedBy: aws.String("ecs-svc/svc-id"),
-					},
-				},
+				Tasks: []types.Task{{
+					// contains proper prefix "ecs-svc" for task started by service
+					StartedBy: aws.String("ecs-svc/svc-id"),
+				}},
 			},
 			expectedOk: true,
 		}, {
 			name: "no task",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{},
+				TaskArns: []string{},
 			},
 			expectedOk: true,
 		}, {
 			name: "non service task",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{
-					aws.String("task-arn-1"),
-				},
+				TaskArns: []string{"task-arn-1"},
 			},
 			describeOut: &ecs.DescribeTasksOutput{
-				Tasks: []*ecs.Task{{
+				Tasks: []types.Task{{
 					// Does not contain prefix "ecs-svc"
 					StartedBy: aws.String("standalone-task-id"),
 				}},
@@ -895,24 +1083,19 @@ func TestEligible(t *testing.T) {
 		}, {
 			name: "non service task empty StartedBy",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{
-					aws.String("task-arn-1"),
-				},
+				TaskArns: []string{"task-arn-1"},
 			},
 			describeOut: &ecs.DescribeTasksOutput{
-				Tasks: []*ecs.Task{{}},
+				Tasks: []types.Task{{}},
 			},
 			expectedOk: false,
 		}, {
 			name: "service and non service tasks",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{
-					aws.String("task-arn-1"),
-					aws.String("task-arn-2"),
-				},
+				TaskArns: []string{"task-arn-1", "task-arn-2"},
 			},
 			describeOut: &ecs.DescribeTasksOutput{
-				Tasks: []*ecs.Task{{
+				Tasks: []types.Task{{
 					// Does not contain prefix "ecs-svc"
 					StartedBy: aws.String("standalone-task-id"),
 				}, {
@@ -926,19 +1109,19 @@ func TestEligible(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockECS := MockECS{
-				ListTasksFn: func(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
-					assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-					assert.Equal(t, "cont-inst-id", aws.StringValue(input.ContainerInstance))
+				ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+					assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+					assert.Equal(t, "cont-inst-id", aws.ToString(input.ContainerInstance))
 					return tc.listOut, nil
 				},
-				DescribeTasksFn: func(input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
-					assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
+				DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+					assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
 					assert.Equal(t, tc.listOut.TaskArns, input.Tasks)
 					return tc.describeOut, nil
 				},
 			}
 			u := updater{ecs: mockECS, cluster: "test-cluster"}
-			ok, err := u.eligible("cont-inst-id")
+			ok, err := u.eligible(context.Background(), "cont-inst-id")
 			require.NoError(t, err)
 			assert.Equal(t, ok, tc.expectedOk)
 		})
@@ -949,14 +1132,14 @@ func TestEligibleErr(t *testing.T) {
 	t.Run("list task err", func(t *testing.T) {
 		listErr := errors.New("failed to list tasks")
 		mockECS := MockECS{
-			ListTasksFn: func(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, "cont-inst-id", aws.StringValue(input.ContainerInstance))
+			ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				assert.Equal(t, "cont-inst-id", aws.ToString(input.ContainerInstance))
 				return nil, listErr
 			},
 		}
 		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		ok, err := u.eligible("cont-inst-id")
+		ok, err := u.eligible(context.Background(), "cont-inst-id")
 		require.Error(t, err)
 		assert.ErrorIs(t, err, listErr)
 		assert.False(t, ok)
@@ -965,25 +1148,19 @@ func TestEligibleErr(t *testing.T) {
 	t.Run("describe task err", func(t *testing.T) {
 		describeErr := errors.New("failed to describe tasks")
 		mockECS := MockECS{
-			ListTasksFn: func(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, "cont-inst-id", aws.StringValue(input.ContainerInstance))
-				return &ecs.ListTasksOutput{
-					TaskArns: []*string{
-						aws.String("task-arn-1"),
-					},
-				}, nil
+			ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				assert.Equal(t, "cont-inst-id", aws.ToString(input.ContainerInstance))
+				return &ecs.ListTasksOutput{TaskArns: []string{"task-arn-1"}}, nil
 			},
-			DescribeTasksFn: func(input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, []*string{
-					aws.String("task-arn-1"),
-				}, input.Tasks)
+			DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				assert.Equal(t, []string{"task-arn-1"}, input.Tasks)
 				return nil, describeErr
 			},
 		}
 		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		ok, err := u.eligible("cont-inst-id")
+		ok, err := u.eligible(context.Background(), "cont-inst-id")
 		require.Error(t, err)
 		assert.ErrorIs(t, err, describeErr)
 		assert.False(t, ok)
@@ -992,148 +1169,291 @@ func TestEligibleErr(t *testing.T) {
 
 func TestDrainInstance(t *testing.T) {
 	stateChangeCalls := []string{}
-	mockStateChange := func(input *ecs.UpdateContainerInstancesStateInput) (*ecs.UpdateContainerInstancesStateOutput, error) {
-		stateChangeCalls = append(stateChangeCalls, aws.StringValue(input.Status))
-		assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-		assert.Equal(t, []*string{aws.String("cont-inst-id")}, input.ContainerInstances)
-		return &ecs.UpdateContainerInstancesStateOutput{
-			Failures: []*ecs.Failure{},
-		}, nil
+	mockStateChange := func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+		stateChangeCalls = append(stateChangeCalls, string(input.Status))
+		assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+		assert.Equal(t, []string{"cont-inst-id"}, input.ContainerInstances)
+		return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
 	}
-	mockListTasks := func(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
-		assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-		assert.Equal(t, "cont-inst-id", aws.StringValue(input.ContainerInstance))
-		return &ecs.ListTasksOutput{
-			TaskArns: []*string{
-				aws.String("task-arn-1"),
-			},
-		}, nil
+	mockListTasks := func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+		assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+		assert.Equal(t, "cont-inst-id", aws.ToString(input.ContainerInstance))
+		return &ecs.ListTasksOutput{TaskArns: []string{"task-arn-1"}}, nil
 	}
 	cleanup := func() {
 		stateChangeCalls = []string{}
 	}
 
+	emptyListTasks := func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+		assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+		assert.Equal(t, "cont-inst-id", aws.ToString(input.ContainerInstance))
+		return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+	}
+
 	t.Run("no tasks success", func(t *testing.T) {
 		defer cleanup()
 		listTaskCount := 0
 		mockECS := MockECS{
 			UpdateContainerInstancesStateFn: mockStateChange,
-			ListTasksFn: func(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, "cont-inst-id", aws.StringValue(input.ContainerInstance))
+			ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
 				listTaskCount++
-				return &ecs.ListTasksOutput{
-					TaskArns: []*string{},
-				}, nil
+				return emptyListTasks(ctx, input, optFns...)
 			},
 		}
-		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		err := u.drainInstance("cont-inst-id")
+		metricsRecorder := &recordingMetricsPublisher{}
+		u := updater{ecs: mockECS, cluster: "test-cluster", metrics: metricsRecorder}
+		services, err := u.drainInstance(context.Background(), "cont-inst-id")
 		require.NoError(t, err)
-		assert.Equal(t, 1, listTaskCount)
+		assert.Empty(t, services)
+		// Called once to snapshot services on the instance before draining, and
+		// once more by waitUntilDrained once it's in DRAINING state.
+		assert.Equal(t, 2, listTaskCount)
 		assert.Equal(t, []string{"DRAINING"}, stateChangeCalls)
+
+		require.Len(t, metricsRecorder.metrics, 1)
+		assert.Equal(t, metricDrainDurationSeconds, metricsRecorder.metrics[0].Name)
 	})
 
 	t.Run("with tasks success", func(t *testing.T) {
 		defer cleanup()
-		waitCount := 0
+		describeCount := 0
 		mockECS := MockECS{
 			UpdateContainerInstancesStateFn: mockStateChange,
 			ListTasksFn:                     mockListTasks,
-			WaitUntilTasksStoppedWithContextFn: func(_ aws.Context, input *ecs.DescribeTasksInput, _ ...request.WaiterOption) error {
-				assert.Equal(t, []*string{
-					aws.String("task-arn-1"),
-				}, input.Tasks)
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				waitCount++
-				return nil
+			DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+				assert.Equal(t, []string{"task-arn-1"}, input.Tasks)
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				describeCount++
+				return &ecs.DescribeTasksOutput{Tasks: []types.Task{{LastStatus: aws.String("STOPPED"), Group: aws.String("service:my-service")}}}, nil
 			},
 		}
 		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		err := u.drainInstance("cont-inst-id")
+		services, err := u.drainInstance(context.Background(), "cont-inst-id")
 		require.NoError(t, err)
+		assert.Equal(t, []string{"my-service"}, services)
 		assert.Equal(t, []string{"DRAINING"}, stateChangeCalls)
-		assert.Equal(t, 1, waitCount)
+		// Once to snapshot services, once more by the TasksStoppedWaiter.
+		assert.Equal(t, 2, describeCount)
 	})
 
 	t.Run("state change err", func(t *testing.T) {
 		defer cleanup()
 		stateOutErr := errors.New("failed to change state")
 		mockECS := MockECS{
-			UpdateContainerInstancesStateFn: func(input *ecs.UpdateContainerInstancesStateInput) (*ecs.UpdateContainerInstancesStateOutput, error) {
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, []*string{aws.String("cont-inst-id")}, input.ContainerInstances)
+			ListTasksFn: emptyListTasks,
+			UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				assert.Equal(t, []string{"cont-inst-id"}, input.ContainerInstances)
 				return nil, stateOutErr
 			},
 		}
-		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		err := u.drainInstance("cont-inst-id")
+		metricsRecorder := &recordingMetricsPublisher{}
+		u := updater{ecs: mockECS, cluster: "test-cluster", metrics: metricsRecorder}
+		services, err := u.drainInstance(context.Background(), "cont-inst-id")
 		require.Error(t, err)
 		assert.ErrorIs(t, err, stateOutErr)
+		assert.Empty(t, services)
+
+		require.Len(t, metricsRecorder.metrics, 1, "expected DrainDurationSeconds to be published even on failure")
+		assert.Equal(t, metricDrainDurationSeconds, metricsRecorder.metrics[0].Name)
 	})
 
 	t.Run("state change api err", func(t *testing.T) {
 		defer cleanup()
 		stateOutAPIFailure := &ecs.UpdateContainerInstancesStateOutput{
-			Failures: []*ecs.Failure{
-				{
-					Reason: aws.String("failed"),
-				},
-			},
+			Failures: []types.Failure{{Reason: aws.String("failed")}},
 		}
 		mockECS := MockECS{
-			UpdateContainerInstancesStateFn: func(input *ecs.UpdateContainerInstancesStateInput) (*ecs.UpdateContainerInstancesStateOutput, error) {
-				stateChangeCalls = append(stateChangeCalls, aws.StringValue(input.Status))
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, []*string{aws.String("cont-inst-id")}, input.ContainerInstances)
+			ListTasksFn: emptyListTasks,
+			UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+				stateChangeCalls = append(stateChangeCalls, string(input.Status))
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				assert.Equal(t, []string{"cont-inst-id"}, input.ContainerInstances)
 				return stateOutAPIFailure, nil
 			},
 		}
 		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		err := u.drainInstance("cont-inst-id")
+		_, err := u.drainInstance(context.Background(), "cont-inst-id")
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), fmt.Sprintf("%v", stateOutAPIFailure.Failures))
 		assert.Equal(t, []string{"DRAINING", "ACTIVE"}, stateChangeCalls)
 	})
 
+	t.Run("state change api err then reactivation also fails", func(t *testing.T) {
+		defer cleanup()
+		stateOutAPIFailure := &ecs.UpdateContainerInstancesStateOutput{
+			Failures: []types.Failure{{Reason: aws.String("failed")}},
+		}
+		reactivateErr := errors.New("failed to re-activate")
+		mockECS := MockECS{
+			ListTasksFn: emptyListTasks,
+			UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+				stateChangeCalls = append(stateChangeCalls, string(input.Status))
+				if input.Status == types.ContainerInstanceStatusActive {
+					return nil, reactivateErr
+				}
+				return stateOutAPIFailure, nil
+			},
+		}
+		recorder := &recordingEventPublisher{}
+		u := updater{ecs: mockECS, cluster: "test-cluster", events: recorder}
+		_, err := u.drainInstance(context.Background(), "cont-inst-id")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fmt.Sprintf("%v", stateOutAPIFailure.Failures))
+
+		require.Len(t, recorder.events, 1)
+		assert.Equal(t, eventInstanceReactivationFailed, recorder.events[0].Status)
+		assert.Equal(t, "cont-inst-id", recorder.events[0].ContainerInstanceID)
+		assert.Contains(t, recorder.events[0].ErrorMessage, reactivateErr.Error())
+	})
+
 	t.Run("list task err", func(t *testing.T) {
 		defer cleanup()
 		listTaskErr := errors.New("failed to list tasks")
+		listTaskCount := 0
 		mockECS := MockECS{
 			UpdateContainerInstancesStateFn: mockStateChange,
-			ListTasksFn: func(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				assert.Equal(t, "cont-inst-id", aws.StringValue(input.ContainerInstance))
+			ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+				listTaskCount++
+				if listTaskCount == 1 {
+					// The pre-drain service snapshot succeeds; the failure
+					// below happens on waitUntilDrained's own ListTasks call.
+					return emptyListTasks(ctx, input, optFns...)
+				}
 				return nil, listTaskErr
 			},
 		}
 		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		err := u.drainInstance("cont-inst-id")
+		_, err := u.drainInstance(context.Background(), "cont-inst-id")
 		require.Error(t, err)
 		assert.ErrorIs(t, err, listTaskErr)
 		assert.Equal(t, []string{"DRAINING", "ACTIVE"}, stateChangeCalls)
 	})
 
-	t.Run("wait tasks stop err", func(t *testing.T) {
+	t.Run("list task err on service snapshot", func(t *testing.T) {
 		defer cleanup()
-		waitTaskErr := errors.New("failed to wait for tasks to stop")
+		listTaskErr := errors.New("failed to list tasks")
 		mockECS := MockECS{
 			UpdateContainerInstancesStateFn: mockStateChange,
-			ListTasksFn:                     mockListTasks,
-			WaitUntilTasksStoppedWithContextFn: func(_ aws.Context, input *ecs.DescribeTasksInput, _ ...request.WaiterOption) error {
-				assert.Equal(t, []*string{
-					aws.String("task-arn-1"),
-				}, input.Tasks)
-				assert.Equal(t, "test-cluster", aws.StringValue(input.Cluster))
-				return waitTaskErr
+			ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+				return nil, listTaskErr
 			},
 		}
 		u := updater{ecs: mockECS, cluster: "test-cluster"}
-		err := u.drainInstance("cont-inst-id")
+		_, err := u.drainInstance(context.Background(), "cont-inst-id")
 		require.Error(t, err)
-		assert.ErrorIs(t, err, waitTaskErr)
+		assert.ErrorIs(t, err, listTaskErr)
+		// Drain never starts if the pre-drain snapshot itself fails.
+		assert.Empty(t, stateChangeCalls)
+	})
+
+	t.Run("wait tasks stop err", func(t *testing.T) {
+		defer cleanup()
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
+		mockECS := MockECS{
+			UpdateContainerInstancesStateFn: mockStateChange,
+			ListTasksFn:                     mockListTasks,
+			DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+				assert.Equal(t, []string{"task-arn-1"}, input.Tasks)
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				return &ecs.DescribeTasksOutput{Tasks: []types.Task{{LastStatus: aws.String("RUNNING")}}}, nil
+			},
+		}
+		u := updater{ecs: mockECS, cluster: "test-cluster", backoffPolicy: policy}
+		_, err := u.drainInstance(context.Background(), "cont-inst-id")
+		assertWaitTimeoutErr(t, err)
 		assert.Equal(t, []string{"DRAINING", "ACTIVE"}, stateChangeCalls)
 	})
+
+	t.Run("wait tasks stop err then reactivation also fails", func(t *testing.T) {
+		defer cleanup()
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
+		reactivateErr := errors.New("failed to re-activate")
+		mockECS := MockECS{
+			UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+				stateChangeCalls = append(stateChangeCalls, string(input.Status))
+				if input.Status == types.ContainerInstanceStatusActive {
+					return nil, reactivateErr
+				}
+				return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+			},
+			ListTasksFn: mockListTasks,
+			DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+				return &ecs.DescribeTasksOutput{Tasks: []types.Task{{LastStatus: aws.String("RUNNING")}}}, nil
+			},
+		}
+		recorder := &recordingEventPublisher{}
+		u := updater{ecs: mockECS, cluster: "test-cluster", backoffPolicy: policy, events: recorder}
+		_, err := u.drainInstance(context.Background(), "cont-inst-id")
+		assertWaitTimeoutErr(t, err)
+		assert.Equal(t, []string{"DRAINING", "ACTIVE"}, stateChangeCalls)
+
+		require.Len(t, recorder.events, 1)
+		assert.Equal(t, eventInstanceReactivationFailed, recorder.events[0].Status)
+		assert.Contains(t, recorder.events[0].ErrorMessage, reactivateErr.Error())
+	})
+}
+
+func TestWaitForServicesStable(t *testing.T) {
+	t.Run("no services is a no-op", func(t *testing.T) {
+		u := updater{cluster: "test-cluster"}
+		err := u.waitForServicesStable(context.Background(), nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("batches more than 10 services per DescribeServices call", func(t *testing.T) {
+		services := make([]string, 23)
+		for i := range services {
+			services[i] = fmt.Sprintf("svc-%d", i)
+		}
+		var batchSizes []int
+		mockECS := MockECS{
+			DescribeServicesFn: func(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+				assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+				assert.LessOrEqual(t, len(input.Services), describeServicesMaxBatch)
+				batchSizes = append(batchSizes, len(input.Services))
+				out := make([]types.Service, len(input.Services))
+				for i, name := range input.Services {
+					out[i] = types.Service{
+						ServiceName:  aws.String(name),
+						Status:       aws.String("ACTIVE"),
+						DesiredCount: 1,
+						RunningCount: 1,
+						Deployments:  []types.Deployment{{RolloutState: types.DeploymentRolloutStateCompleted}},
+					}
+				}
+				return &ecs.DescribeServicesOutput{Services: out}, nil
+			},
+		}
+		u := updater{ecs: mockECS, cluster: "test-cluster"}
+		err := u.waitForServicesStable(context.Background(), services)
+		require.NoError(t, err)
+		assert.Equal(t, []int{10, 10, 3}, batchSizes)
+	})
+
+	t.Run("wait err", func(t *testing.T) {
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
+		mockECS := MockECS{
+			DescribeServicesFn: func(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+				return &ecs.DescribeServicesOutput{Services: []types.Service{{
+					ServiceName:  aws.String("my-service"),
+					Status:       aws.String("ACTIVE"),
+					DesiredCount: 1,
+					RunningCount: 0,
+					Deployments:  []types.Deployment{{RolloutState: types.DeploymentRolloutStateInProgress}},
+				}}}, nil
+			},
+		}
+		u := updater{ecs: mockECS, cluster: "test-cluster", backoffPolicy: policy}
+		err := u.waitForServicesStable(context.Background(), []string{"my-service"})
+		assertWaitTimeoutErr(t, err)
+	})
 }
 
 func TestUpdateInstance(t *testing.T) {
@@ -1147,28 +1467,28 @@ func TestUpdateInstance(t *testing.T) {
 		{
 			name: "update state available",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable)),
 			},
 			expectedSSMCommandCallOrder: []string{"check-document", "apply-document", "reboot-document"},
 		}, {
 			name: "update state ready",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateReady)),
 			},
 			expectedSSMCommandCallOrder: []string{"check-document", "reboot-document"},
 		}, {
 			name: "update state idle",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateIdle)),
 			},
 			expectedSSMCommandCallOrder: []string{"check-document"},
 		}, {
 			name: "update state staged",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateStaged)),
 			},
 			expectedSSMCommandCallOrder: []string{"check-document"},
@@ -1179,34 +1499,31 @@ func TestUpdateInstance(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ssmCommandCallOrder := []string{}
 			mockSSM := MockSSM{
-				SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-					ssmCommandCallOrder = append(ssmCommandCallOrder, aws.StringValue(input.DocumentName))
-					assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
+				SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+					ssmCommandCallOrder = append(ssmCommandCallOrder, aws.ToString(input.DocumentName))
+					assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
 					return &ssm.SendCommandOutput{
-						Command: &ssm.Command{
-							CommandId: aws.String("command-id"),
-						},
+						Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
 					}, nil
 				},
-				GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
+				GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+					assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+					assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
 					return tc.invocationOut, nil
 				},
-				WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-					return nil
-				},
 			}
 			mockEC2 := MockEC2{
-				WaitUntilInstanceStatusOkFn: func(input *ec2.DescribeInstanceStatusInput) error {
-					assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
-					return nil
+				DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+					assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+					return &ec2.DescribeInstanceStatusOutput{
+						InstanceStatuses: []ec2types.InstanceStatus{{
+							InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+						}},
+					}, nil
 				},
 			}
 			u := updater{ssm: mockSSM, ec2: mockEC2, checkDocument: "check-document", applyDocument: "apply-document", rebootDocument: "reboot-document"}
-			err := u.updateInstance(instance{
+			err := u.updateInstance(context.Background(), instance{
 				instanceID:          "instance-id",
 				containerInstanceID: "cont-inst-id",
 				bottlerocketVersion: "v0.1.0",
@@ -1224,150 +1541,302 @@ func TestUpdateInstance(t *testing.T) {
 
 func TestUpdateInstanceErr(t *testing.T) {
 	commandOutput := &ssm.SendCommandOutput{
-		Command: &ssm.Command{
-			CommandId: aws.String("command-id"),
-		},
+		Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
 	}
-	mockSendCommand := func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-		assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
+	mockSendCommand := func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+		assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
 		return commandOutput, nil
 	}
-	mockGetCommandInvocation := func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-		assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-		assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
+	mockGetCommandInvocation := func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+		assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+		assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
 		return &ssm.GetCommandInvocationOutput{
-			Status:                aws.String("Success"),
+			Status:                ssmtypes.CommandInvocationStatusSuccess,
 			StandardOutputContent: aws.String("{\"update_state\": \"Available\", \"active_partition\": { \"image\": { \"version\": \"0.0.0\"}}}"),
 		}, nil
 	}
-	mockWaitCommandExecution := func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-		assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-		assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-		return nil
-	}
 
 	t.Run("check err", func(t *testing.T) {
 		checkErr := errors.New("failed to send check command")
 		mockSSM := MockSSM{
-			SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-				assert.Equal(t, "check-document", aws.StringValue(input.DocumentName))
-				assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
+			SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+				assert.Equal(t, "check-document", aws.ToString(input.DocumentName))
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
 				return nil, checkErr
 			},
 		}
 		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		err := u.updateInstance(instance{
-			instanceID:          "instance-id",
-			containerInstanceID: "cont-inst-id",
-		})
+		err := u.updateInstance(context.Background(), instance{instanceID: "instance-id", containerInstanceID: "cont-inst-id"})
 		require.Error(t, err)
 		assert.ErrorIs(t, err, checkErr)
 	})
 	t.Run("apply err", func(t *testing.T) {
 		applyErr := errors.New("failed to send apply command")
 		mockSSM := MockSSM{
-			SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-				assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
-				if aws.StringValue(input.DocumentName) == "apply-document" {
+			SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				if aws.ToString(input.DocumentName) == "apply-document" {
 					return nil, applyErr
 				}
 				return commandOutput, nil
 			},
-			GetCommandInvocationFn:                mockGetCommandInvocation,
-			WaitUntilCommandExecutedWithContextFn: mockWaitCommandExecution,
+			GetCommandInvocationFn: mockGetCommandInvocation,
 		}
 		u := updater{ssm: mockSSM, checkDocument: "check-document", applyDocument: "apply-document"}
-		err := u.updateInstance(instance{
-			instanceID:          "instance-id",
-			containerInstanceID: "cont-inst-id",
-		})
+		err := u.updateInstance(context.Background(), instance{instanceID: "instance-id", containerInstanceID: "cont-inst-id"})
 		require.Error(t, err)
 		assert.ErrorIs(t, err, applyErr)
 	})
 	t.Run("reboot err", func(t *testing.T) {
 		rebootErr := errors.New("failed to send reboot command")
 		mockSSM := MockSSM{
-			SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-				assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
-				if aws.StringValue(input.DocumentName) == "reboot-document" {
+			SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				if aws.ToString(input.DocumentName) == "reboot-document" {
 					return nil, rebootErr
 				}
 				return commandOutput, nil
 			},
-			GetCommandInvocationFn:                mockGetCommandInvocation,
-			WaitUntilCommandExecutedWithContextFn: mockWaitCommandExecution,
+			GetCommandInvocationFn: mockGetCommandInvocation,
 		}
 		u := updater{ssm: mockSSM, checkDocument: "check-document", applyDocument: "apply-document", rebootDocument: "reboot-document"}
-		err := u.updateInstance(instance{
-			instanceID:          "instance-id",
-			containerInstanceID: "cont-inst-id",
-		})
+		err := u.updateInstance(context.Background(), instance{instanceID: "instance-id", containerInstanceID: "cont-inst-id"})
 		require.Error(t, err)
 		assert.ErrorIs(t, err, rebootErr)
 	})
 	t.Run("invocation err", func(t *testing.T) {
+		// The waiter inside sendCommand must see a terminal status before
+		// getCommandResult's own call is allowed to fail, otherwise the
+		// waiter (which retries indefinitely on error) never lets the call
+		// through.
 		ssmGetInvocationErr := errors.New("failed to get command invocation")
+		calls := 0
 		mockSSM := MockSSM{
 			SendCommandFn: mockSendCommand,
-			GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+				assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
+				calls++
+				if calls == 1 {
+					return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
+				}
 				return nil, ssmGetInvocationErr
 			},
-			WaitUntilCommandExecutedWithContextFn: mockWaitCommandExecution,
 		}
 		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		err := u.updateInstance(instance{
-			instanceID:          "instance-id",
-			containerInstanceID: "cont-inst-id",
-		})
+		err := u.updateInstance(context.Background(), instance{instanceID: "instance-id", containerInstanceID: "cont-inst-id"})
 		require.Error(t, err)
 		assert.ErrorIs(t, err, ssmGetInvocationErr)
 	})
 	t.Run("wait ssm err", func(t *testing.T) {
-		waitExecErr := errors.New("failed to wait ssm execution complete")
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
 		mockSSM := MockSSM{
 			SendCommandFn: mockSendCommand,
-			WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-				return waitExecErr
-			},
-			GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-				return &ssm.GetCommandInvocationOutput{}, nil
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+				assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress}, nil
 			},
 		}
-		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		err := u.updateInstance(instance{
-			instanceID:          "instance-id",
-			containerInstanceID: "cont-inst-id",
-		})
-		require.Error(t, err)
-		assert.ErrorIs(t, err, waitExecErr)
+		u := updater{ssm: mockSSM, checkDocument: "check-document", backoffPolicy: policy}
+		err := u.updateInstance(context.Background(), instance{instanceID: "instance-id", containerInstanceID: "cont-inst-id"})
+		assertWaitTimeoutErr(t, err)
 	})
 	t.Run("wait instance ok err", func(t *testing.T) {
-		waitErr := errors.New("failed to wait instance ok")
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
 		mockSSM := MockSSM{
-			SendCommandFn:                         mockSendCommand,
-			GetCommandInvocationFn:                mockGetCommandInvocation,
-			WaitUntilCommandExecutedWithContextFn: mockWaitCommandExecution,
+			SendCommandFn:          mockSendCommand,
+			GetCommandInvocationFn: mockGetCommandInvocation,
 		}
 
 		mockEC2 := MockEC2{
-			WaitUntilInstanceStatusOkFn: func(input *ec2.DescribeInstanceStatusInput) error {
-				assert.Equal(t, []*string{aws.String("instance-id")}, input.InstanceIds)
-				return waitErr
+			DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				return &ec2.DescribeInstanceStatusOutput{
+					InstanceStatuses: []ec2types.InstanceStatus{{
+						InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusImpaired},
+					}},
+				}, nil
 			},
 		}
-		u := updater{ssm: mockSSM, ec2: mockEC2, checkDocument: "check-document", applyDocument: "apply-document", rebootDocument: "reboot-document"}
-		err := u.updateInstance(instance{
-			instanceID:          "instance-id",
-			containerInstanceID: "cont-inst-id",
-		})
+		u := updater{ssm: mockSSM, ec2: mockEC2, checkDocument: "check-document", applyDocument: "apply-document", rebootDocument: "reboot-document", backoffPolicy: policy}
+		err := u.updateInstance(context.Background(), instance{instanceID: "instance-id", containerInstanceID: "cont-inst-id"})
+		assertWaitTimeoutErr(t, err)
+	})
+}
+
+// TestStopStartInstance covers updateInstance's stop-start mode: it asserts
+// the EC2 calls happen in order (Stop -> wait stopped -> Start -> wait
+// running -> wait Ok) on success, and that a failure at any stage is wrapped
+// in errInstancePowerCycleFailed so the caller knows not to reactivate the
+// instance.
+func TestStopStartInstance(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var callOrder []string
+		mockEC2 := MockEC2{
+			StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+				callOrder = append(callOrder, "stop")
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				return &ec2.StopInstancesOutput{}, nil
+			},
+			StartInstancesFn: func(ctx context.Context, input *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+				callOrder = append(callOrder, "start")
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				return &ec2.StartInstancesOutput{}, nil
+			},
+			DescribeInstancesFn: func(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				name := ec2types.InstanceStateNameStopped
+				if len(callOrder) > 0 && callOrder[len(callOrder)-1] == "start" {
+					name = ec2types.InstanceStateNameRunning
+				}
+				if name == ec2types.InstanceStateNameStopped {
+					callOrder = append(callOrder, "wait-stopped")
+				} else {
+					callOrder = append(callOrder, "wait-running")
+				}
+				return &ec2.DescribeInstancesOutput{
+					Reservations: []ec2types.Reservation{{
+						Instances: []ec2types.Instance{{State: &ec2types.InstanceState{Name: name}}},
+					}},
+				}, nil
+			},
+			DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+				callOrder = append(callOrder, "wait-ok")
+				assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+				return &ec2.DescribeInstanceStatusOutput{
+					InstanceStatuses: []ec2types.InstanceStatus{{
+						InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+					}},
+				}, nil
+			},
+		}
+		u := updater{ec2: mockEC2, updateMode: updateModeStopStart}
+		err := u.stopStartInstance(context.Background(), "instance-id")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stop", "wait-stopped", "start", "wait-running", "wait-ok"}, callOrder)
+	})
+	t.Run("stop err", func(t *testing.T) {
+		stopErr := errors.New("failed to stop instance")
+		mockEC2 := MockEC2{
+			StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+				return nil, stopErr
+			},
+		}
+		u := updater{ec2: mockEC2}
+		err := u.stopStartInstance(context.Background(), "instance-id")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errInstancePowerCycleFailed)
+		assert.Contains(t, err.Error(), stopErr.Error())
+	})
+	t.Run("wait stopped err", func(t *testing.T) {
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
+		mockEC2 := MockEC2{
+			StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+				return &ec2.StopInstancesOutput{}, nil
+			},
+			DescribeInstancesFn: func(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+				return &ec2.DescribeInstancesOutput{
+					Reservations: []ec2types.Reservation{{
+						Instances: []ec2types.Instance{{State: &ec2types.InstanceState{Name: ec2types.InstanceStateNamePending}}},
+					}},
+				}, nil
+			},
+		}
+		u := updater{ec2: mockEC2, backoffPolicy: policy}
+		err := u.stopStartInstance(context.Background(), "instance-id")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errInstancePowerCycleFailed)
+	})
+	t.Run("start err", func(t *testing.T) {
+		startErr := errors.New("failed to start instance")
+		mockEC2 := MockEC2{
+			StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+				return &ec2.StopInstancesOutput{}, nil
+			},
+			DescribeInstancesFn: func(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+				return &ec2.DescribeInstancesOutput{
+					Reservations: []ec2types.Reservation{{
+						Instances: []ec2types.Instance{{State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}}},
+					}},
+				}, nil
+			},
+			StartInstancesFn: func(ctx context.Context, input *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+				return nil, startErr
+			},
+		}
+		u := updater{ec2: mockEC2}
+		err := u.stopStartInstance(context.Background(), "instance-id")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errInstancePowerCycleFailed)
+		assert.Contains(t, err.Error(), startErr.Error())
+	})
+	t.Run("wait running err", func(t *testing.T) {
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
+		mockEC2 := MockEC2{
+			StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+				return &ec2.StopInstancesOutput{}, nil
+			},
+			StartInstancesFn: func(ctx context.Context, input *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+				return &ec2.StartInstancesOutput{}, nil
+			},
+			DescribeInstancesFn: func(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+				return &ec2.DescribeInstancesOutput{
+					Reservations: []ec2types.Reservation{{
+						Instances: []ec2types.Instance{{State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}}},
+					}},
+				}, nil
+			},
+		}
+		u := updater{ec2: mockEC2, backoffPolicy: policy}
+		err := u.stopStartInstance(context.Background(), "instance-id")
 		require.Error(t, err)
-		assert.ErrorIs(t, err, waitErr)
+		assert.ErrorIs(t, err, errInstancePowerCycleFailed)
+	})
+	t.Run("wait ok err", func(t *testing.T) {
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
+		var startCalled bool
+		mockEC2 := MockEC2{
+			StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+				return &ec2.StopInstancesOutput{}, nil
+			},
+			StartInstancesFn: func(ctx context.Context, input *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+				startCalled = true
+				return &ec2.StartInstancesOutput{}, nil
+			},
+			DescribeInstancesFn: func(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+				name := ec2types.InstanceStateNameStopped
+				if startCalled {
+					name = ec2types.InstanceStateNameRunning
+				}
+				return &ec2.DescribeInstancesOutput{
+					Reservations: []ec2types.Reservation{{
+						Instances: []ec2types.Instance{{State: &ec2types.InstanceState{Name: name}}},
+					}},
+				}, nil
+			},
+			DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+				return &ec2.DescribeInstanceStatusOutput{
+					InstanceStatuses: []ec2types.InstanceStatus{{
+						InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusImpaired},
+					}},
+				}, nil
+			},
+		}
+		u := updater{ec2: mockEC2, backoffPolicy: policy}
+		err := u.stopStartInstance(context.Background(), "instance-id")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errInstancePowerCycleFailed)
 	})
 }
 
@@ -1381,7 +1850,7 @@ func TestVerifyUpdate(t *testing.T) {
 		{
 			name: "verify success",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateIdle, "0.0.1")),
 			},
 			expectedOk: true,
@@ -1389,7 +1858,7 @@ func TestVerifyUpdate(t *testing.T) {
 		{
 			name: "version is same",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateIdle, "0.0.0")),
 			},
 			expectedOk: false,
@@ -1397,7 +1866,7 @@ func TestVerifyUpdate(t *testing.T) {
 		{
 			name: "another version is available",
 			invocationOut: &ssm.GetCommandInvocationOutput{
-				Status:                aws.String("Success"),
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
 				StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateAvailable, "0.0.1")),
 			},
 			expectedOk: true,
@@ -1407,27 +1876,20 @@ func TestVerifyUpdate(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockSSM := MockSSM{
-				SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-					assert.Equal(t, "check-document", aws.StringValue(input.DocumentName))
+				SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+					assert.Equal(t, "check-document", aws.ToString(input.DocumentName))
 					return &ssm.SendCommandOutput{
-						Command: &ssm.Command{
-							CommandId: aws.String("command-id"),
-						},
+						Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
 					}, nil
 				},
-				GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
+				GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+					assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+					assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
 					return tc.invocationOut, nil
 				},
-				WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-					assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-					assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-					return nil
-				},
 			}
-			u := updater{ssm: mockSSM, checkDocument: "check-document"}
-			ok, err := u.verifyUpdate(instance{
+			u := updater{ssm: mockSSM, checkDocument: "check-document", versionPolicy: &VersionPolicy{}}
+			ok, _, _, err := u.verifyUpdate(context.Background(), instance{
 				instanceID:          "instance-id",
 				containerInstanceID: "cont-inst-id",
 				bottlerocketVersion: "0.0.0",
@@ -1439,40 +1901,31 @@ func TestVerifyUpdate(t *testing.T) {
 }
 
 func TestVerifyUpdateErr(t *testing.T) {
-	mockSSMCommandOut := func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-		assert.Equal(t, "check-document", aws.StringValue(input.DocumentName))
+	mockSSMCommandOut := func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+		assert.Equal(t, "check-document", aws.ToString(input.DocumentName))
 		assert.Equal(t, 1, len(input.InstanceIds))
-		assert.Equal(t, "instance-id", aws.StringValue(input.InstanceIds[0]))
+		assert.Equal(t, "instance-id", input.InstanceIds[0])
 		return &ssm.SendCommandOutput{
-			Command: &ssm.Command{
-				CommandId: aws.String("command-id"),
-			},
+			Command: &ssmtypes.Command{CommandId: aws.String("command-id")},
 		}, nil
 	}
-	mockWaitCommandExecution := func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-		assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-		assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-		return nil
-	}
-	mockGetCommandInvocation := func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-		assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-		assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-		return &ssm.GetCommandInvocationOutput{
-			Status: aws.String("Success"),
-		}, nil
+	mockGetCommandInvocation := func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+		assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+		assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
+		return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
 	}
 	t.Run("check err", func(t *testing.T) {
 		ssmCheckErr := errors.New("failed to send check command")
 		mockSSM := MockSSM{
-			SendCommandFn: func(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
-				assert.Equal(t, "check-document", aws.StringValue(input.DocumentName))
+			SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+				assert.Equal(t, "check-document", aws.ToString(input.DocumentName))
 				assert.Equal(t, 1, len(input.InstanceIds))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceIds[0]))
+				assert.Equal(t, "instance-id", input.InstanceIds[0])
 				return nil, ssmCheckErr
 			},
 		}
 		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		ok, err := u.verifyUpdate(instance{
+		ok, _, _, err := u.verifyUpdate(context.Background(), instance{
 			instanceID:          "instance-id",
 			containerInstanceID: "cont-inst-id",
 			bottlerocketVersion: "0.0.0",
@@ -1482,43 +1935,45 @@ func TestVerifyUpdateErr(t *testing.T) {
 		assert.False(t, ok)
 	})
 	t.Run("wait ssm err", func(t *testing.T) {
-		waitExecErr := errors.New("failed to wait ssm execution complete")
+		policy, restore := tinyWaiterPolicy(t)
+		defer restore()
+
 		mockSSM := MockSSM{
 			SendCommandFn: mockSSMCommandOut,
-			WaitUntilCommandExecutedWithContextFn: func(_ aws.Context, input *ssm.GetCommandInvocationInput, _ ...request.WaiterOption) error {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-				return waitExecErr
-			},
-			GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
-				return &ssm.GetCommandInvocationOutput{}, nil
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+				assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
+				return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress}, nil
 			},
 		}
-		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		ok, err := u.verifyUpdate(instance{
+		u := updater{ssm: mockSSM, checkDocument: "check-document", backoffPolicy: policy}
+		ok, _, _, err := u.verifyUpdate(context.Background(), instance{
 			instanceID:          "instance-id",
 			containerInstanceID: "cont-inst-id",
 			bottlerocketVersion: "0.0.0",
 		})
-		require.Error(t, err)
-		assert.ErrorIs(t, err, waitExecErr)
+		assertWaitTimeoutErr(t, err)
 		assert.False(t, ok)
 	})
 	t.Run("invocation err", func(t *testing.T) {
+		// As above: let the waiter inside sendCommand terminate before
+		// getCommandResult's own call is allowed to fail.
 		ssmGetInvocationErr := errors.New("failed to get command invocation")
+		calls := 0
 		mockSSM := MockSSM{
-			SendCommandFn:                         mockSSMCommandOut,
-			WaitUntilCommandExecutedWithContextFn: mockWaitCommandExecution,
-			GetCommandInvocationFn: func(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
-				assert.Equal(t, "command-id", aws.StringValue(input.CommandId))
-				assert.Equal(t, "instance-id", aws.StringValue(input.InstanceId))
+			SendCommandFn: mockSSMCommandOut,
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				assert.Equal(t, "command-id", aws.ToString(input.CommandId))
+				assert.Equal(t, "instance-id", aws.ToString(input.InstanceId))
+				calls++
+				if calls == 1 {
+					return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess}, nil
+				}
 				return nil, ssmGetInvocationErr
 			},
 		}
 		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		ok, err := u.verifyUpdate(instance{
+		ok, _, _, err := u.verifyUpdate(context.Background(), instance{
 			instanceID:          "instance-id",
 			containerInstanceID: "cont-inst-id",
 			bottlerocketVersion: "0.0.0",
@@ -1530,22 +1985,104 @@ func TestVerifyUpdateErr(t *testing.T) {
 
 	t.Run("parse output err", func(t *testing.T) {
 		mockSSM := MockSSM{
-			SendCommandFn:                         mockSSMCommandOut,
-			WaitUntilCommandExecutedWithContextFn: mockWaitCommandExecution,
-			GetCommandInvocationFn:                mockGetCommandInvocation,
+			SendCommandFn:          mockSSMCommandOut,
+			GetCommandInvocationFn: mockGetCommandInvocation,
 		}
-		u := updater{ssm: mockSSM, checkDocument: "check-document"}
-		ok, err := u.verifyUpdate(instance{
+		// Every attempt hits the same unparseable output, so disable retries:
+		// this subtest covers the parse-error path itself, not
+		// checkCommandOutput's retry behavior (covered by TestCheckCommandOutput).
+		u := updater{ssm: mockSSM, checkDocument: "check-document", retryPolicy: RetryPolicy{MaxAttempts: 1}}
+		ok, _, _, err := u.verifyUpdate(context.Background(), instance{
 			instanceID:          "instance-id",
 			containerInstanceID: "cont-inst-id",
 			bottlerocketVersion: "0.0.0",
 		})
 		require.Error(t, err)
-		assert.Contains(t, err.Error(), `failed to parse command output "", manual verification required`)
+		assert.Contains(t, err.Error(), "failed to get check command output, manual verification required")
+		assert.Contains(t, err.Error(), `failed to parse command output ""`)
 		assert.False(t, ok)
 	})
 }
 
+func TestVerifyUpdateRespectsUpdatePolicyDocument(t *testing.T) {
+	checkPattern := "{\"update_state\": \"%s\", \"active_partition\": { \"image\": { \"version\": \"%s\"}}}"
+	mockSSM := func(version string) MockSSM {
+		return MockSSM{
+			SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+				return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+			},
+			GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+				return &ssm.GetCommandInvocationOutput{
+					Status:                ssmtypes.CommandInvocationStatusSuccess,
+					StandardOutputContent: aws.String(fmt.Sprintf(checkPattern, updateStateIdle, version)),
+				}, nil
+			},
+		}
+	}
+
+	t.Run("canary in progress -- instance updated past the cluster's pinned version", func(t *testing.T) {
+		u := updater{
+			ssm:           mockSSM("1.20.0"),
+			checkDocument: "check-document",
+			versionPolicy: &VersionPolicy{},
+			cluster:       "prod",
+			updatePolicy: &UpdatePolicyDocument{
+				Clusters: map[string]UpdatePolicyRule{"prod": {Pin: "1.19.0"}},
+			},
+		}
+		ok, target, reason, err := u.verifyUpdate(context.Background(), instance{
+			instanceID:          "instance-id",
+			containerInstanceID: "cont-inst-id",
+			bottlerocketVersion: "1.18.0",
+		})
+		require.Error(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, "1.19.0", target)
+		assert.Contains(t, reason, "pinned version")
+	})
+
+	t.Run("skip_versions -- instance landed on a blocked version", func(t *testing.T) {
+		u := updater{
+			ssm:           mockSSM("1.19.1"),
+			checkDocument: "check-document",
+			versionPolicy: &VersionPolicy{},
+			cluster:       "prod",
+			updatePolicy: &UpdatePolicyDocument{
+				Clusters: map[string]UpdatePolicyRule{"prod": {SkipVersions: []string{"1.19.1"}}},
+			},
+		}
+		ok, _, reason, err := u.verifyUpdate(context.Background(), instance{
+			instanceID:          "instance-id",
+			containerInstanceID: "cont-inst-id",
+			bottlerocketVersion: "1.18.0",
+		})
+		require.Error(t, err)
+		assert.False(t, ok)
+		assert.Contains(t, reason, "skip_versions")
+	})
+
+	t.Run("per-tag rule overlays the cluster rule", func(t *testing.T) {
+		u := updater{
+			ssm:           mockSSM("1.19.0"),
+			checkDocument: "check-document",
+			versionPolicy: &VersionPolicy{},
+			cluster:       "prod",
+			updatePolicy: &UpdatePolicyDocument{
+				Tags: map[string]UpdatePolicyRule{"env=canary": {Pin: "1.19.0"}},
+			},
+		}
+		ok, target, _, err := u.verifyUpdate(context.Background(), instance{
+			instanceID:          "instance-id",
+			containerInstanceID: "cont-inst-id",
+			bottlerocketVersion: "1.18.0",
+			tags:                map[string]string{"env": "canary"},
+		})
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "1.19.0", target)
+	})
+}
+
 func TestActivateInstance(t *testing.T) {
 	cases := []struct {
 		name        string
@@ -1559,22 +2096,14 @@ func TestActivateInstance(t *testing.T) {
 		}, {
 			name: "activate api fail",
 			stateOut: &ecs.UpdateContainerInstancesStateOutput{
-				Failures: []*ecs.Failure{
-					{
-						Reason: aws.String("OTHER"),
-					},
-				},
+				Failures: []types.Failure{{Reason: aws.String("OTHER")}},
 			},
-			expectedErr: "API failures while activating: [{\n  Reason: \"OTHER\"\n}]",
+			expectedErr: "API failures while activating:",
 		},
 		{
 			name: "activate api fail inactive",
 			stateOut: &ecs.UpdateContainerInstancesStateOutput{
-				Failures: []*ecs.Failure{
-					{
-						Reason: aws.String("INACTIVE"),
-					},
-				},
+				Failures: []types.Failure{{Reason: aws.String("INACTIVE")}},
 			},
 		},
 		{
@@ -1586,12 +2115,12 @@ func TestActivateInstance(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockECS := MockECS{
-				UpdateContainerInstancesStateFn: func(_ *ecs.UpdateContainerInstancesStateInput) (*ecs.UpdateContainerInstancesStateOutput, error) {
+				UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
 					return tc.stateOut, tc.stateErr
 				},
 			}
 			u := updater{ecs: mockECS}
-			err := u.activateInstance("cont-inst-id")
+			err := u.activateInstance(context.Background(), "cont-inst-id")
 			if tc.expectedErr == "" {
 				require.NoError(t, err)
 			} else {
@@ -1613,19 +2142,14 @@ func TestAlreadyRunning(t *testing.T) {
 		{
 			name: "success",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{
-					aws.String("task-arn-1"),
-					aws.String("task-arn-2"),
-				},
+				TaskArns: []string{"task-arn-1", "task-arn-2"},
 			},
 			expectedOk: true,
 		},
 		{
 			name: "only one task",
 			listOut: &ecs.ListTasksOutput{
-				TaskArns: []*string{
-					aws.String("tarsk-arn-1"),
-				},
+				TaskArns: []string{"task-arn-1"},
 			},
 			expectedOk: false,
 		},
@@ -1639,12 +2163,12 @@ func TestAlreadyRunning(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockECS := MockECS{
-				ListTasksFn: func(_ *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+				ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
 					return tc.listOut, tc.listErr
 				},
 			}
 			u := updater{ecs: mockECS, cluster: "ecs-cluster"}
-			ok, err := u.alreadyRunning("updater-family")
+			ok, err := u.alreadyRunning(context.Background(), "updater-family")
 			if tc.expectedErr == "" {
 				require.NoError(t, err)
 			} else {
@@ -1655,3 +2179,61 @@ func TestAlreadyRunning(t *testing.T) {
 		})
 	}
 }
+
+func TestAlreadyRunningRespectsUpdatePolicyDocumentMaxUnavailable(t *testing.T) {
+	cases := []struct {
+		name              string
+		maxUnavailable    string
+		drainingInstances []string
+		totalInstances    []string
+		expectedOk        bool
+	}{
+		{
+			name:              "draining count at the budget -- treated as already running",
+			maxUnavailable:    "1",
+			drainingInstances: []string{"ci-1"},
+			expectedOk:        true,
+		},
+		{
+			name:              "draining count below the budget",
+			maxUnavailable:    "2",
+			drainingInstances: []string{"ci-1"},
+			expectedOk:        false,
+		},
+		{
+			name:              "percentage budget computed from cluster size",
+			maxUnavailable:    "50%",
+			drainingInstances: []string{"ci-1"},
+			totalInstances:    []string{"ci-1", "ci-2"},
+			expectedOk:        true,
+		},
+		{
+			name:              "no max_unavailable rule configured -- falls back to the task-family lock only",
+			drainingInstances: []string{"ci-1", "ci-2", "ci-3"},
+			expectedOk:        false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockECS := MockECS{
+				ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+					return &ecs.ListTasksOutput{TaskArns: []string{"task-arn-1"}}, nil
+				},
+				ListContainerInstancesFn: func(ctx context.Context, input *ecs.ListContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+					if input.Status == types.ContainerInstanceStatusDraining {
+						return &ecs.ListContainerInstancesOutput{ContainerInstanceArns: tc.drainingInstances}, nil
+					}
+					return &ecs.ListContainerInstancesOutput{ContainerInstanceArns: tc.totalInstances}, nil
+				},
+			}
+			var doc *UpdatePolicyDocument
+			if tc.maxUnavailable != "" {
+				doc = &UpdatePolicyDocument{Clusters: map[string]UpdatePolicyRule{"ecs-cluster": {MaxUnavailable: tc.maxUnavailable}}}
+			}
+			u := updater{ecs: mockECS, cluster: "ecs-cluster", updatePolicy: doc}
+			ok, err := u.alreadyRunning(context.Background(), "updater-family")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	// strategyRolling updates every eligible instance through the regular
+	// bounded-parallelism supervisor loop.
+	strategyRolling = "rolling"
+	// strategyCanary updates a small batch of instances first, bakes them,
+	// and only proceeds with the rest of the fleet if every canary passes.
+	strategyCanary = "canary"
+
+	defaultCanaryCount  = 1
+	defaultBakeDuration = 10 * time.Minute
+
+	// bakePollInterval is how often the bake phase re-checks a canary's
+	// container-instance state, task health, and active version.
+	bakePollInterval = 15 * time.Second
+
+	taskStatusStopped = "STOPPED"
+	taskStatusRunning = "RUNNING"
+)
+
+// CanaryFailure explains why a single canary instance failed to bake.
+type CanaryFailure struct {
+	InstanceID          string
+	ContainerInstanceID string
+	Reason              string
+}
+
+// CanaryFailedError is returned by updateSupervisor.runCanary when one or
+// more canaries fail to update or to bake successfully. The rollout stops
+// without updating any instance beyond the canaries.
+type CanaryFailedError struct {
+	Failures []CanaryFailure
+}
+
+func (e *CanaryFailedError) Error() string {
+	msg := fmt.Sprintf("%d canary instance(s) failed to bake:", len(e.Failures))
+	for _, f := range e.Failures {
+		msg += fmt.Sprintf(" %s (%s): %s;", f.InstanceID, f.ContainerInstanceID, f.Reason)
+	}
+	return msg
+}
+
+// runCanary updates canaryCount candidates first and bakes them for
+// bakeDuration before updating the remainder of candidates. If any canary
+// fails to update or fails to bake, the rollout stops and returns a
+// *CanaryFailedError without touching the rest of the fleet.
+func (s *updateSupervisor) runCanary(ctx context.Context, candidates []instance, totalInstances int, canaryCount int, bakeDuration time.Duration) (map[string]string, error) {
+	summary := make(map[string]string)
+	if len(candidates) == 0 {
+		return summary, nil
+	}
+	if canaryCount < 1 {
+		canaryCount = defaultCanaryCount
+	}
+	if canaryCount > len(candidates) {
+		canaryCount = len(candidates)
+	}
+	ordered := s.orderCandidates(candidates)
+	canaries := ordered[:canaryCount]
+	remainder := ordered[canaryCount:]
+
+	log.Printf("Canary rollout: updating %d canary instance(s) before the rest of the fleet", len(canaries))
+	canarySummary, err := s.run(ctx, canaries, totalInstances)
+	for id, outcome := range canarySummary {
+		summary[id] = outcome
+	}
+	if err != nil {
+		return summary, fmt.Errorf("canary update failed, aborting rollout: %w", err)
+	}
+
+	if s.updater.dryRun {
+		log.Printf("Dry run: skipping canary bake, proceeding straight to the rest of the fleet")
+	} else {
+		log.Printf("Canary rollout: baking %d canary instance(s) for %s", len(canaries), bakeDuration)
+		if failures := s.bake(ctx, canaries, bakeDuration); len(failures) > 0 {
+			return summary, &CanaryFailedError{Failures: failures}
+		}
+	}
+
+	log.Printf("Canary rollout: canaries healthy, proceeding with remaining %d instance(s)", len(remainder))
+	remainderSummary, err := s.run(ctx, remainder, totalInstances)
+	for id, outcome := range remainderSummary {
+		summary[id] = outcome
+	}
+	return summary, err
+}
+
+// bake polls every canary concurrently until each satisfies canaryHealthy or
+// bakeDuration elapses, returning one CanaryFailure per canary that never
+// became healthy. Canaries are polled in parallel, rather than one after
+// another, so that a canary stuck for the whole bakeDuration doesn't delay
+// observing the others.
+func (s *updateSupervisor) bake(ctx context.Context, canaries []instance, bakeDuration time.Duration) []CanaryFailure {
+	type result struct {
+		failure *CanaryFailure
+	}
+	resultsCh := make(chan result, len(canaries))
+	var wg sync.WaitGroup
+	for _, c := range canaries {
+		wg.Add(1)
+		go func(c instance) {
+			defer wg.Done()
+			err := poll(bakePollInterval, bakeDuration, func() (bool, error) {
+				return s.canaryHealthy(ctx, c)
+			})
+			if err == nil {
+				resultsCh <- result{}
+				return
+			}
+			resultsCh <- result{failure: &CanaryFailure{
+				InstanceID:          c.instanceID,
+				ContainerInstanceID: c.containerInstanceID,
+				Reason:              err.Error(),
+			}}
+		}(c)
+	}
+	wg.Wait()
+	close(resultsCh)
+
+	failures := make([]CanaryFailure, 0)
+	for r := range resultsCh {
+		if r.failure != nil {
+			failures = append(failures, *r.failure)
+		}
+	}
+	return failures
+}
+
+// canaryHealthy reports whether c currently satisfies every bake condition:
+// its container instance has re-registered ACTIVE, none of its tasks have
+// stopped for a reason other than EssentialContainerExited, every task is
+// RUNNING, and the check document reports c's target version is active. A
+// false, nil result tells poll to keep waiting; a non-nil error is fatal and
+// ends the bake for this canary early.
+func (s *updateSupervisor) canaryHealthy(ctx context.Context, c instance) (bool, error) {
+	u := s.updater
+	descCI, err := u.ecs.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+		Cluster:            &u.cluster,
+		ContainerInstances: []string{c.containerInstanceID},
+	})
+	if err != nil || len(descCI.ContainerInstances) == 0 {
+		return false, nil
+	}
+	if aws.ToString(descCI.ContainerInstances[0].Status) != string(types.ContainerInstanceStatusActive) {
+		return false, nil
+	}
+
+	list, err := u.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:           &u.cluster,
+		ContainerInstance: aws.String(c.containerInstanceID),
+	})
+	if err != nil {
+		return false, nil
+	}
+	if len(list.TaskArns) > 0 {
+		desc, err := u.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &u.cluster,
+			Tasks:   list.TaskArns,
+		})
+		if err != nil {
+			return false, nil
+		}
+		for _, task := range desc.Tasks {
+			status := aws.ToString(task.LastStatus)
+			if status == taskStatusStopped {
+				if task.StopCode != types.TaskStopCodeEssentialContainerExited {
+					return false, fmt.Errorf("task %s stopped with reason %q", aws.ToString(task.TaskArn), aws.ToString(task.StoppedReason))
+				}
+				continue
+			}
+			if status != taskStatusRunning {
+				return false, nil
+			}
+		}
+	}
+
+	commandID, err := u.sendCommand(ctx, []string{c.instanceID}, u.checkDocument)
+	if err != nil {
+		return false, nil
+	}
+	output, err := u.checkCommandOutput(ctx, commandID, c.instanceID)
+	if err != nil {
+		return false, nil
+	}
+	if output.ActivePartition.Image.Version != c.targetVersion {
+		return false, nil
+	}
+	return true, nil
+}
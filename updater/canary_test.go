@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCanaryHealthy covers each of canaryHealthy's bake conditions in
+// isolation, mirroring the table-driven style of TestUpdateInstance.
+func TestCanaryHealthy(t *testing.T) {
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v2.0.0"}}}`
+	cases := []struct {
+		name          string
+		ciStatus      string
+		tasks         []types.Task
+		expectHealthy bool
+		expectErr     string
+	}{
+		{
+			name:          "active and no tasks",
+			ciStatus:      string(types.ContainerInstanceStatusActive),
+			tasks:         nil,
+			expectHealthy: true,
+		}, {
+			name:     "task still running",
+			ciStatus: string(types.ContainerInstanceStatusActive),
+			tasks: []types.Task{
+				{TaskArn: aws.String("task-1"), LastStatus: aws.String("RUNNING")},
+			},
+			expectHealthy: true,
+		}, {
+			name:     "task stopped for an essential container exit is ignored",
+			ciStatus: string(types.ContainerInstanceStatusActive),
+			tasks: []types.Task{
+				{TaskArn: aws.String("task-1"), LastStatus: aws.String("STOPPED"), StopCode: types.TaskStopCodeEssentialContainerExited},
+			},
+			expectHealthy: true,
+		}, {
+			name:     "container instance not yet active",
+			ciStatus: string(types.ContainerInstanceStatusRegistering),
+			tasks:    nil,
+		}, {
+			name:     "task still pending",
+			ciStatus: string(types.ContainerInstanceStatusActive),
+			tasks: []types.Task{
+				{TaskArn: aws.String("task-1"), LastStatus: aws.String("PENDING")},
+			},
+		}, {
+			name:     "task stopped for an unexpected reason is fatal",
+			ciStatus: string(types.ContainerInstanceStatusActive),
+			tasks: []types.Task{
+				{TaskArn: aws.String("task-1"), LastStatus: aws.String("STOPPED"), StopCode: types.TaskStopCodeTaskFailedToStart, StoppedReason: aws.String("boom")},
+			},
+			expectErr: `task task-1 stopped with reason "boom"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockECS := MockECS{
+				DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+					return &ecs.DescribeContainerInstancesOutput{
+						ContainerInstances: []types.ContainerInstance{{Status: aws.String(tc.ciStatus)}},
+					}, nil
+				},
+				ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+					arns := make([]string, len(tc.tasks))
+					for i, task := range tc.tasks {
+						arns[i] = aws.ToString(task.TaskArn)
+					}
+					return &ecs.ListTasksOutput{TaskArns: arns}, nil
+				},
+				DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+					return &ecs.DescribeTasksOutput{Tasks: tc.tasks}, nil
+				},
+			}
+			mockSSM := MockSSM{
+				SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+					return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+				},
+				GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+					return &ssm.GetCommandInvocationOutput{
+						Status:                ssmtypes.CommandInvocationStatusSuccess,
+						StandardOutputContent: aws.String(checkOutputJSON),
+					}, nil
+				},
+			}
+			u := &updater{cluster: "test-cluster", ecs: mockECS, ssm: mockSSM, checkDocument: "check-document"}
+			s := &updateSupervisor{updater: u}
+			c := instance{instanceID: "i-1", containerInstanceID: "ci-1", targetVersion: "v2.0.0"}
+
+			healthy, err := s.canaryHealthy(context.Background(), c)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectHealthy, healthy)
+		})
+	}
+}
+
+// TestCanaryHealthyVersionMismatch asserts that a canary isn't considered
+// healthy until the check document reports its target version as active.
+func TestCanaryHealthyVersionMismatch(t *testing.T) {
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v1.0.0"}}}`
+	mockECS := MockECS{
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{Status: aws.String(string(types.ContainerInstanceStatusActive))}},
+			}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+	}
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	u := &updater{cluster: "test-cluster", ecs: mockECS, ssm: mockSSM, checkDocument: "check-document"}
+	s := &updateSupervisor{updater: u}
+	c := instance{instanceID: "i-1", containerInstanceID: "ci-1", targetVersion: "v2.0.0"}
+
+	healthy, err := s.canaryHealthy(context.Background(), c)
+	require.NoError(t, err)
+	assert.False(t, healthy)
+}
+
+// TestBakeFailsOnTimeout asserts that a canary which never reports healthy
+// within bakeDuration is reported as a CanaryFailure rather than hanging.
+func TestBakeFailsOnTimeout(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	mockECS := MockECS{
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{Status: aws.String(string(types.ContainerInstanceStatusRegistering))}},
+			}, nil
+		},
+	}
+	u := &updater{cluster: "test-cluster", ecs: mockECS}
+	s := &updateSupervisor{updater: u}
+	canaries := []instance{{instanceID: "i-1", containerInstanceID: "ci-1", targetVersion: "v2.0.0"}}
+
+	failures := s.bake(context.Background(), canaries, 10*time.Millisecond)
+	require.Len(t, failures, 1)
+	assert.Equal(t, "i-1", failures[0].InstanceID)
+	assert.Contains(t, failures[0].Reason, "timed out")
+}
+
+// TestRunCanaryPromotesToFleetOnSuccess asserts that once the canaries
+// update and bake successfully, the remainder of the fleet is updated too.
+func TestRunCanaryPromotesToFleetOnSuccess(t *testing.T) {
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{Status: aws.String(string(types.ContainerInstanceStatusActive))}},
+			}, nil
+		},
+	}
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     4,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+		{instanceID: "i-3", containerInstanceID: "ci-3", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+	}
+
+	summary, err := supervisor.runCanary(context.Background(), candidates, 3, 1, time.Second)
+	require.NoError(t, err)
+	assert.Len(t, summary, 3)
+	for _, c := range candidates {
+		assert.Equal(t, "Instance updated successfully", summary[c.instanceID])
+	}
+}
+
+// TestRunCanaryDryRunSkipsBake asserts that a dry run reports the whole
+// fleet's plan without polling canaries for bakeDuration, since nothing was
+// actually updated for canaryHealthy to ever observe.
+func TestRunCanaryDryRunSkipsBake(t *testing.T) {
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			t.Fatal("dry run must not poll canary health")
+			return nil, nil
+		},
+	}
+	u := &updater{
+		cluster: "test-cluster",
+		ecs:     mockECS,
+		dryRun:  true,
+		plan:    &UpdatePlan{},
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     2,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+	}
+
+	summary, err := supervisor.runCanary(context.Background(), candidates, 2, 1, time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, summary, 2)
+	assert.Len(t, u.plan.Entries, 2)
+}
+
+// TestRunCanaryAbortsFleetWhenCanaryFailsToBake asserts that a canary which
+// never becomes healthy stops the rollout before any other instance updates.
+func TestRunCanaryAbortsFleetWhenCanaryFailsToBake(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	remainderTouched := false
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			if input.Status == types.ContainerInstanceStatusDraining && input.ContainerInstances[0] != "ci-1" {
+				remainderTouched = true
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			// The canary's container instance never re-registers ACTIVE.
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{Status: aws.String(string(types.ContainerInstanceStatusRegistering))}},
+			}, nil
+		},
+	}
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     4,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+		updateOrder:     updateOrderByAZ, // keep dispatch order deterministic (all empty AZs, so original order)
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0", targetVersion: "v9.9.9"},
+	}
+
+	_, err := supervisor.runCanary(context.Background(), candidates, 2, 1, 10*time.Millisecond)
+	require.Error(t, err)
+	var canaryErr *CanaryFailedError
+	require.ErrorAs(t, err, &canaryErr)
+	require.Len(t, canaryErr.Failures, 1)
+	assert.Equal(t, "i-1", canaryErr.Failures[0].InstanceID)
+	assert.False(t, remainderTouched, "the rest of the fleet must not be drained when a canary fails to bake")
+}
+
+// TestCanaryFailedErrorMessageListsFailures asserts the error's message is
+// structured enough to identify every failing instance and its reason.
+func TestCanaryFailedErrorMessageListsFailures(t *testing.T) {
+	err := &CanaryFailedError{Failures: []CanaryFailure{
+		{InstanceID: "i-1", ContainerInstanceID: "ci-1", Reason: "timed out after 1s"},
+	}}
+	assert.Equal(t, fmt.Sprintf("1 canary instance(s) failed to bake: i-1 (ci-1): timed out after 1s;"), err.Error())
+	assert.True(t, errors.As(error(err), new(*CanaryFailedError)))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// dryRunEnv puts the updater into planning mode when set to a truthy value.
+	dryRunEnv = "DRY_RUN"
+	// dryRunOutputS3Env, when set to an s3://bucket/key URI, additionally
+	// uploads the plan there after it's printed to stdout.
+	dryRunOutputS3Env = "DRY_RUN_OUTPUT_S3"
+)
+
+// S3API is the subset of the S3 API used to upload the dry-run plan and to
+// fetch an UpdatePolicyDocument.
+type S3API interface {
+	PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// planEntry records what the updater would have done for one instance had it
+// not been running in dry-run mode.
+type planEntry struct {
+	ContainerInstanceID string `json:"container_instance_id"`
+	EC2InstanceID       string `json:"ec2_instance_id"`
+	CurrentVersion      string `json:"current_version,omitempty"`
+	TargetVersion       string `json:"target_version,omitempty"`
+	BlockingReason      string `json:"blocking_reason,omitempty"`
+}
+
+// UpdatePlan accumulates planEntry records during a dry run. It's safe for
+// concurrent use since the update supervisor may update several instances'
+// entries at once.
+type UpdatePlan struct {
+	mu      sync.Mutex
+	Entries []planEntry `json:"entries"`
+}
+
+func (p *UpdatePlan) add(e planEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Entries = append(p.Entries, e)
+}
+
+// marshal serializes the plan as indented JSON.
+func (p *UpdatePlan) marshal() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// report writes the plan to stdout and, if DRY_RUN_OUTPUT_S3 is set, uploads
+// it to the referenced S3 object.
+func (p *UpdatePlan) report(ctx context.Context, s3Client S3API) error {
+	body, err := p.marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal update plan: %w", err)
+	}
+	fmt.Println(string(body))
+
+	dest := os.Getenv(dryRunOutputS3Env)
+	if dest == "" {
+		return nil
+	}
+	bucket, key, err := parseS3URI(dest)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", dryRunOutputS3Env, dest, err)
+	}
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload update plan to %q: %w", dest, err)
+	}
+	log.Printf("Uploaded update plan to %q", dest)
+	return nil
+}
+
+// parseS3URI splits an s3://bucket/key URI into its bucket and key.
+func parseS3URI(uri string) (bucket, key string, err error) {
+	const scheme = "s3://"
+	if !strings.HasPrefix(uri, scheme) {
+		return "", "", fmt.Errorf("must start with %q", scheme)
+	}
+	rest := strings.TrimPrefix(uri, scheme)
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("must be of the form s3://bucket/key")
+	}
+	return parts[0], parts[1], nil
+}
+
+// dryRunEnabled reports whether DRY_RUN is set to a truthy value.
+func dryRunEnabled() bool {
+	allow, _ := parseBool(os.Getenv(dryRunEnv))
+	return allow
+}
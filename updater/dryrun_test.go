@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseS3URI(t *testing.T) {
+	bucket, key, err := parseS3URI("s3://my-bucket/path/to/plan.json")
+	require.NoError(t, err)
+	assert.Equal(t, "my-bucket", bucket)
+	assert.Equal(t, "path/to/plan.json", key)
+
+	_, _, err = parseS3URI("https://my-bucket/plan.json")
+	assert.Error(t, err)
+
+	_, _, err = parseS3URI("s3://my-bucket")
+	assert.Error(t, err)
+}
+
+func TestUpdatePlanReportSkipsUploadWithoutS3Dest(t *testing.T) {
+	os.Unsetenv(dryRunOutputS3Env)
+	plan := &UpdatePlan{}
+	plan.add(planEntry{ContainerInstanceID: "ci-1", EC2InstanceID: "i-1", CurrentVersion: "1.0.0", TargetVersion: "1.1.0"})
+	require.NoError(t, plan.report(context.Background(), MockS3{}))
+}
+
+func TestUpdatePlanReportUploadsToS3(t *testing.T) {
+	require.NoError(t, os.Setenv(dryRunOutputS3Env, "s3://my-bucket/plan.json"))
+	defer os.Unsetenv(dryRunOutputS3Env)
+
+	var uploaded *s3.PutObjectInput
+	mockS3 := MockS3{
+		PutObjectFn: func(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			uploaded = input
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	plan := &UpdatePlan{}
+	plan.add(planEntry{ContainerInstanceID: "ci-1", BlockingReason: "not eligible"})
+	require.NoError(t, plan.report(context.Background(), mockS3))
+
+	require.NotNil(t, uploaded)
+	assert.Equal(t, "my-bucket", aws.ToString(uploaded.Bucket))
+	assert.Equal(t, "plan.json", aws.ToString(uploaded.Key))
+}
+
+func TestDryRunEnabled(t *testing.T) {
+	os.Unsetenv(dryRunEnv)
+	assert.False(t, dryRunEnabled())
+
+	require.NoError(t, os.Setenv(dryRunEnv, "true"))
+	defer os.Unsetenv(dryRunEnv)
+	assert.True(t, dryRunEnabled())
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	eligibilityPolicyServiceStarted  = "service-started"
+	eligibilityPolicyTagAware        = "tag-aware"
+	eligibilityPolicySchedulingAware = "scheduling-aware"
+	defaultEligibilityPolicy         = eligibilityPolicyServiceStarted
+	drainSafeTagKey                  = "bottlerocket.updater/drain-safe"
+	drainSafeTagValue                = "true"
+	serviceGroupPrefix               = "service:"
+)
+
+// EligibilityPolicy decides whether a single task running on a container
+// instance permits that instance to be drained for an update. A task that
+// doesn't permit the drain makes the whole container instance ineligible.
+type EligibilityPolicy interface {
+	// Eligible reports whether task, running on containerInstance, permits
+	// the instance to be drained.
+	Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error)
+}
+
+// newEligibilityPolicy resolves the -eligibility-policy flag value to an
+// EligibilityPolicy. An empty name resolves to defaultEligibilityPolicy.
+func newEligibilityPolicy(name string) (EligibilityPolicy, error) {
+	switch name {
+	case "", eligibilityPolicyServiceStarted:
+		return ServiceStartedPolicy{}, nil
+	case eligibilityPolicyTagAware:
+		return AnyOf{ServiceStartedPolicy{}, TagBasedPolicy{}}, nil
+	case eligibilityPolicySchedulingAware:
+		return AllOf{AnyOf{ServiceStartedPolicy{}, TagBasedPolicy{}}, SchedulingStrategyPolicy{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown eligibility policy %q", name)
+	}
+}
+
+// ServiceStartedPolicy is the updater's original eligibility rule: a task
+// permits the drain only if it was started by an ECS service.
+type ServiceStartedPolicy struct{}
+
+// Eligible implements EligibilityPolicy.
+func (ServiceStartedPolicy) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	return strings.HasPrefix(aws.ToString(task.StartedBy), "ecs-svc/"), nil
+}
+
+// TagBasedPolicy permits the drain for any task (or task definition) tagged
+// bottlerocket.updater/drain-safe=true, regardless of how it was started.
+type TagBasedPolicy struct{}
+
+// Eligible implements EligibilityPolicy.
+func (TagBasedPolicy) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	taskTagged, err := u.resourceTaggedDrainSafe(ctx, aws.ToString(task.TaskArn))
+	if err != nil {
+		return false, fmt.Errorf("failed to list tags for task: %w", err)
+	}
+	if taskTagged {
+		return true, nil
+	}
+	tdTagged, err := u.resourceTaggedDrainSafe(ctx, aws.ToString(task.TaskDefinitionArn))
+	if err != nil {
+		return false, fmt.Errorf("failed to list tags for task definition: %w", err)
+	}
+	return tdTagged, nil
+}
+
+// resourceTaggedDrainSafe reports whether resourceArn carries the
+// bottlerocket.updater/drain-safe=true tag.
+func (u *updater) resourceTaggedDrainSafe(ctx context.Context, resourceArn string) (bool, error) {
+	var out *ecs.ListTagsForResourceOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		out, err = u.ecs.ListTagsForResource(ctx, &ecs.ListTagsForResourceInput{
+			ResourceArn: aws.String(resourceArn),
+		})
+		return err
+	}, u.policy())
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range out.Tags {
+		if aws.ToString(tag.Key) == drainSafeTagKey && aws.ToString(tag.Value) == drainSafeTagValue {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SchedulingStrategyPolicy permits the drain based on the scheduling
+// strategy of the service a task belongs to: DAEMON tasks never block,
+// since the daemon task is expected to run on every instance already, but a
+// REPLICA service with only a single desired task always blocks, since
+// draining its only instance would take the service fully offline.
+// Standalone tasks, which aren't part of any service, defer entirely to
+// other policies by never blocking.
+type SchedulingStrategyPolicy struct{}
+
+// Eligible implements EligibilityPolicy.
+func (SchedulingStrategyPolicy) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	group := aws.ToString(task.Group)
+	if !strings.HasPrefix(group, serviceGroupPrefix) {
+		return true, nil
+	}
+	serviceName := strings.TrimPrefix(group, serviceGroupPrefix)
+
+	var desc *ecs.DescribeServicesOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		desc, err = u.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  &u.cluster,
+			Services: []string{serviceName},
+		})
+		return err
+	}, u.policy())
+	if err != nil {
+		return false, fmt.Errorf("failed to describe service %q: %w", serviceName, err)
+	}
+	if len(desc.Services) == 0 {
+		return true, nil
+	}
+	service := desc.Services[0]
+	if service.SchedulingStrategy == types.SchedulingStrategyDaemon {
+		return true, nil
+	}
+	return service.DesiredCount != 1, nil
+}
+
+// AllOf is an EligibilityPolicy that permits the drain only if every
+// underlying policy permits it.
+type AllOf []EligibilityPolicy
+
+// Eligible implements EligibilityPolicy.
+func (a AllOf) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	for _, policy := range a {
+		ok, err := policy.Eligible(ctx, u, containerInstance, task)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AnyOf is an EligibilityPolicy that permits the drain if any underlying
+// policy permits it.
+type AnyOf []EligibilityPolicy
+
+// Eligible implements EligibilityPolicy.
+func (a AnyOf) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	for _, policy := range a {
+		ok, err := policy.Eligible(ctx, u, containerInstance, task)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceStartedPolicy(t *testing.T) {
+	cases := []struct {
+		name       string
+		task       types.Task
+		expectedOk bool
+	}{
+		{
+			name:       "started by service",
+			task:       types.Task{StartedBy: aws.String("ecs-svc/svc-id")},
+			expectedOk: true,
+		}, {
+			name:       "standalone task",
+			task:       types.Task{StartedBy: aws.String("standalone-task-id")},
+			expectedOk: false,
+		}, {
+			name:       "empty StartedBy",
+			task:       types.Task{},
+			expectedOk: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &updater{}
+			ok, err := ServiceStartedPolicy{}.Eligible(context.Background(), u, "cont-inst-id", tc.task)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+}
+
+func TestTagBasedPolicy(t *testing.T) {
+	cases := []struct {
+		name        string
+		taskTags    []types.Tag
+		taskDefTags []types.Tag
+		expectedOk  bool
+	}{
+		{
+			name:       "task tagged drain-safe",
+			taskTags:   []types.Tag{{Key: aws.String(drainSafeTagKey), Value: aws.String(drainSafeTagValue)}},
+			expectedOk: true,
+		}, {
+			name:        "task definition tagged drain-safe",
+			taskDefTags: []types.Tag{{Key: aws.String(drainSafeTagKey), Value: aws.String(drainSafeTagValue)}},
+			expectedOk:  true,
+		}, {
+			name:       "tagged with unrelated value",
+			taskTags:   []types.Tag{{Key: aws.String(drainSafeTagKey), Value: aws.String("false")}},
+			expectedOk: false,
+		}, {
+			name:       "untagged",
+			expectedOk: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockECS := MockECS{
+				ListTagsForResourceFn: func(ctx context.Context, input *ecs.ListTagsForResourceInput, optFns ...func(*ecs.Options)) (*ecs.ListTagsForResourceOutput, error) {
+					switch aws.ToString(input.ResourceArn) {
+					case "task-arn-1":
+						return &ecs.ListTagsForResourceOutput{Tags: tc.taskTags}, nil
+					case "task-def-arn-1":
+						return &ecs.ListTagsForResourceOutput{Tags: tc.taskDefTags}, nil
+					default:
+						t.Fatalf("unexpected resource arn %q", aws.ToString(input.ResourceArn))
+						return nil, nil
+					}
+				},
+			}
+			u := &updater{ecs: mockECS}
+			task := types.Task{TaskArn: aws.String("task-arn-1"), TaskDefinitionArn: aws.String("task-def-arn-1")}
+			ok, err := TagBasedPolicy{}.Eligible(context.Background(), u, "cont-inst-id", task)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+}
+
+func TestTagBasedPolicyErr(t *testing.T) {
+	listErr := errors.New("failed to list tags")
+	mockECS := MockECS{
+		ListTagsForResourceFn: func(ctx context.Context, input *ecs.ListTagsForResourceInput, optFns ...func(*ecs.Options)) (*ecs.ListTagsForResourceOutput, error) {
+			return nil, listErr
+		},
+	}
+	u := &updater{ecs: mockECS}
+	task := types.Task{TaskArn: aws.String("task-arn-1"), TaskDefinitionArn: aws.String("task-def-arn-1")}
+	ok, err := TagBasedPolicy{}.Eligible(context.Background(), u, "cont-inst-id", task)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, listErr)
+	assert.False(t, ok)
+}
+
+func TestSchedulingStrategyPolicy(t *testing.T) {
+	cases := []struct {
+		name        string
+		task        types.Task
+		describeOut *ecs.DescribeServicesOutput
+		expectedOk  bool
+	}{
+		{
+			name:       "standalone task",
+			task:       types.Task{},
+			expectedOk: true,
+		}, {
+			name: "daemon service",
+			task: types.Task{Group: aws.String("service:svc-name")},
+			describeOut: &ecs.DescribeServicesOutput{
+				Services: []types.Service{{SchedulingStrategy: types.SchedulingStrategyDaemon, DesiredCount: 1}},
+			},
+			expectedOk: true,
+		}, {
+			name: "single replica service",
+			task: types.Task{Group: aws.String("service:svc-name")},
+			describeOut: &ecs.DescribeServicesOutput{
+				Services: []types.Service{{SchedulingStrategy: types.SchedulingStrategyReplica, DesiredCount: 1}},
+			},
+			expectedOk: false,
+		}, {
+			name: "multi replica service",
+			task: types.Task{Group: aws.String("service:svc-name")},
+			describeOut: &ecs.DescribeServicesOutput{
+				Services: []types.Service{{SchedulingStrategy: types.SchedulingStrategyReplica, DesiredCount: 3}},
+			},
+			expectedOk: true,
+		}, {
+			name: "service not found",
+			task: types.Task{Group: aws.String("service:svc-name")},
+			describeOut: &ecs.DescribeServicesOutput{
+				Services: []types.Service{},
+			},
+			expectedOk: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockECS := MockECS{
+				DescribeServicesFn: func(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+					assert.Equal(t, "test-cluster", aws.ToString(input.Cluster))
+					assert.Equal(t, []string{"svc-name"}, input.Services)
+					return tc.describeOut, nil
+				},
+			}
+			u := &updater{ecs: mockECS, cluster: "test-cluster"}
+			ok, err := SchedulingStrategyPolicy{}.Eligible(context.Background(), u, "cont-inst-id", tc.task)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+}
+
+func TestSchedulingStrategyPolicyErr(t *testing.T) {
+	describeErr := errors.New("failed to describe services")
+	mockECS := MockECS{
+		DescribeServicesFn: func(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+			return nil, describeErr
+		},
+	}
+	u := &updater{ecs: mockECS, cluster: "test-cluster"}
+	ok, err := SchedulingStrategyPolicy{}.Eligible(context.Background(), u, "cont-inst-id", types.Task{Group: aws.String("service:svc-name")})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, describeErr)
+	assert.False(t, ok)
+}
+
+type fixedPolicy bool
+
+func (f fixedPolicy) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	return bool(f), nil
+}
+
+type errPolicy struct{ err error }
+
+func (e errPolicy) Eligible(ctx context.Context, u *updater, containerInstance string, task types.Task) (bool, error) {
+	return false, e.err
+}
+
+func TestAllOf(t *testing.T) {
+	cases := []struct {
+		name       string
+		policies   AllOf
+		expectedOk bool
+	}{
+		{name: "all true", policies: AllOf{fixedPolicy(true), fixedPolicy(true)}, expectedOk: true},
+		{name: "one false", policies: AllOf{fixedPolicy(true), fixedPolicy(false)}, expectedOk: false},
+		{name: "empty", policies: AllOf{}, expectedOk: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := tc.policies.Eligible(context.Background(), &updater{}, "cont-inst-id", types.Task{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+
+	t.Run("error short-circuits", func(t *testing.T) {
+		wantErr := errors.New("boom")
+		policies := AllOf{errPolicy{wantErr}, fixedPolicy(true)}
+		ok, err := policies.Eligible(context.Background(), &updater{}, "cont-inst-id", types.Task{})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, wantErr)
+		assert.False(t, ok)
+	})
+}
+
+func TestAnyOf(t *testing.T) {
+	cases := []struct {
+		name       string
+		policies   AnyOf
+		expectedOk bool
+	}{
+		{name: "one true", policies: AnyOf{fixedPolicy(false), fixedPolicy(true)}, expectedOk: true},
+		{name: "all false", policies: AnyOf{fixedPolicy(false), fixedPolicy(false)}, expectedOk: false},
+		{name: "empty", policies: AnyOf{}, expectedOk: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := tc.policies.Eligible(context.Background(), &updater{}, "cont-inst-id", types.Task{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+
+	t.Run("error short-circuits", func(t *testing.T) {
+		wantErr := errors.New("boom")
+		policies := AnyOf{errPolicy{wantErr}, fixedPolicy(true)}
+		ok, err := policies.Eligible(context.Background(), &updater{}, "cont-inst-id", types.Task{})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, wantErr)
+		assert.False(t, ok)
+	})
+}
+
+func TestNewEligibilityPolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		flagVal  string
+		wantType EligibilityPolicy
+	}{
+		{name: "empty defaults to service-started", flagVal: "", wantType: ServiceStartedPolicy{}},
+		{name: "service-started", flagVal: eligibilityPolicyServiceStarted, wantType: ServiceStartedPolicy{}},
+		{name: "tag-aware", flagVal: eligibilityPolicyTagAware, wantType: AnyOf{ServiceStartedPolicy{}, TagBasedPolicy{}}},
+		{name: "scheduling-aware", flagVal: eligibilityPolicySchedulingAware, wantType: AllOf{AnyOf{ServiceStartedPolicy{}, TagBasedPolicy{}}, SchedulingStrategyPolicy{}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := newEligibilityPolicy(tc.flagVal)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantType, policy)
+		})
+	}
+
+	t.Run("unknown policy", func(t *testing.T) {
+		_, err := newEligibilityPolicy("bogus")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// updateEventTopicArnEnv names the environment variable holding the SNS topic
+// ARN that update lifecycle events are published to. When unset (and
+// -notification-topic-arn is also unset), no events are published to SNS.
+const updateEventTopicArnEnv = "UPDATE_EVENT_TOPIC_ARN"
+
+// updateEventBridgeBusEnv names the environment variable holding the
+// EventBridge event bus name (or ARN) that update lifecycle events are put
+// to, in addition to or instead of SNS. When unset (and -eventbridge-bus is
+// also unset), no events are put to EventBridge.
+const updateEventBridgeBusEnv = "UPDATE_EVENTBRIDGE_BUS"
+
+// updateEventSource is the Source field every event this updater puts to
+// EventBridge carries, so rules can match on it.
+const updateEventSource = "bottlerocket-ecs-updater"
+
+type updateEventStatus string
+
+const (
+	eventUpdateStarted              updateEventStatus = "UpdateStarted"
+	eventInstanceDrained            updateEventStatus = "InstanceDrained"
+	eventUpdateApplied              updateEventStatus = "UpdateApplied"
+	eventUpdateVerified             updateEventStatus = "UpdateVerified"
+	eventUpdateFailed               updateEventStatus = "UpdateFailed"
+	eventInstanceReactivationFailed updateEventStatus = "InstanceReactivationFailed"
+	eventRunSummary                 updateEventStatus = "RunSummary"
+)
+
+// updateEvent describes a single transition in an instance's update
+// lifecycle, or (for eventRunSummary) the aggregate result of a whole run.
+// It is marshaled to JSON and published to SNS and/or EventBridge so that
+// operators can forward it to webhooks, Slack, or their own notification
+// pipeline.
+type updateEvent struct {
+	Cluster             string            `json:"cluster"`
+	ContainerInstanceID string            `json:"container_instance_id,omitempty"`
+	EC2InstanceID       string            `json:"ec2_instance_id,omitempty"`
+	FromVersion         string            `json:"from_version,omitempty"`
+	ToVersion           string            `json:"to_version,omitempty"`
+	SSMCommandID        string            `json:"ssm_command_id,omitempty"`
+	Status              updateEventStatus `json:"status"`
+	Timestamp           time.Time         `json:"timestamp"`
+	ErrorMessage        string            `json:"error_message,omitempty"`
+	// TotalInstances, SucceededInstances, and FailedInstances are only set on
+	// an eventRunSummary event.
+	TotalInstances     int `json:"total_instances,omitempty"`
+	SucceededInstances int `json:"succeeded_instances,omitempty"`
+	FailedInstances    int `json:"failed_instances,omitempty"`
+}
+
+// SNSAPI is the subset of the SNS API used to publish update lifecycle events.
+type SNSAPI interface {
+	Publish(ctx context.Context, input *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// EventBridgeAPI is the subset of the EventBridge API used to put update
+// lifecycle events.
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, input *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// EventPublisher publishes update lifecycle events for external consumers.
+type EventPublisher interface {
+	Publish(ctx context.Context, e updateEvent)
+}
+
+// noopEventPublisher discards events; used when neither an SNS topic ARN nor
+// an EventBridge bus is configured.
+type noopEventPublisher struct{}
+
+func (noopEventPublisher) Publish(context.Context, updateEvent) {}
+
+// snsEventPublisher marshals events to JSON and publishes them to an SNS topic.
+type snsEventPublisher struct {
+	sns      SNSAPI
+	topicArn string
+}
+
+// eventBridgeEventPublisher marshals events to JSON and puts them to an
+// EventBridge bus as the Detail of an updateEventSource entry.
+type eventBridgeEventPublisher struct {
+	eventBridge EventBridgeAPI
+	bus         string
+}
+
+// multiEventPublisher fans each event out to every configured publisher.
+type multiEventPublisher struct {
+	publishers []EventPublisher
+}
+
+func (m *multiEventPublisher) Publish(ctx context.Context, e updateEvent) {
+	for _, p := range m.publishers {
+		p.Publish(ctx, e)
+	}
+}
+
+// newEventPublisher returns an EventPublisher that publishes to topicArn via
+// SNS (if set) and/or to eventBridgeBus via EventBridge (if set), or a no-op
+// publisher if both are empty.
+func newEventPublisher(snsClient SNSAPI, eventBridgeClient EventBridgeAPI, topicArn, eventBridgeBus string) EventPublisher {
+	var publishers []EventPublisher
+	if topicArn != "" {
+		publishers = append(publishers, &snsEventPublisher{sns: snsClient, topicArn: topicArn})
+	}
+	if eventBridgeBus != "" {
+		publishers = append(publishers, &eventBridgeEventPublisher{eventBridge: eventBridgeClient, bus: eventBridgeBus})
+	}
+	if len(publishers) == 0 {
+		return noopEventPublisher{}
+	}
+	if len(publishers) == 1 {
+		return publishers[0]
+	}
+	return &multiEventPublisher{publishers: publishers}
+}
+
+// publish emits e through u.events, tolerating updaters built without one
+// (e.g. in tests that don't exercise event publishing).
+func (u *updater) publish(ctx context.Context, e updateEvent) {
+	if u.events == nil {
+		return
+	}
+	u.events.Publish(ctx, e)
+}
+
+func (p *snsEventPublisher) Publish(ctx context.Context, e updateEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to marshal update event %q for instance %q: %v", e.Status, e.ContainerInstanceID, err)
+		return
+	}
+	_, err = p.sns.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicArn),
+		Message:  aws.String(string(body)),
+	})
+	if err != nil {
+		log.Printf("Failed to publish update event %q for instance %q to topic %q: %v", e.Status, e.ContainerInstanceID, p.topicArn, err)
+	}
+}
+
+func (p *eventBridgeEventPublisher) Publish(ctx context.Context, e updateEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to marshal update event %q for instance %q: %v", e.Status, e.ContainerInstanceID, err)
+		return
+	}
+	_, err = p.eventBridge.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []eventbridgetypes.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(p.bus),
+				Source:       aws.String(updateEventSource),
+				DetailType:   aws.String(string(e.Status)),
+				Detail:       aws.String(string(body)),
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to put update event %q for instance %q to EventBridge bus %q: %v", e.Status, e.ContainerInstanceID, p.bus, err)
+	}
+}
+
+// notificationTopicArn resolves the SNS topic ARN to publish update
+// lifecycle events to: the -notification-topic-arn flag if set, otherwise
+// the UPDATE_EVENT_TOPIC_ARN environment variable.
+func notificationTopicArn(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(updateEventTopicArnEnv)
+}
+
+// notificationEventBridgeBus resolves the EventBridge bus to put update
+// lifecycle events to: the -eventbridge-bus flag if set, otherwise the
+// UPDATE_EVENTBRIDGE_BUS environment variable.
+func notificationEventBridgeBus(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(updateEventBridgeBusEnv)
+}
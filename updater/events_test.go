@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEventPublisherNoop(t *testing.T) {
+	publisher := newEventPublisher(MockSNS{}, MockEventBridge{}, "", "")
+	_, ok := publisher.(noopEventPublisher)
+	assert.True(t, ok, "expected a no-op publisher when neither a topic ARN nor an EventBridge bus is set")
+	// Should not panic even without a backing client.
+	publisher.Publish(context.Background(), updateEvent{Status: eventUpdateStarted})
+}
+
+func TestSNSEventPublisherPublish(t *testing.T) {
+	var published *sns.PublishInput
+	mockSNS := MockSNS{
+		PublishFn: func(ctx context.Context, input *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+			published = input
+			return &sns.PublishOutput{}, nil
+		},
+	}
+	publisher := newEventPublisher(mockSNS, MockEventBridge{}, "arn:aws:sns:us-west-2:1234567:updates", "")
+	_, ok := publisher.(*snsEventPublisher)
+	require.True(t, ok, "expected an SNS-backed publisher when a topic ARN is set")
+
+	publisher.Publish(context.Background(), updateEvent{
+		Cluster:             "my-cluster",
+		ContainerInstanceID: "cont-inst-1",
+		EC2InstanceID:       "inst-id-1",
+		FromVersion:         "1.0.0",
+		ToVersion:           "1.1.0",
+		Status:              eventUpdateVerified,
+	})
+
+	require.NotNil(t, published)
+	assert.Equal(t, "arn:aws:sns:us-west-2:1234567:updates", aws.ToString(published.TopicArn))
+
+	var got updateEvent
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(published.Message)), &got))
+	assert.Equal(t, "my-cluster", got.Cluster)
+	assert.Equal(t, eventUpdateVerified, got.Status)
+	assert.Equal(t, "1.1.0", got.ToVersion)
+}
+
+func TestEventBridgeEventPublisherPublish(t *testing.T) {
+	var put *eventbridge.PutEventsInput
+	mockEventBridge := MockEventBridge{
+		PutEventsFn: func(ctx context.Context, input *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+			put = input
+			return &eventbridge.PutEventsOutput{}, nil
+		},
+	}
+	publisher := newEventPublisher(MockSNS{}, mockEventBridge, "", "update-events")
+	_, ok := publisher.(*eventBridgeEventPublisher)
+	require.True(t, ok, "expected an EventBridge-backed publisher when a bus is set")
+
+	publisher.Publish(context.Background(), updateEvent{
+		Cluster: "my-cluster",
+		Status:  eventRunSummary,
+	})
+
+	require.NotNil(t, put)
+	require.Len(t, put.Entries, 1)
+	entry := put.Entries[0]
+	assert.Equal(t, "update-events", aws.ToString(entry.EventBusName))
+	assert.Equal(t, updateEventSource, aws.ToString(entry.Source))
+	assert.Equal(t, string(eventRunSummary), aws.ToString(entry.DetailType))
+
+	var got updateEvent
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(entry.Detail)), &got))
+	assert.Equal(t, "my-cluster", got.Cluster)
+	assert.Equal(t, eventRunSummary, got.Status)
+}
+
+func TestNewEventPublisherMultiFansOutToBoth(t *testing.T) {
+	publisher := newEventPublisher(MockSNS{}, MockEventBridge{}, "arn:aws:sns:us-west-2:1234567:updates", "update-events")
+	multi, ok := publisher.(*multiEventPublisher)
+	require.True(t, ok, "expected a multiEventPublisher when both a topic ARN and a bus are set")
+	require.Len(t, multi.publishers, 2)
+}
+
+func TestNotificationTopicArnFlagOverridesEnv(t *testing.T) {
+	require.NoError(t, os.Setenv(updateEventTopicArnEnv, "arn:aws:sns:us-west-2:1234567:env-topic"))
+	defer os.Unsetenv(updateEventTopicArnEnv)
+
+	assert.Equal(t, "arn:aws:sns:us-west-2:1234567:env-topic", notificationTopicArn(""))
+	assert.Equal(t, "arn:aws:sns:us-west-2:1234567:flag-topic", notificationTopicArn("arn:aws:sns:us-west-2:1234567:flag-topic"))
+}
+
+func TestNotificationEventBridgeBusFlagOverridesEnv(t *testing.T) {
+	require.NoError(t, os.Setenv(updateEventBridgeBusEnv, "env-bus"))
+	defer os.Unsetenv(updateEventBridgeBusEnv)
+
+	assert.Equal(t, "env-bus", notificationEventBridgeBus(""))
+	assert.Equal(t, "flag-bus", notificationEventBridgeBus("flag-bus"))
+}
+
+func TestUpdaterPublishToleratesNilPublisher(t *testing.T) {
+	u := &updater{}
+	// Should not panic when events is unset, as is the case in most existing tests.
+	u.publish(context.Background(), updateEvent{Status: eventUpdateStarted})
+}
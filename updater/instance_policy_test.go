@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceUpdateGate(t *testing.T) {
+	noon := time.Date(2026, 7, 30, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name        string
+		policy      string
+		window      string
+		now         time.Time
+		wantAllowed bool
+		wantReason  string
+	}{
+		{
+			name:        "unset policy allows",
+			now:         noon,
+			wantAllowed: true,
+		},
+		{
+			name:        "enabled allows",
+			policy:      instancePolicyEnabled,
+			now:         noon,
+			wantAllowed: true,
+		},
+		{
+			name:        "disabled blocks",
+			policy:      instancePolicyDisabled,
+			now:         noon,
+			wantAllowed: false,
+			wantReason:  "instance opted out via bottlerocket.updater/policy=disabled",
+		},
+		{
+			name:        "maintenance window inside allows",
+			policy:      instancePolicyMaintenanceWindow,
+			window:      "09:00-17:00",
+			now:         noon,
+			wantAllowed: true,
+		},
+		{
+			name:        "maintenance window outside blocks",
+			policy:      instancePolicyMaintenanceWindow,
+			window:      "09:00-17:00",
+			now:         time.Date(2026, 7, 30, 20, 0, 0, 0, time.UTC),
+			wantAllowed: false,
+			wantReason:  "outside instance maintenance window 09:00-17:00",
+		},
+		{
+			name:        "maintenance window with invalid attribute blocks",
+			policy:      instancePolicyMaintenanceWindow,
+			window:      "garbage",
+			now:         noon,
+			wantAllowed: false,
+			wantReason:  `invalid bottlerocket.updater/window attribute "garbage": time range "garbage" must be "HH:MM-HH:MM"`,
+		},
+		{
+			name:        "unknown policy blocks",
+			policy:      "some-other-value",
+			now:         noon,
+			wantAllowed: false,
+			wantReason:  `unknown bottlerocket.updater/policy attribute "some-other-value"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			i := instance{updatePolicy: tc.policy, updateWindow: tc.window}
+			allowed, reason := instanceUpdateGate(i, tc.now)
+			assert.Equal(t, tc.wantAllowed, allowed)
+			assert.Equal(t, tc.wantReason, reason)
+		})
+	}
+}
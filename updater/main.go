@@ -1,40 +1,89 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/arn"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ecs"
-	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 var (
-	flagCluster = flag.String("cluster", "", "The short name or full Amazon Resource Name (ARN) of the cluster in which we will manage Bottlerocket instances.")
-	flagRegion  = flag.String("region", "", "The AWS Region in which cluster is running.")
-	flagCheck   = flag.String("check-document", "", "The SSM document name for checking available updates.")
-	flagApply   = flag.String("apply-document", "", "The SSM document name for applying updates.")
-	flagReboot  = flag.String("reboot-document", "", "The SSM document name to initiate a reboot.")
+	flagCluster                 = flag.String("cluster", "", "The short name or full Amazon Resource Name (ARN) of the cluster in which we will manage Bottlerocket instances.")
+	flagRegion                  = flag.String("region", "", "The AWS Region in which cluster is running.")
+	flagCheck                   = flag.String("check-document", "", "The SSM document name for checking available updates.")
+	flagApply                   = flag.String("apply-document", "", "The SSM document name for applying updates.")
+	flagReboot                  = flag.String("reboot-document", "", "The SSM document name to initiate a reboot.")
+	flagDryRun                  = flag.Bool("dry-run", false, "Report the actions the updater would take without changing any cluster state. Can also be enabled by setting DRY_RUN=true.")
+	flagUpdateMode              = flag.String("update-mode", updateModeReboot, fmt.Sprintf("How to apply updates: %q for a warm SSM-triggered reboot, or %q to power-cycle the instance via EC2 stop/start, for updates that require a full power cycle.", updateModeReboot, updateModeStopStart))
+	flagStrategy                = flag.String("strategy", strategyRolling, fmt.Sprintf("Rollout strategy: %q to update every eligible instance through the regular supervisor, or %q to update a small batch first and bake it before proceeding.", strategyRolling, strategyCanary))
+	flagCanaryCount             = flag.Int("canary-count", defaultCanaryCount, fmt.Sprintf("Number of instances to update as canaries before the rest of the fleet. Only used with -strategy=%s.", strategyCanary))
+	flagBakeDuration            = flag.Duration("bake-duration", defaultBakeDuration, fmt.Sprintf("How long to observe canaries before updating the rest of the fleet. Only used with -strategy=%s.", strategyCanary))
+	flagRollback                = flag.String("rollback-document", "", "The SSM document name to roll an instance back to its previous partition. If unset, instances are never health-checked or rolled back after updating.")
+	flagPostUpdateHealthTimeout = flag.Duration("post-update-health-timeout", defaultPostUpdateHealthTimeout, "How long to wait for an instance to become healthy after updating before rolling it back. Only used with -rollback-document set.")
+	flagEligibilityPolicy       = flag.String("eligibility-policy", defaultEligibilityPolicy, fmt.Sprintf("Policy for deciding whether a container instance's tasks permit draining it for an update: %q (default, task must be started by a service), %q (also permits tasks/task definitions tagged %s=%s), or %q (also blocks single-replica services regardless of how they were started).", eligibilityPolicyServiceStarted, eligibilityPolicyTagAware, drainSafeTagKey, drainSafeTagValue, eligibilityPolicySchedulingAware))
+	flagMaxParallel             = flag.Int("max-parallel", 0, fmt.Sprintf("Maximum number of instances to drain/update/verify concurrently. Overrides %s; if both are unset, defaults to %d.", updateParallelismEnv, defaultParallelism))
+	flagMaxUnavailable          = flag.String("max-unavailable", "", fmt.Sprintf(`Maximum number, or percentage (e.g. "20%%"), of the cluster's Bottlerocket instances that may be DRAINING or mid-update at once. Overrides %s; if both are unset, the cap is derived from drain headroom instead.`, updateMaxUnavailableEnv))
+	flagNotificationTopicArn    = flag.String("notification-topic-arn", "", fmt.Sprintf("SNS topic ARN to publish update lifecycle events to. Overrides %s.", updateEventTopicArnEnv))
+	flagEventBridgeBus          = flag.String("eventbridge-bus", "", fmt.Sprintf("EventBridge event bus name or ARN to put update lifecycle events to. Overrides %s. Can be set alongside -notification-topic-arn to publish to both.", updateEventBridgeBusEnv))
+	flagReportS3URI             = flag.String("report-s3-uri", "", "s3://bucket/prefix URI to upload a structured JSON run report to. The object key appends the cluster name and the run's finish time (RFC3339) to this prefix. Unset, no report is uploaded.")
+	flagMetricsNamespace        = flag.String("metrics-namespace", "", fmt.Sprintf("CloudWatch namespace to publish run metrics to (e.g. %q). Overrides %s. Unset, no metrics are published.", defaultMetricsNamespace, updateMetricsNamespaceEnv))
+	flagUpdatePolicyS3URI       = flag.String("update-policy-s3-uri", "", fmt.Sprintf("s3://bucket/key URI to load an update policy document from (pin/skip_versions/max_unavailable/canary/window rules per cluster or tag). Overrides %s.", updatePolicyS3URIEnv))
+	flagUpdatePolicySSMParam    = flag.String("update-policy-ssm-parameter", "", fmt.Sprintf("SSM parameter name to load an update policy document from instead. Overrides %s. If both this and -update-policy-s3-uri resolve to a value, the S3 URI wins.", updatePolicySSMParameterEnv))
 )
 
 const taskDefARNEnv = "TASK_DEFINITION_ARN"
 
 type updater struct {
-	cluster        string
-	checkDocument  string
-	applyDocument  string
-	rebootDocument string
-	ecs            ECSAPI
-	ssm            SSMAPI
-	ec2            EC2API
+	cluster                 string
+	checkDocument           string
+	applyDocument           string
+	rebootDocument          string
+	updateMode              string
+	ecs                     ECSAPI
+	ssm                     SSMAPI
+	ec2                     EC2API
+	events                  EventPublisher
+	backoffPolicy           BackoffPolicy
+	retryPolicy             RetryPolicy
+	ssmWaiterConfig         SSMWaiterConfig
+	versionPolicy           *VersionPolicy
+	maxConcurrentPages      int
+	ecsStateMu              sync.Mutex
+	strategy                string
+	canaryCount             int
+	bakeDuration            time.Duration
+	dryRun                  bool
+	plan                    *UpdatePlan
+	s3                      S3API
+	stateStore              StateStore
+	rollbackDocument        string
+	postUpdateHealthTimeout time.Duration
+	eligibilityPolicy       EligibilityPolicy
+	transitionsMu           sync.Mutex
+	transitionLog           map[string][]updateState
+	auditSink               AuditSink
+	metrics                 MetricsPublisher
+	// updatePolicy is the centrally-loaded policy document (see
+	// update_policy_document.go); nil when neither -update-policy-s3-uri
+	// nor -update-policy-ssm-parameter resolve to a value.
+	updatePolicy *UpdatePolicyDocument
 }
 
 func main() {
@@ -45,6 +94,7 @@ func main() {
 }
 
 func _main() error {
+	runStart := time.Now()
 	flag.Parse()
 	switch {
 	case *flagCluster == "":
@@ -62,28 +112,145 @@ func _main() error {
 	case *flagReboot == "":
 		flag.Usage()
 		return errors.New("reboot-document is required")
+	case *flagUpdateMode != updateModeReboot && *flagUpdateMode != updateModeStopStart:
+		flag.Usage()
+		return fmt.Errorf("update-mode must be %q or %q, got %q", updateModeReboot, updateModeStopStart, *flagUpdateMode)
+	case *flagStrategy != strategyRolling && *flagStrategy != strategyCanary:
+		flag.Usage()
+		return fmt.Errorf("strategy must be %q or %q, got %q", strategyRolling, strategyCanary, *flagStrategy)
+	case *flagStrategy == strategyCanary && *flagCanaryCount < 1:
+		flag.Usage()
+		return fmt.Errorf("canary-count must be at least 1, got %d", *flagCanaryCount)
+	case *flagStrategy == strategyCanary && *flagBakeDuration <= 0:
+		flag.Usage()
+		return fmt.Errorf("bake-duration must be positive, got %s", *flagBakeDuration)
+	case *flagRollback != "" && *flagPostUpdateHealthTimeout <= 0:
+		flag.Usage()
+		return fmt.Errorf("post-update-health-timeout must be positive, got %s", *flagPostUpdateHealthTimeout)
 	}
 
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(*flagRegion),
-	}))
+	ctx := context.Background()
+
+	eligibilityPolicy, err := newEligibilityPolicy(*flagEligibilityPolicy)
+	if err != nil {
+		flag.Usage()
+		return err
+	}
+
+	versionPolicy, err := newVersionPolicyFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid version policy configuration: %w", err)
+	}
+
+	ssmWaiterConfig, err := newSSMWaiterConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid SSM waiter configuration: %w", err)
+	}
+
+	auditSink, err := newAuditSinkFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid audit log configuration: %w", err)
+	}
+
+	maintenanceWindow, err := newMaintenanceWindowFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid maintenance window configuration: %w", err)
+	}
+
+	dryRun := *flagDryRun || dryRunEnabled()
+	if dryRun {
+		log.Printf("Running in dry-run mode: no cluster state will be changed")
+	} else if !maintenanceWindow.Allows(time.Now()) {
+		// Dry runs are exempt: they never mutate cluster state, so they're
+		// safe to schedule as frequently as an operator likes to observe
+		// drift, reserving the maintenance window for runs that actually
+		// apply updates. Checked before loading AWS configuration so a
+		// skipped run doesn't pay for credential resolution.
+		log.Printf("Outside maintenance window %s, skipping this run", maintenanceWindow)
+		return nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(*flagRegion))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
 
 	u := &updater{
-		cluster:        *flagCluster,
-		checkDocument:  *flagCheck,
-		applyDocument:  *flagApply,
-		rebootDocument: *flagReboot,
-		ecs:            ecs.New(sess, aws.NewConfig()),
-		ssm:            ssm.New(sess, aws.NewConfig()),
-		ec2:            ec2.New(sess, aws.NewConfig()),
+		cluster:                 *flagCluster,
+		checkDocument:           *flagCheck,
+		applyDocument:           *flagApply,
+		rebootDocument:          *flagReboot,
+		updateMode:              *flagUpdateMode,
+		ecs:                     ecs.NewFromConfig(cfg),
+		ssm:                     ssm.NewFromConfig(cfg),
+		ec2:                     ec2.NewFromConfig(cfg),
+		events:                  newEventPublisher(sns.NewFromConfig(cfg), eventbridge.NewFromConfig(cfg), notificationTopicArn(*flagNotificationTopicArn), notificationEventBridgeBus(*flagEventBridgeBus)),
+		backoffPolicy:           defaultBackoffPolicy,
+		retryPolicy:             defaultRetryPolicy,
+		ssmWaiterConfig:         ssmWaiterConfig,
+		versionPolicy:           versionPolicy,
+		maxConcurrentPages:      envInt(maxConcurrentPagesEnv, defaultMaxConcurrentPages),
+		strategy:                *flagStrategy,
+		canaryCount:             *flagCanaryCount,
+		bakeDuration:            *flagBakeDuration,
+		dryRun:                  dryRun,
+		plan:                    &UpdatePlan{},
+		s3:                      s3.NewFromConfig(cfg),
+		stateStore:              newStateStoreFromEnv(dynamodb.NewFromConfig(cfg)),
+		rollbackDocument:        *flagRollback,
+		postUpdateHealthTimeout: *flagPostUpdateHealthTimeout,
+		eligibilityPolicy:       eligibilityPolicy,
+		auditSink:               auditSink,
+		metrics:                 newMetricsPublisher(cloudwatch.NewFromConfig(cfg), metricsNamespace(*flagMetricsNamespace), *flagCluster),
+	}
+
+	updatePolicy, err := loadUpdatePolicyDocument(ctx, u.s3, u.ssm, updatePolicyS3URI(*flagUpdatePolicyS3URI), updatePolicySSMParameter(*flagUpdatePolicySSMParam))
+	if err != nil {
+		return fmt.Errorf("failed to load update policy document: %w", err)
+	}
+	u.updatePolicy = updatePolicy
+
+	if clusterRule := u.updatePolicy.ruleFor(u.cluster, nil); clusterRule.Canary != nil {
+		log.Printf("Update policy document requests the canary strategy for cluster %q: count=%d bake=%dm", u.cluster, clusterRule.Canary.Count, clusterRule.Canary.BakeMinutes)
+		u.strategy = strategyCanary
+		u.canaryCount = clusterRule.Canary.Count
+		u.bakeDuration = time.Duration(clusterRule.Canary.BakeMinutes) * time.Minute
 	}
 
+	// A second, policy-document-driven maintenance window gate. Unlike the
+	// UPDATE_MAINTENANCE_WINDOW gate above, this one necessarily runs after
+	// AWS configuration is loaded, since fetching the document itself
+	// requires S3/SSM access.
+	if !dryRun {
+		if window, ok := u.updatePolicy.ruleFor(u.cluster, nil).window(); ok && !window.Allows(time.Now()) {
+			log.Printf("Outside update policy document's maintenance window %s for cluster %q, skipping this run", window, u.cluster)
+			return nil
+		}
+	}
+
+	// Deferred so every return path below -- not just a clean run through the
+	// supervisor -- publishes a total wall-clock duration for the run.
+	defer func() {
+		u.publishMetric(ctx, metricRunDurationSeconds, time.Since(runStart).Seconds(), cloudwatchtypes.StandardUnitSeconds)
+	}()
+
+	// Deferred so every return path below -- not just a clean run through the
+	// supervisor -- flushes any buffered audit events (e.g. the already-running
+	// check or an early exit on zero instances) to S3.
+	defer func() {
+		if flusher, ok := u.auditSink.(auditFlusher); ok {
+			if err := flusher.flush(ctx, u.s3); err != nil {
+				log.Printf("Failed to flush audit log: %v", err)
+			}
+		}
+	}()
+
 	family, err := taskDefFamily()
 	if err != nil {
 		log.Printf("Failed to parse updater task definition arn: %v", err)
 		log.Printf("Ignoring check for already running updater")
 	} else {
-		ok, err := u.alreadyRunning(family)
+		ok, err := u.alreadyRunning(ctx, family)
 		if err != nil {
 			return fmt.Errorf("Cannot determine running updater tasks, therefore stopping this run to avoid risk of multiple runs: %w", err)
 		}
@@ -93,7 +260,7 @@ func _main() error {
 		}
 	}
 
-	listedInstances, err := u.listContainerInstances()
+	listedInstances, err := u.listContainerInstances(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to get container instances in cluster %q: %w", u.cluster, err)
 	}
@@ -102,7 +269,7 @@ func _main() error {
 		return nil
 	}
 
-	bottlerocketInstances, err := u.filterBottlerocketInstances(listedInstances)
+	bottlerocketInstances, err := u.filterBottlerocketInstances(ctx, listedInstances)
 	if err != nil {
 		return fmt.Errorf("Failed to filter Bottlerocket instances: %w", err)
 	}
@@ -111,7 +278,9 @@ func _main() error {
 		log.Printf("No Bottlerocket instances detected")
 		return nil
 	}
-	candidates, err := u.filterAvailableUpdates(bottlerocketInstances)
+	u.publishMetric(ctx, metricInstancesConsidered, float64(len(bottlerocketInstances)), cloudwatchtypes.StandardUnitCount)
+
+	candidates, err := u.filterAvailableUpdates(ctx, bottlerocketInstances)
 	if err != nil {
 		return fmt.Errorf("Failed to check updates: %w", err)
 	}
@@ -119,63 +288,42 @@ func _main() error {
 		log.Printf("No instances to update")
 		return nil
 	}
+	u.publishMetric(ctx, metricInstancesEligible, float64(len(candidates)), cloudwatchtypes.StandardUnitCount)
 	log.Printf("Instances ready for update: %#q", candidates)
 
-	summary := make(map[string]string)
-	for _, i := range candidates {
-		eligible, err := u.eligible(i.containerInstanceID)
-		if err != nil {
-			log.Printf("Failed to determine eligibility for update of instance %#q: %v", i, err)
-			summary[i.instanceID] = fmt.Sprintf("Failed to determine eligibility for update: %v", err)
-			continue
-		}
-		if !eligible {
-			log.Printf("Instance %#q is not eligible for updates because it contains non-service task", i)
-			summary[i.instanceID] = "Instance is not eligible for updates because it contains non-service task(s)"
-			continue
-		}
-		log.Printf("Instance %q is eligible for update", i)
-
-		err = u.drainInstance(i.containerInstanceID)
-		if err != nil {
-			log.Printf("Failed to drain instance %#q: %v", i, err)
-			summary[i.instanceID] = fmt.Sprintf("Failed to drain: %v", err)
-			continue
-		}
-		log.Printf("Instance %#q successfully drained!", i)
-
-		updateErr := u.updateInstance(i)
-		activateErr := u.activateInstance(i.containerInstanceID)
-		if updateErr != nil && activateErr != nil {
-			log.Printf("Failed to update instance %#q: %v", i, updateErr)
-			return fmt.Errorf("instance %#q failed to re-activate after failing to update: %w", i, activateErr)
-		} else if updateErr != nil {
-			log.Printf("Failed to update instance %#q: %v", i, updateErr)
-			summary[i.instanceID] = fmt.Sprintf("Failed to update: %v", updateErr)
-			continue
-		} else if activateErr != nil {
-			return fmt.Errorf("instance %#q failed to re-activate after update: %w", i, activateErr)
-		}
-
-		// Reboots are not immediate, and initiating an SSM command races with reboot. Add some
-		// sleep time to allow the reboot to progress before we verify update.
-		time.Sleep(20 * time.Second)
-		ok, err := u.verifyUpdate(i)
-		if err != nil {
-			log.Printf("Failed to verify update for instance %#q: %v", i, err)
-		}
-		if !ok {
-			log.Printf("Update failed for instance %#q", i)
-			summary[i.instanceID] = "Update failed"
-		} else {
-			log.Printf("Instance %#q updated successfully!", i)
-			summary[i.instanceID] = "Instance updated successfully"
-		}
+	supervisor, err := newUpdateSupervisor(u, *flagMaxParallel, *flagMaxUnavailable)
+	if err != nil {
+		flag.Usage()
+		return err
+	}
+	var summary map[string]string
+	if u.strategy == strategyCanary {
+		summary, err = supervisor.runCanary(ctx, candidates, len(bottlerocketInstances), u.canaryCount, u.bakeDuration)
+	} else {
+		summary, err = supervisor.run(ctx, candidates, len(bottlerocketInstances))
+	}
+	if err != nil {
+		log.Printf("Update run ended early: %v", err)
 	}
 	log.Printf("After action summary:")
 	for k, v := range summary {
 		log.Printf("%s: %s", k, v)
 	}
+
+	if *flagReportS3URI != "" {
+		report := newRunReport(*flagCluster, runStart, time.Now(), candidates, summary, err)
+		if reportErr := report.upload(ctx, u.s3, *flagReportS3URI); reportErr != nil {
+			log.Printf("Failed to upload run report: %v", reportErr)
+		}
+	}
+
+	if u.dryRun {
+		if err := u.plan.report(ctx, u.s3); err != nil {
+			return fmt.Errorf("failed to report update plan: %w", err)
+		}
+		return nil
+	}
+
 	log.Printf("Update operations complete!")
 	return nil
 }
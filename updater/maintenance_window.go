@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// updateMaintenanceWindowEnv names a daily window, in UTC, during which the
+// updater is permitted to touch cluster state. Outside it, a run logs and
+// exits before checking for or applying any updates. Unset, the updater runs
+// any time it's invoked, matching its historical behavior.
+//
+// The value is "HH:MM-HH:MM" for a window that applies every day, or
+// "Mon-Fri HH:MM-HH:MM" (or a comma list like "Mon,Wed,Fri HH:MM-HH:MM") to
+// additionally restrict it to specific days of the week. Times are 24-hour
+// UTC and the window must not cross midnight (end must be later than start
+// in the same day) -- split an overnight window into two UPDATE_* schedule
+// invocations instead.
+const updateMaintenanceWindowEnv = "UPDATE_MAINTENANCE_WINDOW"
+
+// weekdayNames orders abbreviated weekday names Monday-first, so "Mon-Fri"
+// can be resolved as a contiguous range; time.Weekday itself is Sunday-first.
+var weekdayNames = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// MaintenanceWindow restricts updates to a recurring daily UTC time range,
+// and optionally to a subset of days of the week.
+type MaintenanceWindow struct {
+	// days is nil when the window applies every day of the week.
+	days       map[time.Weekday]bool
+	startOfDay time.Duration
+	endOfDay   time.Duration
+	source     string
+}
+
+// newMaintenanceWindowFromEnv builds a MaintenanceWindow from
+// UPDATE_MAINTENANCE_WINDOW. Unset, it returns nil, and Allows on a nil
+// *MaintenanceWindow always reports true.
+func newMaintenanceWindowFromEnv() (*MaintenanceWindow, error) {
+	raw := strings.TrimSpace(envStringOrDefault(updateMaintenanceWindowEnv, ""))
+	if raw == "" {
+		return nil, nil
+	}
+	window, err := parseMaintenanceWindow(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", updateMaintenanceWindowEnv, raw, err)
+	}
+	return window, nil
+}
+
+// parseMaintenanceWindow parses either "HH:MM-HH:MM" or
+// "<days> HH:MM-HH:MM".
+func parseMaintenanceWindow(raw string) (*MaintenanceWindow, error) {
+	fields := strings.Fields(raw)
+	var daysField, timeField string
+	switch len(fields) {
+	case 1:
+		timeField = fields[0]
+	case 2:
+		daysField, timeField = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf(`expected "HH:MM-HH:MM" or "<days> HH:MM-HH:MM"`)
+	}
+
+	start, end, err := parseTimeRange(timeField)
+	if err != nil {
+		return nil, err
+	}
+
+	window := &MaintenanceWindow{startOfDay: start, endOfDay: end, source: raw}
+	if daysField != "" {
+		days, err := parseDays(daysField)
+		if err != nil {
+			return nil, err
+		}
+		window.days = days
+	}
+	return window, nil
+}
+
+// parseTimeRange parses "HH:MM-HH:MM" into the offsets from midnight it
+// spans, requiring end to fall later in the same day than start.
+func parseTimeRange(raw string) (start, end time.Duration, err error) {
+	parts := strings.SplitN(raw, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf(`time range %q must be "HH:MM-HH:MM"`, raw)
+	}
+	start, err = parseTimeOfDay(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = parseTimeOfDay(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("end time must be later than start time in %q; windows spanning midnight aren't supported", raw)
+	}
+	return start, end, nil
+}
+
+// parseTimeOfDay parses "HH:MM" into its offset from midnight.
+func parseTimeOfDay(raw string) (time.Duration, error) {
+	hh, mm, ok := strings.Cut(raw, ":")
+	if !ok {
+		return 0, fmt.Errorf(`time %q must be "HH:MM"`, raw)
+	}
+	hour, err := strconv.Atoi(hh)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour in %q", raw)
+	}
+	minute, err := strconv.Atoi(mm)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute in %q", raw)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// parseDays parses a day-of-week field: a single day ("Mon"), a comma list
+// ("Mon,Wed,Fri"), or a contiguous range ("Mon-Fri").
+func parseDays(raw string) (map[time.Weekday]bool, error) {
+	days := map[time.Weekday]bool{}
+	if strings.Contains(raw, "-") && !strings.Contains(raw, ",") {
+		parts := strings.SplitN(raw, "-", 2)
+		lo, err := weekdayIndex(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		hi, err := weekdayIndex(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if hi < lo {
+			return nil, fmt.Errorf("day range %q must run Monday-first (e.g. Mon-Fri), not wrap across the week", raw)
+		}
+		for i := lo; i <= hi; i++ {
+			days[dayFromIndex(i)] = true
+		}
+		return days, nil
+	}
+	for _, name := range strings.Split(raw, ",") {
+		i, err := weekdayIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		days[dayFromIndex(i)] = true
+	}
+	return days, nil
+}
+
+// weekdayIndex resolves an abbreviated weekday name to its Monday-first
+// index into weekdayNames.
+func weekdayIndex(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	for i, n := range weekdayNames {
+		if strings.EqualFold(n, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized day %q, expected one of %v", name, weekdayNames)
+}
+
+// dayFromIndex converts a Monday-first index back to time.Weekday, which is
+// Sunday-first.
+func dayFromIndex(i int) time.Weekday {
+	return time.Weekday((i + 1) % 7)
+}
+
+// Allows reports whether t, evaluated in UTC, falls inside the window. A nil
+// *MaintenanceWindow always allows, so callers can consult it unconditionally
+// whether or not UPDATE_MAINTENANCE_WINDOW was set.
+func (w *MaintenanceWindow) Allows(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	t = t.UTC()
+	if w.days != nil && !w.days[t.Weekday()] {
+		return false
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	return offset >= w.startOfDay && offset < w.endOfDay
+}
+
+// String renders the window back in roughly the form it was configured in,
+// for log messages.
+func (w *MaintenanceWindow) String() string {
+	if w == nil {
+		return "(none)"
+	}
+	return w.source
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMaintenanceWindowFromEnv(t *testing.T) {
+	t.Run("unset allows everything", func(t *testing.T) {
+		os.Unsetenv(updateMaintenanceWindowEnv)
+		window, err := newMaintenanceWindowFromEnv()
+		require.NoError(t, err)
+		assert.Nil(t, window)
+		assert.True(t, window.Allows(time.Now()))
+	})
+
+	t.Run("rejects a malformed value", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateMaintenanceWindowEnv, "whenever"))
+		defer os.Unsetenv(updateMaintenanceWindowEnv)
+		_, err := newMaintenanceWindowFromEnv()
+		assert.Error(t, err)
+	})
+}
+
+func TestMaintenanceWindowAllows(t *testing.T) {
+	cases := []struct {
+		name   string
+		window string
+		time   string // RFC3339, UTC
+		want   bool
+	}{
+		{
+			name:   "inside a daily window",
+			window: "02:00-06:00",
+			time:   "2026-07-30T03:30:00Z",
+			want:   true,
+		},
+		{
+			name:   "before a daily window",
+			window: "02:00-06:00",
+			time:   "2026-07-30T01:59:00Z",
+			want:   false,
+		},
+		{
+			name:   "at the end boundary, which is exclusive",
+			window: "02:00-06:00",
+			time:   "2026-07-30T06:00:00Z",
+			want:   false,
+		},
+		{
+			name:   "inside a weekday-restricted window on an allowed day",
+			window: "Mon-Fri 02:00-06:00",
+			time:   "2026-07-30T03:00:00Z", // Thursday
+			want:   true,
+		},
+		{
+			name:   "inside a weekday-restricted window's hours but on a disallowed day",
+			window: "Mon-Fri 02:00-06:00",
+			time:   "2026-08-01T03:00:00Z", // Saturday
+			want:   false,
+		},
+		{
+			name:   "a comma list of days includes the given day",
+			window: "Sat,Sun 00:00-23:59",
+			time:   "2026-08-01T12:00:00Z", // Saturday
+			want:   true,
+		},
+		{
+			name:   "a comma list of days excludes the given day",
+			window: "Sat,Sun 00:00-23:59",
+			time:   "2026-07-30T12:00:00Z", // Thursday
+			want:   false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			window, err := parseMaintenanceWindow(c.window)
+			require.NoError(t, err)
+			ts, err := time.Parse(time.RFC3339, c.time)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, window.Allows(ts))
+		})
+	}
+}
+
+func TestParseMaintenanceWindowRejectsInvalidInput(t *testing.T) {
+	cases := []string{
+		"",
+		"02:00",
+		"06:00-02:00",         // end before start
+		"25:00-06:00",         // invalid hour
+		"02:00-06:00 extra",   // too many fields
+		"Fri-Mon 02:00-06:00", // wraps across the week
+		"Tue 02:00-06:00 x",   // too many fields
+		"Oops 02:00-06:00",    // unrecognized day
+	}
+	for _, raw := range cases {
+		t.Run(raw, func(t *testing.T) {
+			_, err := parseMaintenanceWindow(raw)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// updateMetricsNamespaceEnv names the environment variable holding the
+// CloudWatch namespace run metrics are published to. When unset (and
+// -metrics-namespace is also unset), no metrics are published.
+const updateMetricsNamespaceEnv = "UPDATE_METRICS_NAMESPACE"
+
+// defaultMetricsNamespace is the namespace suggested to operators enabling
+// metrics for the first time.
+const defaultMetricsNamespace = "Bottlerocket/ECSUpdater"
+
+// clusterDimension is the CloudWatch dimension every metric this updater
+// publishes carries, so metrics from different clusters don't collide in the
+// same namespace.
+const clusterDimension = "ClusterName"
+
+const (
+	metricInstancesConsidered   = "InstancesConsidered"
+	metricInstancesEligible     = "InstancesEligible"
+	metricInstancesUpdated      = "InstancesUpdated"
+	metricInstancesFailed       = "InstancesFailed"
+	metricDrainDurationSeconds  = "DrainDurationSeconds"
+	metricUpdateDurationSeconds = "UpdateDurationSeconds"
+	metricVerifyDurationSeconds = "VerifyDurationSeconds"
+	metricRunDurationSeconds    = "RunDurationSeconds"
+)
+
+// runMetric is one CloudWatch data point this updater publishes.
+type runMetric struct {
+	Name  string
+	Value float64
+	Unit  cloudwatchtypes.StandardUnit
+}
+
+// CloudWatchAPI is the subset of the CloudWatch API used to publish run
+// metrics.
+type CloudWatchAPI interface {
+	PutMetricData(ctx context.Context, input *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// MetricsPublisher publishes run metrics for external consumers (dashboards,
+// alarms).
+type MetricsPublisher interface {
+	Publish(ctx context.Context, m runMetric)
+}
+
+// noopMetricsPublisher discards metrics; used when no CloudWatch namespace is
+// configured.
+type noopMetricsPublisher struct{}
+
+func (noopMetricsPublisher) Publish(context.Context, runMetric) {}
+
+// cloudWatchMetricsPublisher publishes metrics to a CloudWatch namespace,
+// dimensioned by cluster.
+type cloudWatchMetricsPublisher struct {
+	cloudWatch CloudWatchAPI
+	namespace  string
+	cluster    string
+}
+
+func (p *cloudWatchMetricsPublisher) Publish(ctx context.Context, m runMetric) {
+	_, err := p.cloudWatch.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(p.namespace),
+		MetricData: []cloudwatchtypes.MetricDatum{
+			{
+				MetricName: aws.String(m.Name),
+				Value:      aws.Float64(m.Value),
+				Unit:       m.Unit,
+				Dimensions: []cloudwatchtypes.Dimension{
+					{Name: aws.String(clusterDimension), Value: aws.String(p.cluster)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to publish metric %q to CloudWatch namespace %q: %v", m.Name, p.namespace, err)
+	}
+}
+
+// newMetricsPublisher returns a MetricsPublisher that publishes to namespace
+// via CloudWatch, dimensioned by cluster, or a no-op publisher if namespace
+// is empty.
+func newMetricsPublisher(cloudWatchClient CloudWatchAPI, namespace, cluster string) MetricsPublisher {
+	if namespace == "" {
+		return noopMetricsPublisher{}
+	}
+	return &cloudWatchMetricsPublisher{cloudWatch: cloudWatchClient, namespace: namespace, cluster: cluster}
+}
+
+// metricsNamespace resolves the CloudWatch namespace to publish run metrics
+// to: the -metrics-namespace flag if set, otherwise the
+// UPDATE_METRICS_NAMESPACE environment variable.
+func metricsNamespace(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(updateMetricsNamespaceEnv)
+}
+
+// publishMetric emits a count or duration metric through u.metrics,
+// tolerating updaters built without one, as most existing tests do.
+func (u *updater) publishMetric(ctx context.Context, name string, value float64, unit cloudwatchtypes.StandardUnit) {
+	if u.metrics == nil {
+		return
+	}
+	u.metrics.Publish(ctx, runMetric{Name: name, Value: value, Unit: unit})
+}
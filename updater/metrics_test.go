@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetricsPublisherNoop(t *testing.T) {
+	publisher := newMetricsPublisher(MockCloudWatch{}, "", "my-cluster")
+	_, ok := publisher.(noopMetricsPublisher)
+	assert.True(t, ok, "expected a no-op publisher when no namespace is set")
+	// Should not panic even without a backing client.
+	publisher.Publish(context.Background(), runMetric{Name: metricInstancesUpdated, Value: 1})
+}
+
+func TestCloudWatchMetricsPublisherPublish(t *testing.T) {
+	var put *cloudwatch.PutMetricDataInput
+	mockCloudWatch := MockCloudWatch{
+		PutMetricDataFn: func(ctx context.Context, input *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+			put = input
+			return &cloudwatch.PutMetricDataOutput{}, nil
+		},
+	}
+	publisher := newMetricsPublisher(mockCloudWatch, "Bottlerocket/ECSUpdater", "my-cluster")
+	_, ok := publisher.(*cloudWatchMetricsPublisher)
+	require.True(t, ok, "expected a CloudWatch-backed publisher when a namespace is set")
+
+	publisher.Publish(context.Background(), runMetric{
+		Name:  metricInstancesFailed,
+		Value: 2,
+		Unit:  cloudwatchtypes.StandardUnitCount,
+	})
+
+	require.NotNil(t, put)
+	assert.Equal(t, "Bottlerocket/ECSUpdater", aws.ToString(put.Namespace))
+	require.Len(t, put.MetricData, 1)
+	datum := put.MetricData[0]
+	assert.Equal(t, metricInstancesFailed, aws.ToString(datum.MetricName))
+	assert.Equal(t, 2.0, aws.ToFloat64(datum.Value))
+	assert.Equal(t, cloudwatchtypes.StandardUnitCount, datum.Unit)
+	require.Len(t, datum.Dimensions, 1)
+	assert.Equal(t, clusterDimension, aws.ToString(datum.Dimensions[0].Name))
+	assert.Equal(t, "my-cluster", aws.ToString(datum.Dimensions[0].Value))
+}
+
+func TestUpdaterPublishMetricToleratesNilPublisher(t *testing.T) {
+	u := &updater{}
+	// Should not panic.
+	u.publishMetric(context.Background(), metricRunDurationSeconds, 1.0, cloudwatchtypes.StandardUnitSeconds)
+}
+
+func TestMetricsNamespaceFlagOverridesEnv(t *testing.T) {
+	require.NoError(t, os.Setenv(updateMetricsNamespaceEnv, "env-namespace"))
+	defer os.Unsetenv(updateMetricsNamespaceEnv)
+
+	assert.Equal(t, "env-namespace", metricsNamespace(""))
+	assert.Equal(t, "flag-namespace", metricsNamespace("flag-namespace"))
+}
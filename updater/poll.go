@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// poll calls fn every interval until it reports done, returns a non-nil
+// error, or timeout elapses, in which case poll itself returns an error.
+// It's modeled after Kubernetes' wait.Poll and is the building block for the
+// updater's per-instance update state machine.
+func poll(interval, timeout time.Duration, fn func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := fn()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		sleep(interval)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollSucceedsOnFirstCall(t *testing.T) {
+	calls := 0
+	err := poll(time.Millisecond, time.Second, func() (bool, error) {
+		calls++
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestPollRetriesUntilDone(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	calls := 0
+	err := poll(time.Millisecond, time.Second, func() (bool, error) {
+		calls++
+		return calls == 3, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestPollReturnsErrImmediately(t *testing.T) {
+	boom := errors.New("boom")
+	calls := 0
+	err := poll(time.Millisecond, time.Second, func() (bool, error) {
+		calls++
+		return false, boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, 1, calls)
+}
+
+func TestPollTimesOut(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	err := poll(time.Millisecond, 10*time.Millisecond, func() (bool, error) {
+		return false, nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+// fakeSleep replaces the package's sleep hook with a no-op so poll tests
+// don't depend on wall-clock time, returning a func to restore it.
+func fakeSleep(t *testing.T) func() {
+	t.Helper()
+	old := sleep
+	sleep = func(time.Duration) {}
+	return func() { sleep = old }
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+)
+
+// BackoffPolicy configures retryWithBackoff's exponential-backoff-with-jitter
+// schedule: attempt N sleeps min(initialInterval*multiplier^N, maxInterval)
+// plus a random amount up to jitter.
+type BackoffPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          time.Duration
+	MaxAttempts     int
+}
+
+// defaultBackoffPolicy is used by the updater when none is configured.
+var defaultBackoffPolicy = BackoffPolicy{
+	InitialInterval: 2 * time.Second,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2.0,
+	Jitter:          time.Second,
+	MaxAttempts:     5,
+}
+
+// RetryPolicy configures checkCommandOutput's per-instance retries around a
+// check command's result: sleeps use full jitter (a single random draw in
+// [0, min(MaxDelay, BaseDelay*2^attempt))) rather than BackoffPolicy's fixed
+// delay plus a small jitter addition, since these retries are spread across
+// every instance in a cluster and benefit more from spreading out than from
+// a predictable floor.
+type RetryPolicy struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts int
+}
+
+// defaultRetryPolicy is used by the updater when none is configured.
+var defaultRetryPolicy = RetryPolicy{
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	MaxAttempts: 5,
+}
+
+// delay returns the full-jitter sleep duration before retry attempt n (0-indexed).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt))
+	if max := float64(p.MaxDelay); p.MaxDelay > 0 && d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// retries returns u's configured RetryPolicy, or defaultRetryPolicy if u was
+// constructed without one (as plain struct literals in tests do).
+func (u *updater) retries() RetryPolicy {
+	if u.retryPolicy.MaxAttempts <= 0 {
+		return defaultRetryPolicy
+	}
+	return u.retryPolicy
+}
+
+// waiterMaxDuration bounds how long any of the updater's SDK waiters will
+// poll, matching the historical waiterMaxAttempts*MaxInterval ceiling.
+// It's a var, rather than a const, so tests can shrink it to avoid actually
+// waiting out a full wait cycle when exercising waiter-timeout paths.
+var waiterMaxDuration = 50 * time.Minute
+
+// sleep is overridden in tests so backoff schedules can be verified without
+// actually waiting.
+var sleep = time.Sleep
+
+// delay returns the sleep duration before retry attempt n (0-indexed).
+func (p BackoffPolicy) delay(attempt int) time.Duration {
+	d := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt))
+	if max := float64(p.MaxInterval); p.MaxInterval > 0 && d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		d += float64(rand.Int63n(int64(p.Jitter)))
+	}
+	return time.Duration(d)
+}
+
+// tasksStoppedWaiterOptions adapts p into ecs.TasksStoppedWaiter options, so
+// it can be passed to ecs.NewTasksStoppedWaiter in place of the waiter's
+// built-in delay schedule.
+func (p BackoffPolicy) tasksStoppedWaiterOptions(o *ecs.TasksStoppedWaiterOptions) {
+	o.MinDelay = p.InitialInterval
+	o.MaxDelay = p.MaxInterval
+}
+
+// commandExecutedWaiterOptions adapts p into ssm.CommandExecutedWaiter options.
+func (p BackoffPolicy) commandExecutedWaiterOptions(o *ssm.CommandExecutedWaiterOptions) {
+	o.MinDelay = p.InitialInterval
+	o.MaxDelay = p.MaxInterval
+}
+
+// instanceStatusOkWaiterOptions adapts p into ec2.InstanceStatusOkWaiter options.
+func (p BackoffPolicy) instanceStatusOkWaiterOptions(o *ec2.InstanceStatusOkWaiterOptions) {
+	o.MinDelay = p.InitialInterval
+	o.MaxDelay = p.MaxInterval
+}
+
+// instanceStoppedWaiterOptions adapts p into ec2.InstanceStoppedWaiter options.
+func (p BackoffPolicy) instanceStoppedWaiterOptions(o *ec2.InstanceStoppedWaiterOptions) {
+	o.MinDelay = p.InitialInterval
+	o.MaxDelay = p.MaxInterval
+}
+
+// instanceRunningWaiterOptions adapts p into ec2.InstanceRunningWaiter options.
+func (p BackoffPolicy) instanceRunningWaiterOptions(o *ec2.InstanceRunningWaiterOptions) {
+	o.MinDelay = p.InitialInterval
+	o.MaxDelay = p.MaxInterval
+}
+
+// servicesStableWaiterOptions adapts p into ecs.ServicesStableWaiter options.
+func (p BackoffPolicy) servicesStableWaiterOptions(o *ecs.ServicesStableWaiterOptions) {
+	o.MinDelay = p.InitialInterval
+	o.MaxDelay = p.MaxInterval
+}
+
+// policy returns u's configured BackoffPolicy, or defaultBackoffPolicy if
+// u was constructed without one (as plain struct literals in tests do).
+func (u *updater) policy() BackoffPolicy {
+	if u.backoffPolicy.MaxAttempts <= 0 {
+		return defaultBackoffPolicy
+	}
+	return u.backoffPolicy
+}
+
+// retriable reports whether err is a transient AWS error worth retrying:
+// request/service throttling, an SSM invocation that hasn't yet propagated
+// after SendCommand, or an instance lookup made just after creation that
+// hasn't yet become consistent. The latter isn't reachable through any
+// current call site (the one EC2 lookup the updater makes goes through its
+// own waiter rather than retryWithBackoff), but is classified here so it
+// retries correctly if a direct EC2 lookup is ever added.
+func retriable(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "RequestLimitExceeded", "ThrottlingException", "ServiceUnavailable", "InternalError", "InvocationDoesNotExist", "InvalidInstanceID.NotFound":
+		return true
+	default:
+		return false
+	}
+}
+
+// retryWithBackoff invokes op, retrying according to policy while its error
+// is retriable. Non-retriable errors are returned immediately, unwrapped.
+// ctx bounds the whole retry loop: retryWithBackoff checks it before every
+// attempt and after every sleep, stopping early with ctx.Err() once it's
+// cancelled or its deadline has passed.
+func retryWithBackoff(ctx context.Context, op func() error, policy BackoffPolicy) error {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if !retriable(err) {
+			return err
+		}
+		lastErr = err
+		if attempt == maxAttempts-1 {
+			break
+		}
+		sleep(policy.delay(attempt))
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", maxAttempts, lastErr)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func apiErr(code string) error {
+	return &smithy.GenericAPIError{Code: code, Message: "boom"}
+}
+
+func TestRetriable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("boom"), false},
+		{"throttling", apiErr("ThrottlingException"), true},
+		{"request limit exceeded", apiErr("RequestLimitExceeded"), true},
+		{"service unavailable", apiErr("ServiceUnavailable"), true},
+		{"internal error", apiErr("InternalError"), true},
+		{"invocation does not exist", apiErr("InvocationDoesNotExist"), true},
+		{"invalid instance id not found", apiErr("InvalidInstanceID.NotFound"), true},
+		{"non-retriable aws error", apiErr("ValidationException"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, retriable(tc.err))
+		})
+	}
+}
+
+func TestRetryWithBackoffSucceedsAfterRetries(t *testing.T) {
+	var slept []time.Duration
+	restore := sleep
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = restore }()
+
+	attempts := 0
+	err := retryWithBackoff(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return apiErr("ThrottlingException")
+		}
+		return nil
+	}, BackoffPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		Multiplier:      2,
+		MaxAttempts:     5,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, slept, 2, "should sleep once between each of the two failed attempts")
+}
+
+func TestRetryWithBackoffSucceedsAfterNThrottles(t *testing.T) {
+	cases := []struct {
+		name     string
+		throttle int
+	}{
+		{"no throttles", 0},
+		{"one throttle", 1},
+		{"four throttles", 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			restore := sleep
+			sleep = func(time.Duration) {}
+			defer func() { sleep = restore }()
+
+			attempts := 0
+			err := retryWithBackoff(context.Background(), func() error {
+				attempts++
+				if attempts <= tc.throttle {
+					return apiErr("ThrottlingException")
+				}
+				return nil
+			}, BackoffPolicy{
+				InitialInterval: time.Millisecond,
+				MaxInterval:     10 * time.Millisecond,
+				Multiplier:      2,
+				MaxAttempts:     10,
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.throttle+1, attempts)
+		})
+	}
+}
+
+func TestRetryWithBackoffHonorsContextCancellation(t *testing.T) {
+	restore := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = restore }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := retryWithBackoff(ctx, func() error {
+		attempts++
+		if attempts == 1 {
+			cancel()
+		}
+		return apiErr("ThrottlingException")
+	}, BackoffPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		Multiplier:      2,
+		MaxAttempts:     10,
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, attempts, "should stop retrying once the context is cancelled rather than exhausting MaxAttempts")
+}
+
+func TestRetryWithBackoffReturnsNonRetriableImmediately(t *testing.T) {
+	var slept []time.Duration
+	restore := sleep
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = restore }()
+
+	attempts := 0
+	wantErr := errors.New("not an aws error")
+	err := retryWithBackoff(context.Background(), func() error {
+		attempts++
+		return wantErr
+	}, defaultBackoffPolicy)
+
+	assert.ErrorIs(t, err, wantErr)
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, slept)
+}
+
+func TestRetryWithBackoffExhaustsMaxAttempts(t *testing.T) {
+	restore := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = restore }()
+
+	attempts := 0
+	err := retryWithBackoff(context.Background(), func() error {
+		attempts++
+		return apiErr("ThrottlingException")
+	}, BackoffPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		Multiplier:      2,
+		MaxAttempts:     3,
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Contains(t, err.Error(), "gave up after 3 attempts")
+}
+
+func TestBackoffPolicyDelayCapsAtMaxInterval(t *testing.T) {
+	p := BackoffPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      10,
+	}
+	// attempt 0: 1s*10^0 = 1s; attempt 3: 1s*10^3 = 1000s, capped to 5s.
+	assert.Equal(t, time.Second, p.delay(0))
+	assert.Equal(t, 5*time.Second, p.delay(3))
+}
+
+func TestUpdaterPolicyFallsBackToDefault(t *testing.T) {
+	u := &updater{}
+	assert.Equal(t, defaultBackoffPolicy, u.policy())
+
+	custom := BackoffPolicy{MaxAttempts: 9}
+	u.backoffPolicy = custom
+	assert.Equal(t, custom, u.policy())
+}
+
+func TestRetryPolicyDelayCapsAtMaxDelay(t *testing.T) {
+	p := RetryPolicy{
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Second,
+	}
+	// attempt 0: draws from [0, 1s); attempt 10: 1s*2^10 far exceeds 5s, so the
+	// draw is capped to [0, 5s).
+	assert.Less(t, p.delay(0), time.Second)
+	assert.Less(t, p.delay(10), 5*time.Second+1)
+}
+
+func TestUpdaterRetriesFallsBackToDefault(t *testing.T) {
+	u := &updater{}
+	assert.Equal(t, defaultRetryPolicy, u.retries())
+
+	custom := RetryPolicy{MaxAttempts: 9}
+	u.retryPolicy = custom
+	assert.Equal(t, custom, u.retries())
+}
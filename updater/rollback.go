@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+const (
+	// defaultPostUpdateHealthTimeout bounds how long postUpdateHealthGate
+	// waits for an instance to prove itself healthy after a reboot before
+	// giving up and rolling it back.
+	defaultPostUpdateHealthTimeout = 5 * time.Minute
+
+	// postUpdateHealthPollInterval is how often postUpdateHealthGate
+	// re-checks an instance's container-instance state, task health, and
+	// active version.
+	postUpdateHealthPollInterval = 10 * time.Second
+)
+
+// errInstanceUnhealthyAfterUpdate marks an updateInstance failure where the
+// instance never became healthy after rebooting onto its new partition.
+// errors.Is matches this regardless of whether the follow-up rollback
+// succeeded; the error's text distinguishes the two outcomes.
+var errInstanceUnhealthyAfterUpdate = errors.New("instance failed post-update health check")
+
+// postUpdateHealthGate runs once an instance has rebooted onto its new
+// partition and been reactivated in ECS: it polls the instance for up to
+// u.postUpdateHealthTimeout (or defaultPostUpdateHealthTimeout if unset) to
+// confirm it's actually healthy, rolling it back to its previous partition
+// if it never is. It's a no-op when u.rollbackDocument isn't configured,
+// preserving the updater's historical behavior of trusting
+// WaitUntilInstanceStatusOk alone.
+func (u *updater) postUpdateHealthGate(ctx context.Context, inst instance) error {
+	if u.rollbackDocument == "" {
+		return nil
+	}
+
+	timeout := u.postUpdateHealthTimeout
+	if timeout <= 0 {
+		timeout = defaultPostUpdateHealthTimeout
+	}
+
+	healthErr := poll(postUpdateHealthPollInterval, timeout, func() (bool, error) {
+		return u.instanceHealthyAfterUpdate(ctx, inst)
+	})
+	if healthErr == nil {
+		return nil
+	}
+
+	log.Printf("Instance %q failed post-update health check: %v; rolling back to its previous partition", inst.instanceID, healthErr)
+	if rollbackErr := u.rollbackInstance(ctx, inst); rollbackErr != nil {
+		return fmt.Errorf("%w: %v (rollback also failed: %v)", errInstanceUnhealthyAfterUpdate, healthErr, rollbackErr)
+	}
+	return fmt.Errorf("%w: %v (instance rolled back to its previous partition)", errInstanceUnhealthyAfterUpdate, healthErr)
+}
+
+// instanceHealthyAfterUpdate reports whether inst currently looks healthy
+// after an update: its container instance has re-registered ACTIVE with the
+// ECS agent connected, and either a service task on it has reached RUNNING,
+// or, if none is scheduled there, the check document confirms its target
+// version is active. A false, nil result tells poll to keep waiting.
+func (u *updater) instanceHealthyAfterUpdate(ctx context.Context, inst instance) (bool, error) {
+	desc, err := u.ecs.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+		Cluster:            &u.cluster,
+		ContainerInstances: []string{inst.containerInstanceID},
+	})
+	if err != nil || len(desc.ContainerInstances) == 0 {
+		return false, nil
+	}
+	ci := desc.ContainerInstances[0]
+	if aws.ToString(ci.Status) != string(types.ContainerInstanceStatusActive) || !ci.AgentConnected {
+		return false, nil
+	}
+
+	list, err := u.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:           &u.cluster,
+		ContainerInstance: aws.String(inst.containerInstanceID),
+	})
+	if err != nil {
+		return false, nil
+	}
+	if len(list.TaskArns) == 0 {
+		return u.activeVersionMatches(ctx, inst)
+	}
+
+	tasksDesc, err := u.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: &u.cluster,
+		Tasks:   list.TaskArns,
+	})
+	if err != nil {
+		return false, nil
+	}
+	for _, task := range tasksDesc.Tasks {
+		if aws.ToString(task.LastStatus) == taskStatusRunning {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// activeVersionMatches sends inst.instanceID a check-document invocation
+// and reports whether its active partition is already running inst's
+// target version.
+func (u *updater) activeVersionMatches(ctx context.Context, inst instance) (bool, error) {
+	commandID, err := u.sendCommand(ctx, []string{inst.instanceID}, u.checkDocument)
+	if err != nil {
+		return false, nil
+	}
+	output, err := u.checkCommandOutput(ctx, commandID, inst.instanceID)
+	if err != nil {
+		return false, nil
+	}
+	return output.ActivePartition.Image.Version == inst.targetVersion, nil
+}
+
+// rollbackInstance reboots inst back onto its previous (inactive) partition
+// by invoking u.rollbackDocument, which is expected to run Bottlerocket's
+// `apiclient set updates.ignore-waves=true` followed by a rollback reboot
+// (signpost cancel-update). The instance was already reactivated by the time
+// this is called (postUpdateHealthGate runs after updateOne's activateInstance
+// call), so, as with the initial update, rollbackInstance drains it first to
+// avoid disrupting newly-placed tasks with the reboot, then reactivates it
+// once it's back to Ok.
+func (u *updater) rollbackInstance(ctx context.Context, inst instance) error {
+	log.Printf("Rolling back instance %q to its previous partition", inst.instanceID)
+
+	u.ecsStateMu.Lock()
+	_, drainErr := u.drainInstance(ctx, inst.containerInstanceID)
+	u.ecsStateMu.Unlock()
+	if drainErr != nil {
+		return fmt.Errorf("failed to drain instance before rollback: %w", drainErr)
+	}
+
+	resp, err := u.ssm.SendCommand(ctx, &ssm.SendCommandInput{
+		DocumentName:    aws.String(u.rollbackDocument),
+		DocumentVersion: aws.String("$DEFAULT"),
+		InstanceIds:     []string{inst.instanceID},
+		TimeoutSeconds:  aws.Int32(deliveryTimeoutSeconds),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send rollback command: %w", err)
+	}
+	rollbackID := aws.ToString(resp.Command.CommandId)
+	log.Printf("SSM document %q posted with command ID %q", u.rollbackDocument, rollbackID)
+
+	// As in rebootInPlace, give the rollback reboot a moment to start before
+	// polling instance status, rather than polling for command completion.
+	sleep(15 * time.Second)
+	if err := u.waitUntilOk(ctx, inst.instanceID); err != nil {
+		return fmt.Errorf("failed to reach Ok status after rollback: %w", err)
+	}
+
+	u.ecsStateMu.Lock()
+	activateErr := u.activateInstance(ctx, inst.containerInstanceID)
+	u.ecsStateMu.Unlock()
+	if activateErr != nil {
+		return fmt.Errorf("failed to reactivate instance after rollback: %w", activateErr)
+	}
+
+	log.Printf("Instance %q rolled back successfully", inst.instanceID)
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostUpdateHealthGateSkippedWithoutRollbackDocument confirms the gate is
+// a complete no-op when rollbackDocument isn't configured, so instances never
+// pay for a health check unless the feature is opted into.
+func TestPostUpdateHealthGateSkippedWithoutRollbackDocument(t *testing.T) {
+	u := updater{}
+	err := u.postUpdateHealthGate(context.Background(), instance{instanceID: "instance-id"})
+	require.NoError(t, err)
+}
+
+// TestPostUpdateHealthGateHealthyNoRollback covers the case where the
+// instance becomes healthy before the timeout elapses: the gate must return
+// nil and must never invoke the rollback document.
+func TestPostUpdateHealthGateHealthyNoRollback(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	calls := 0
+	mockECS := MockECS{
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			calls++
+			if calls < 2 {
+				return &ecs.DescribeContainerInstancesOutput{
+					ContainerInstances: []types.ContainerInstance{{
+						Status:         aws.String(string(types.ContainerInstanceStatusRegistering)),
+						AgentConnected: true,
+					}},
+				}, nil
+			}
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{
+					Status:         aws.String(string(types.ContainerInstanceStatusActive)),
+					AgentConnected: true,
+				}},
+			}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{"task-1"}}, nil
+		},
+		DescribeTasksFn: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			return &ecs.DescribeTasksOutput{
+				Tasks: []types.Task{{TaskArn: aws.String("task-1"), LastStatus: aws.String("RUNNING")}},
+			}, nil
+		},
+	}
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			t.Fatalf("rollback document must not be sent when the instance becomes healthy, got document %q", aws.ToString(input.DocumentName))
+			return nil, nil
+		},
+	}
+	u := updater{
+		ecs:                     mockECS,
+		ssm:                     mockSSM,
+		rollbackDocument:        "rollback-document",
+		postUpdateHealthTimeout: time.Minute,
+	}
+	err := u.postUpdateHealthGate(context.Background(), instance{
+		instanceID:          "instance-id",
+		containerInstanceID: "cont-inst-id",
+		targetVersion:       "v2.0.0",
+	})
+	require.NoError(t, err)
+}
+
+// TestPostUpdateHealthGateRollsBackAndSucceeds covers the case where the
+// instance never becomes healthy: the gate must send the rollback document
+// and, once the instance reaches Ok, surface errInstanceUnhealthyAfterUpdate
+// noting the rollback succeeded.
+func TestPostUpdateHealthGateRollsBackAndSucceeds(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	mockECS := MockECS{
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{
+					Status:         aws.String(string(types.ContainerInstanceStatusRegistering)),
+					AgentConnected: false,
+				}},
+			}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	var rolledBack bool
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			assert.Equal(t, "rollback-document", aws.ToString(input.DocumentName))
+			assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+			rolledBack = true
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("rollback-command-id")}}, nil
+		},
+	}
+	mockEC2 := MockEC2{
+		DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+			assert.Equal(t, []string{"instance-id"}, input.InstanceIds)
+			return &ec2.DescribeInstanceStatusOutput{
+				InstanceStatuses: []ec2types.InstanceStatus{{
+					InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+				}},
+			}, nil
+		},
+	}
+	u := updater{
+		ecs:                     mockECS,
+		ssm:                     mockSSM,
+		ec2:                     mockEC2,
+		rollbackDocument:        "rollback-document",
+		postUpdateHealthTimeout: 30 * time.Millisecond,
+	}
+	err := u.postUpdateHealthGate(context.Background(), instance{
+		instanceID:          "instance-id",
+		containerInstanceID: "cont-inst-id",
+		targetVersion:       "v2.0.0",
+	})
+	require.Error(t, err)
+	assert.True(t, rolledBack)
+	assert.ErrorIs(t, err, errInstanceUnhealthyAfterUpdate)
+	assert.Contains(t, err.Error(), "instance rolled back to its previous partition")
+}
+
+// TestPostUpdateHealthGateRollbackAlsoFails covers the case where the
+// instance never becomes healthy AND the rollback itself fails: both errors
+// must be surfaced in the final message.
+func TestPostUpdateHealthGateRollbackAlsoFails(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	mockECS := MockECS{
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{
+					Status:         aws.String(string(types.ContainerInstanceStatusRegistering)),
+					AgentConnected: false,
+				}},
+			}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	rollbackSendErr := errors.New("failed to send rollback command")
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			assert.Equal(t, "rollback-document", aws.ToString(input.DocumentName))
+			return nil, rollbackSendErr
+		},
+	}
+	u := updater{
+		ecs:                     mockECS,
+		ssm:                     mockSSM,
+		rollbackDocument:        "rollback-document",
+		postUpdateHealthTimeout: 30 * time.Millisecond,
+	}
+	err := u.postUpdateHealthGate(context.Background(), instance{
+		instanceID:          "instance-id",
+		containerInstanceID: "cont-inst-id",
+		targetVersion:       "v2.0.0",
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errInstanceUnhealthyAfterUpdate)
+	assert.Contains(t, err.Error(), "rollback also failed")
+	assert.Contains(t, err.Error(), rollbackSendErr.Error())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	runStatusSuccess = "Success"
+	runStatusFailed  = "Failed"
+
+	// outcomeNotAttempted marks a candidate instance that the run never got a
+	// result for, e.g. a canary-strategy remainder left undispatched because
+	// the canary bake failed, or an instance the supervisor never reached
+	// before its context was cancelled.
+	outcomeNotAttempted = "Not attempted"
+)
+
+// instanceReport is one instance's outcome in a RunReport, a lighter-weight
+// counterpart to auditEvent: it's the single after-action-summary line an
+// operator already sees in the logs, not a per-phase trace. Detailed
+// per-phase timing and SSM command IDs remain the audit log's job (see
+// auditlog.go's auditEvent.DurationMs/SSMCommandID, uploaded separately via
+// UPDATE_AUDIT_LOG_S3) rather than being duplicated here.
+type instanceReport struct {
+	ContainerInstanceID string `json:"container_instance_id"`
+	EC2InstanceID       string `json:"ec2_instance_id,omitempty"`
+	FromVersion         string `json:"from_version,omitempty"`
+	ToVersion           string `json:"to_version,omitempty"`
+	Outcome             string `json:"outcome"`
+}
+
+// RunReport is a structured, machine-readable summary of a single updater
+// run: an auditable history a dashboard can query, complementing the
+// ephemeral CloudWatch logs the ECS task otherwise leaves behind.
+type RunReport struct {
+	Cluster    string           `json:"cluster"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Instances  []instanceReport `json:"instances"`
+}
+
+// newRunReport builds a RunReport covering the supervisor stage of a run:
+// candidates supplies each instance's prior/target version, summary its
+// after-action outcome (supervisor.run/runCanary's return value), and runErr
+// whatever error, if any, supervisor.run/runCanary itself returned. Earlier
+// failures (e.g. listing instances) abort _main before candidates exist, so
+// no report is produced for those -- the same scope the replaced
+// log.Printf("After action summary") block had.
+func newRunReport(cluster string, startedAt, finishedAt time.Time, candidates []instance, summary map[string]string, runErr error) *RunReport {
+	r := &RunReport{
+		Cluster:    cluster,
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+		Status:     runStatusSuccess,
+		Error:      errString(runErr),
+	}
+	if runErr != nil {
+		r.Status = runStatusFailed
+	}
+	for _, i := range candidates {
+		outcome, ok := summary[i.instanceID]
+		if !ok {
+			outcome = outcomeNotAttempted
+		}
+		r.Instances = append(r.Instances, instanceReport{
+			ContainerInstanceID: i.containerInstanceID,
+			EC2InstanceID:       i.instanceID,
+			FromVersion:         i.bottlerocketVersion,
+			ToVersion:           i.targetVersion,
+			Outcome:             outcome,
+		})
+	}
+	return r
+}
+
+// clusterShortName extracts the bare cluster name from cluster, which per
+// the -cluster flag may be either a short name already or a full
+// "arn:aws:ecs:region:account:cluster/name" ARN; an ARN's "/"- and
+// ":"-bearing resource part is not safe to embed directly in an S3 key.
+func clusterShortName(cluster string) string {
+	a, err := arn.Parse(cluster)
+	if err != nil {
+		return cluster
+	}
+	if idx := strings.LastIndex(a.Resource, "/"); idx >= 0 {
+		return a.Resource[idx+1:]
+	}
+	return a.Resource
+}
+
+// upload marshals r as indented JSON and uploads it to dest, an
+// "s3://bucket/prefix" URI: the object key is prefix/<cluster>-<finished-at
+// RFC3339>.json, so every run lands at its own key instead of overwriting
+// the last one.
+func (r *RunReport) upload(ctx context.Context, s3Client S3API, dest string) error {
+	bucket, prefix, err := parseS3URI(dest)
+	if err != nil {
+		return fmt.Errorf("invalid -report-s3-uri %q: %w", dest, err)
+	}
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run report: %w", err)
+	}
+	key := fmt.Sprintf("%s/%s-%s.json", strings.TrimSuffix(prefix, "/"), clusterShortName(r.Cluster), r.FinishedAt.UTC().Format(time.RFC3339))
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload run report to \"s3://%s/%s\": %w", bucket, key, err)
+	}
+	log.Printf("Uploaded run report to \"s3://%s/%s\"", bucket, key)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRunReportSuccess(t *testing.T) {
+	started := time.Date(2026, 7, 30, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(5 * time.Minute)
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "1.0.0", targetVersion: "1.1.0"},
+	}
+	summary := map[string]string{"i-1": "Success"}
+
+	r := newRunReport("my-cluster", started, finished, candidates, summary, nil)
+
+	assert.Equal(t, "my-cluster", r.Cluster)
+	assert.Equal(t, started, r.StartedAt)
+	assert.Equal(t, finished, r.FinishedAt)
+	assert.Equal(t, runStatusSuccess, r.Status)
+	assert.Empty(t, r.Error)
+	require.Len(t, r.Instances, 1)
+	assert.Equal(t, instanceReport{
+		ContainerInstanceID: "ci-1",
+		EC2InstanceID:       "i-1",
+		FromVersion:         "1.0.0",
+		ToVersion:           "1.1.0",
+		Outcome:             "Success",
+	}, r.Instances[0])
+}
+
+func TestNewRunReportFailed(t *testing.T) {
+	r := newRunReport("my-cluster", time.Now(), time.Now(), nil, nil, assert.AnError)
+	assert.Equal(t, runStatusFailed, r.Status)
+	assert.Equal(t, assert.AnError.Error(), r.Error)
+}
+
+func TestNewRunReportMarksUndispatchedCandidatesNotAttempted(t *testing.T) {
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1"},
+		{instanceID: "i-2", containerInstanceID: "ci-2"},
+	}
+	summary := map[string]string{"i-1": "Success"}
+
+	r := newRunReport("my-cluster", time.Now(), time.Now(), candidates, summary, nil)
+
+	require.Len(t, r.Instances, 2)
+	assert.Equal(t, "Success", r.Instances[0].Outcome)
+	assert.Equal(t, outcomeNotAttempted, r.Instances[1].Outcome)
+}
+
+func TestClusterShortName(t *testing.T) {
+	assert.Equal(t, "my-cluster", clusterShortName("my-cluster"))
+	assert.Equal(t, "my-cluster", clusterShortName("arn:aws:ecs:us-east-1:123456789012:cluster/my-cluster"))
+}
+
+func TestRunReportUploadUsesClusterAndTimestampInKey(t *testing.T) {
+	finished := time.Date(2026, 7, 30, 12, 30, 0, 0, time.UTC)
+	r := newRunReport("arn:aws:ecs:us-east-1:123456789012:cluster/my-cluster", finished.Add(-time.Minute), finished, nil, nil, nil)
+
+	var uploaded *s3.PutObjectInput
+	mockS3 := MockS3{
+		PutObjectFn: func(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			uploaded = input
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	require.NoError(t, r.upload(context.Background(), mockS3, "s3://my-bucket/reports"))
+
+	require.NotNil(t, uploaded)
+	assert.Equal(t, "my-bucket", aws.ToString(uploaded.Bucket))
+	assert.Equal(t, "reports/my-cluster-2026-07-30T12:30:00Z.json", aws.ToString(uploaded.Key))
+
+	body, err := io.ReadAll(uploaded.Body)
+	require.NoError(t, err)
+	var decoded RunReport
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:cluster/my-cluster", decoded.Cluster)
+}
+
+func TestRunReportUploadRejectsInvalidURI(t *testing.T) {
+	r := newRunReport("my-cluster", time.Now(), time.Now(), nil, nil, nil)
+	err := r.upload(context.Background(), MockS3{}, "https://not-s3/reports")
+	assert.Error(t, err)
+}
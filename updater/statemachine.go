@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// updateStateTableEnv names the DynamoDB table used to persist in-flight
+// update state. When unset, the updater runs without a StateStore.
+const updateStateTableEnv = "UPDATE_STATE_TABLE"
+
+// newStateStoreFromEnv returns a DynamoDB-backed StateStore if
+// UPDATE_STATE_TABLE is set, or nil otherwise.
+func newStateStoreFromEnv(client DynamoDBAPI) StateStore {
+	tableName := os.Getenv(updateStateTableEnv)
+	if tableName == "" {
+		return nil
+	}
+	return newDynamoStateStore(client, tableName)
+}
+
+// updateState names a step in an instance's update lifecycle. It's both the
+// state updateOne drives through via poll and the value persisted to a
+// StateStore so a crashed/restarted updater task can resume mid-flight
+// instead of starting over and potentially double-draining an instance.
+type updateState string
+
+const (
+	stateChecking          updateState = "Checking"
+	stateDraining          updateState = "Draining"
+	stateApplying          updateState = "Applying"
+	stateRebooting         updateState = "Rebooting"
+	stateAwaitingSSMAgent  updateState = "AwaitingSSMAgent"
+	stateVerifying         updateState = "Verifying"
+	stateVerifyingServices updateState = "VerifyingServices"
+	stateDone              updateState = "Done"
+	stateFailed            updateState = "Failed"
+)
+
+// StateStore persists the current updateState for an in-flight instance
+// update, scoped to the targetVersion it was updating to. It's optional: a
+// nil StateStore, the default, leaves the updater stateless, matching its
+// historical behavior.
+type StateStore interface {
+	Save(ctx context.Context, containerInstanceID string, state updateState, targetVersion string) error
+	Load(ctx context.Context, containerInstanceID string) (state updateState, targetVersion string, ok bool, err error)
+}
+
+// setState records state for containerInstanceID updating to targetVersion in
+// u's StateStore, if one is configured, and appends it to u's in-memory
+// transition log. Failures to persist are logged but not fatal: the
+// StateStore is a resume optimization, not a correctness requirement for the
+// current run.
+func (u *updater) setState(ctx context.Context, containerInstanceID string, state updateState, targetVersion string) {
+	u.transitionsMu.Lock()
+	if u.transitionLog == nil {
+		u.transitionLog = make(map[string][]updateState)
+	}
+	u.transitionLog[containerInstanceID] = append(u.transitionLog[containerInstanceID], state)
+	u.transitionsMu.Unlock()
+
+	if u.stateStore == nil {
+		return
+	}
+	if err := u.stateStore.Save(ctx, containerInstanceID, state, targetVersion); err != nil {
+		log.Printf("Failed to persist state %q for instance %q: %v", state, containerInstanceID, err)
+	}
+}
+
+// transitions returns the ordered list of states containerInstanceID has
+// passed through during this run. It exists so tests can assert the exact
+// path updateOne drove an instance through (e.g. Draining -> Applying ->
+// Rebooting -> VerifyingServices) rather than only its final outcome.
+func (u *updater) transitions(containerInstanceID string) []updateState {
+	u.transitionsMu.Lock()
+	defer u.transitionsMu.Unlock()
+	out := make([]updateState, len(u.transitionLog[containerInstanceID]))
+	copy(out, u.transitionLog[containerInstanceID])
+	return out
+}
+
+// resumeState loads any state a previous, possibly crashed, updater run
+// persisted for containerInstanceID while updating it to targetVersion.
+// Every step updateOne drives an instance through is idempotent against its
+// own prior effect (draining an already-draining instance, re-applying an
+// update, or activating an already-active one are all no-ops), so the only
+// checkpoint worth short-circuiting on is stateDone: anything else just
+// restarts the flow from the top, which is always safe. A persisted state
+// for a different targetVersion is stale (the instance finished a prior
+// update and is now a candidate for a newer one) and is ignored.
+func (u *updater) resumeState(ctx context.Context, containerInstanceID, targetVersion string) updateState {
+	if u.stateStore == nil {
+		return ""
+	}
+	state, persistedVersion, ok, err := u.stateStore.Load(ctx, containerInstanceID)
+	if err != nil {
+		log.Printf("Failed to load persisted state for instance %q; resuming from the start: %v", containerInstanceID, err)
+		return ""
+	}
+	if !ok || persistedVersion != targetVersion {
+		return ""
+	}
+	if state != stateDone {
+		log.Printf("Instance %q has in-flight state %q from a previous run targeting version %q; restarting its update from the top", containerInstanceID, state, targetVersion)
+	}
+	return state
+}
+
+// DynamoDBAPI is the subset of the DynamoDB API used to persist update state.
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+const (
+	stateTableContainerInstanceIDAttr = "container_instance_id"
+	stateTableStateAttr               = "state"
+	stateTableTargetVersionAttr       = "target_version"
+)
+
+// dynamoStateStore implements StateStore against a DynamoDB table keyed by
+// container_instance_id, with a single state attribute.
+type dynamoStateStore struct {
+	client    DynamoDBAPI
+	tableName string
+}
+
+// newDynamoStateStore builds a StateStore backed by the named DynamoDB table.
+func newDynamoStateStore(client DynamoDBAPI, tableName string) *dynamoStateStore {
+	return &dynamoStateStore{client: client, tableName: tableName}
+}
+
+func (s *dynamoStateStore) Save(ctx context.Context, containerInstanceID string, state updateState, targetVersion string) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &s.tableName,
+		Item: map[string]types.AttributeValue{
+			stateTableContainerInstanceIDAttr: &types.AttributeValueMemberS{Value: containerInstanceID},
+			stateTableStateAttr:               &types.AttributeValueMemberS{Value: string(state)},
+			stateTableTargetVersionAttr:       &types.AttributeValueMemberS{Value: targetVersion},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save state to table %q: %w", s.tableName, err)
+	}
+	return nil
+}
+
+func (s *dynamoStateStore) Load(ctx context.Context, containerInstanceID string) (updateState, string, bool, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &s.tableName,
+		Key: map[string]types.AttributeValue{
+			stateTableContainerInstanceIDAttr: &types.AttributeValueMemberS{Value: containerInstanceID},
+		},
+	})
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to load state from table %q: %w", s.tableName, err)
+	}
+	if out.Item == nil {
+		return "", "", false, nil
+	}
+	attr, ok := out.Item[stateTableStateAttr].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", "", false, nil
+	}
+	var targetVersion string
+	if v, ok := out.Item[stateTableTargetVersionAttr].(*types.AttributeValueMemberS); ok {
+		targetVersion = v.Value
+	}
+	return updateState(attr.Value), targetVersion, true, nil
+}
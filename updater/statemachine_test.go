@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamoStateStoreSaveAndLoad(t *testing.T) {
+	saved := map[string]types.AttributeValue{}
+	mockDynamo := MockDynamoDB{
+		PutItemFn: func(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			saved = input.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: saved}, nil
+		},
+	}
+
+	store := newDynamoStateStore(mockDynamo, "update-state")
+	require.NoError(t, store.Save(context.Background(), "ci-1", stateDraining, "v1.1.0"))
+	idAttr, ok := saved[stateTableContainerInstanceIDAttr].(*types.AttributeValueMemberS)
+	require.True(t, ok)
+	assert.Equal(t, "ci-1", idAttr.Value)
+	stateAttr, ok := saved[stateTableStateAttr].(*types.AttributeValueMemberS)
+	require.True(t, ok)
+	assert.Equal(t, "Draining", stateAttr.Value)
+	versionAttr, ok := saved[stateTableTargetVersionAttr].(*types.AttributeValueMemberS)
+	require.True(t, ok)
+	assert.Equal(t, "v1.1.0", versionAttr.Value)
+
+	state, targetVersion, ok, err := store.Load(context.Background(), "ci-1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, stateDraining, state)
+	assert.Equal(t, "v1.1.0", targetVersion)
+}
+
+func TestDynamoStateStoreLoadMissing(t *testing.T) {
+	mockDynamo := MockDynamoDB{
+		GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{}, nil
+		},
+	}
+	store := newDynamoStateStore(mockDynamo, "update-state")
+	_, _, ok, err := store.Load(context.Background(), "ci-missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestNewStateStoreFromEnvUnset(t *testing.T) {
+	withEnv(t, updateStateTableEnv, "")
+	assert.Nil(t, newStateStoreFromEnv(MockDynamoDB{}))
+}
+
+func TestUpdaterSetStateToleratesNilStore(t *testing.T) {
+	u := &updater{}
+	// Should not panic when stateStore is unset, as is the case in most existing tests.
+	u.setState(context.Background(), "ci-1", stateDone, "v1.1.0")
+}
+
+func TestUpdaterTransitions(t *testing.T) {
+	u := &updater{}
+	u.setState(context.Background(), "ci-1", stateChecking, "v1.1.0")
+	u.setState(context.Background(), "ci-1", stateDraining, "v1.1.0")
+	u.setState(context.Background(), "ci-2", stateChecking, "v1.1.0")
+
+	assert.Equal(t, []updateState{stateChecking, stateDraining}, u.transitions("ci-1"))
+	assert.Equal(t, []updateState{stateChecking}, u.transitions("ci-2"))
+	assert.Empty(t, u.transitions("ci-missing"))
+}
+
+func TestUpdaterResumeState(t *testing.T) {
+	t.Run("no state store", func(t *testing.T) {
+		u := &updater{}
+		assert.Equal(t, updateState(""), u.resumeState(context.Background(), "ci-1", "v1.1.0"))
+	})
+
+	t.Run("no persisted state", func(t *testing.T) {
+		mockDynamo := MockDynamoDB{
+			GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{}, nil
+			},
+		}
+		u := &updater{stateStore: newDynamoStateStore(mockDynamo, "update-state")}
+		assert.Equal(t, updateState(""), u.resumeState(context.Background(), "ci-1", "v1.1.0"))
+	})
+
+	t.Run("in-flight state for the same target version", func(t *testing.T) {
+		mockDynamo := MockDynamoDB{
+			GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					stateTableStateAttr:         &types.AttributeValueMemberS{Value: string(stateApplying)},
+					stateTableTargetVersionAttr: &types.AttributeValueMemberS{Value: "v1.1.0"},
+				}}, nil
+			},
+		}
+		u := &updater{stateStore: newDynamoStateStore(mockDynamo, "update-state")}
+		assert.Equal(t, stateApplying, u.resumeState(context.Background(), "ci-1", "v1.1.0"))
+	})
+
+	t.Run("done state for the same target version", func(t *testing.T) {
+		mockDynamo := MockDynamoDB{
+			GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					stateTableStateAttr:         &types.AttributeValueMemberS{Value: string(stateDone)},
+					stateTableTargetVersionAttr: &types.AttributeValueMemberS{Value: "v1.1.0"},
+				}}, nil
+			},
+		}
+		u := &updater{stateStore: newDynamoStateStore(mockDynamo, "update-state")}
+		assert.Equal(t, stateDone, u.resumeState(context.Background(), "ci-1", "v1.1.0"))
+	})
+
+	t.Run("done state for a stale target version is ignored", func(t *testing.T) {
+		mockDynamo := MockDynamoDB{
+			GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					stateTableStateAttr:         &types.AttributeValueMemberS{Value: string(stateDone)},
+					stateTableTargetVersionAttr: &types.AttributeValueMemberS{Value: "v1.0.0"},
+				}}, nil
+			},
+		}
+		u := &updater{stateStore: newDynamoStateStore(mockDynamo, "update-state")}
+		assert.Equal(t, updateState(""), u.resumeState(context.Background(), "ci-1", "v1.1.0"))
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		mockDynamo := MockDynamoDB{
+			GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return nil, errors.New("boom")
+			},
+		}
+		u := &updater{stateStore: newDynamoStateStore(mockDynamo, "update-state")}
+		assert.Equal(t, updateState(""), u.resumeState(context.Background(), "ci-1", "v1.1.0"))
+	})
+}
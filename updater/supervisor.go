@@ -0,0 +1,651 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+const (
+	updateParallelismEnv     = "UPDATE_PARALLELISM"
+	updateMaxFailureRatioEnv = "UPDATE_MAX_FAILURE_RATIO"
+	updateFailureActionEnv   = "UPDATE_FAILURE_ACTION"
+	updateMonitorSecondsEnv  = "UPDATE_MONITOR_SECONDS"
+	updateMaxUnavailableEnv  = "UPDATE_MAX_UNAVAILABLE"
+	updateMaxPerAZEnv        = "UPDATE_MAX_PER_AZ"
+	updateOrderEnv           = "UPDATE_ORDER"
+
+	// failureActionContinue keeps dispatching candidates to the end of the
+	// batch even after maxFailureRatio is exceeded, and run returns without
+	// error; the budget is still logged as exceeded so operators notice.
+	failureActionContinue = "continue"
+	// failureActionPause stops dispatching any further candidates as soon as
+	// maxFailureRatio is exceeded (already in-flight instances still run to
+	// completion) and run returns an error, so a chained canary phase or
+	// scheduled invocation does not treat the run as having succeeded.
+	failureActionPause = "pause"
+	// failureActionRollback is rejected by newUpdateSupervisor: reverting an
+	// already-applied Bottlerocket update (the instance has rebooted into the
+	// new partition by the time a failure would be counted) isn't something
+	// this updater can do, so it's not offered as a silent no-op alongside
+	// the other two.
+	failureActionRollback = "rollback"
+
+	// updateOrderRandom shuffles candidates before dispatch, so a run that's
+	// aborted partway through isn't biased toward whichever AZ or instance
+	// type happened to sort first.
+	updateOrderRandom = "random"
+	// updateOrderByAZ and updateOrderByInstanceType group candidates so a
+	// run works through one AZ (or instance type) at a time.
+	updateOrderByAZ           = "by-az"
+	updateOrderByInstanceType = "by-instance-type"
+
+	defaultParallelism     = 1
+	defaultMaxFailureRatio = 1.0
+	// defaultMaxUnavailable of 0 means the unavailable-instance cap is taken
+	// entirely from drainHeadroom/parallelism, matching historical behavior.
+	defaultMaxUnavailable = 0
+	// defaultMaxPerAZ of 0 means no per-AZ cap is applied, matching historical
+	// behavior.
+	defaultMaxPerAZ    = 0
+	defaultUpdateOrder = updateOrderRandom
+	// defaultMonitorSeconds matches the historical fixed sleep before verifyUpdate.
+	defaultMonitorSeconds = 20
+
+	// verifyPollInterval is how often updateOne re-checks an instance's
+	// update state while waiting for it to reach its target version.
+	verifyPollInterval = 5 * time.Second
+)
+
+// updateSupervisor drives updates across a batch of eligible instances,
+// modeled after swarmkit's update.Supervisor: it bounds how many instances
+// are updated at once and aborts the run if too many of them fail.
+type updateSupervisor struct {
+	updater         *updater
+	parallelism     int
+	maxFailureRatio float64
+	failureAction   string
+	monitorSeconds  int
+	// maxUnavailable caps how many instances may be DRAINING or mid-update
+	// across the whole cluster at once, independent of parallelism (which
+	// only bounds how many goroutines are actively working). 0 means derive
+	// the cap from drainHeadroom/parallelism instead, as before this field
+	// existed.
+	maxUnavailable int
+	// maxUnavailablePercent, if non-zero, overrides maxUnavailable with a
+	// cap computed as a percentage of the cluster's total Bottlerocket
+	// instance count once run (or runCanary) knows it, so the cap scales
+	// with fleet size instead of needing to be re-tuned as it grows.
+	maxUnavailablePercent int
+	// maxPerAZ caps how many instances in the same availability zone may be
+	// DRAINING or mid-update at once, independent of maxUnavailable: a global
+	// cap alone can still let a run concentrate all its unavailable instances
+	// in a single AZ, which a multi-AZ service couldn't tolerate even if its
+	// overall desired count allows the headroom. 0 means no per-AZ cap.
+	maxPerAZ int
+	// updateOrder is one of updateOrderRandom, updateOrderByAZ, or
+	// updateOrderByInstanceType; any other value (including "") dispatches
+	// candidates in the order filterAvailableUpdates returned them.
+	updateOrder string
+}
+
+// newUpdateSupervisor builds an updateSupervisor from the UPDATE_* environment
+// variables, falling back to defaults equivalent to the updater's historical
+// serial, never-abort behavior. maxParallelFlag and maxUnavailableFlag are
+// the -max-parallel and -max-unavailable flag values; a zero/empty value
+// defers to the corresponding UPDATE_PARALLELISM/UPDATE_MAX_UNAVAILABLE
+// environment variable, while a set one overrides it.
+func newUpdateSupervisor(u *updater, maxParallelFlag int, maxUnavailableFlag string) (*updateSupervisor, error) {
+	parallelism := envInt(updateParallelismEnv, defaultParallelism)
+	if maxParallelFlag > 0 {
+		parallelism = maxParallelFlag
+	}
+
+	maxUnavailable, maxUnavailablePercent := envMaxUnavailable(updateMaxUnavailableEnv)
+	if maxUnavailableFlag != "" {
+		count, percent, err := parseMaxUnavailable(maxUnavailableFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -max-unavailable %q: %w", maxUnavailableFlag, err)
+		}
+		maxUnavailable, maxUnavailablePercent = count, percent
+	}
+
+	failureAction := envStringOrDefault(updateFailureActionEnv, failureActionContinue)
+	switch failureAction {
+	case failureActionContinue, failureActionPause:
+		// both implemented by run, below.
+	case failureActionRollback:
+		return nil, fmt.Errorf("%s=%q is not supported: this updater has no way to roll back an already-applied Bottlerocket update once an instance has rebooted into it; set %s=%s to stop dispatching further instances at the failure budget instead", updateFailureActionEnv, failureActionRollback, updateFailureActionEnv, failureActionPause)
+	default:
+		return nil, fmt.Errorf("invalid %s %q: must be %q or %q", updateFailureActionEnv, failureAction, failureActionContinue, failureActionPause)
+	}
+
+	return &updateSupervisor{
+		updater:               u,
+		parallelism:           parallelism,
+		maxFailureRatio:       envFloat(updateMaxFailureRatioEnv, defaultMaxFailureRatio),
+		failureAction:         failureAction,
+		monitorSeconds:        envInt(updateMonitorSecondsEnv, defaultMonitorSeconds),
+		maxUnavailable:        maxUnavailable,
+		maxUnavailablePercent: maxUnavailablePercent,
+		maxPerAZ:              envInt(updateMaxPerAZEnv, defaultMaxPerAZ),
+		updateOrder:           envStringOrDefault(updateOrderEnv, defaultUpdateOrder),
+	}, nil
+}
+
+// parseMaxUnavailable parses raw as either a plain integer (an absolute
+// instance count) or a percentage such as "20%" (a share of the cluster's
+// total instance count, resolved once that total is known). It returns
+// whichever form raw held; the other return is 0. An empty raw resolves to
+// defaultMaxUnavailable.
+func parseMaxUnavailable(raw string) (count int, percent int, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return defaultMaxUnavailable, 0, nil
+	}
+	if trimmed := strings.TrimSuffix(raw, "%"); trimmed != raw {
+		p, err := strconv.Atoi(strings.TrimSpace(trimmed))
+		if err != nil || p <= 0 || p > 100 {
+			return 0, 0, fmt.Errorf("must be a percentage between 1%% and 100%%, got %q", raw)
+		}
+		return 0, p, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("must be an absolute count or a percentage like \"20%%\", got %q", raw)
+	}
+	return n, 0, nil
+}
+
+// envMaxUnavailable parses the UPDATE_MAX_UNAVAILABLE-style environment
+// variable named by key via parseMaxUnavailable, logging and falling back to
+// defaultMaxUnavailable on an invalid value rather than failing the run.
+func envMaxUnavailable(key string) (count int, percent int) {
+	count, percent, err := parseMaxUnavailable(os.Getenv(key))
+	if err != nil {
+		log.Printf("Ignoring invalid %s: %v", key, err)
+		return defaultMaxUnavailable, 0
+	}
+	return count, percent
+}
+
+// resolveMaxUnavailable returns the absolute maxUnavailable count to apply
+// for a run against a cluster of totalInstances Bottlerocket instances,
+// resolving maxUnavailablePercent against it if it was set. The result is
+// never less than 1 when maxUnavailablePercent is set, so a small cluster
+// and a low percentage still permit forward progress.
+func (s *updateSupervisor) resolveMaxUnavailable(totalInstances int) int {
+	if s.maxUnavailablePercent <= 0 {
+		return s.maxUnavailable
+	}
+	n := totalInstances * s.maxUnavailablePercent / 100
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Ignoring invalid %s %q: %v", key, v, err)
+		return fallback
+	}
+	return n
+}
+
+func envFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("Ignoring invalid %s %q: %v", key, v, err)
+		return fallback
+	}
+	return f
+}
+
+func envStringOrDefault(key, fallback string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	return v
+}
+
+// orderCandidates returns a copy of candidates arranged per s.updateOrder.
+// Any value other than updateOrderRandom, updateOrderByAZ, or
+// updateOrderByInstanceType (including "") leaves them in the order
+// filterAvailableUpdates returned them.
+func (s *updateSupervisor) orderCandidates(candidates []instance) []instance {
+	ordered := make([]instance, len(candidates))
+	copy(ordered, candidates)
+	switch s.updateOrder {
+	case updateOrderRandom:
+		rand.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	case updateOrderByAZ:
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].availabilityZone < ordered[j].availabilityZone })
+	case updateOrderByInstanceType:
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].instanceType < ordered[j].instanceType })
+	}
+	return ordered
+}
+
+// azSemaphores builds a per-availability-zone semaphore for each AZ present
+// in candidates, sized to s.maxPerAZ. It returns nil if maxPerAZ is unset, in
+// which case callers should skip AZ-capping entirely.
+func (s *updateSupervisor) azSemaphores(candidates []instance) map[string]chan struct{} {
+	if s.maxPerAZ <= 0 {
+		return nil
+	}
+	sems := make(map[string]chan struct{})
+	for _, i := range candidates {
+		if _, ok := sems[i.availabilityZone]; !ok {
+			sems[i.availabilityZone] = make(chan struct{}, s.maxPerAZ)
+		}
+	}
+	return sems
+}
+
+// instanceGroupSemaphores builds a semaphore for each distinct
+// bottlerocket.updater/max-unavailable value present in candidates, sized to
+// the cap encoded in that value, so operators can cap how many instances
+// sharing an identical attribute value (e.g. all instances backing a
+// singleton dependency) may be DRAINING or mid-update at once, independent of
+// -max-unavailable/UPDATE_MAX_UNAVAILABLE which applies cluster-wide. An
+// instance with the attribute unset gets no entry, same as an unparseable or
+// non-positive value -- instanceGroupSemaphores only bounds concurrency, so
+// it fails open rather than rejecting the instance the way instanceUpdateGate
+// does for bottlerocket.updater/policy.
+func (s *updateSupervisor) instanceGroupSemaphores(candidates []instance) map[string]chan struct{} {
+	sems := make(map[string]chan struct{})
+	for _, i := range candidates {
+		if i.updateMaxUnavailable == "" {
+			continue
+		}
+		if _, ok := sems[i.updateMaxUnavailable]; ok {
+			continue
+		}
+		n, err := strconv.Atoi(i.updateMaxUnavailable)
+		if err != nil || n <= 0 {
+			log.Printf("Ignoring invalid %s attribute %q on instance %q", instanceMaxUnavailableAttributeKey, i.updateMaxUnavailable, i.instanceID)
+			continue
+		}
+		sems[i.updateMaxUnavailable] = make(chan struct{}, n)
+	}
+	return sems
+}
+
+// run updates candidates with bounded parallelism, aborting once more than
+// maxFailureRatio of them have failed. totalInstances is the number of
+// Bottlerocket instances in the whole cluster, used to keep the batch from
+// draining more instances than the busiest service's desired count allows.
+func (s *updateSupervisor) run(ctx context.Context, candidates []instance, totalInstances int) (map[string]string, error) {
+	summary := make(map[string]string)
+	if len(candidates) == 0 {
+		return summary, nil
+	}
+	ordered := s.orderCandidates(candidates)
+
+	parallelism := s.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	headroom, err := s.drainHeadroom(ctx, totalInstances)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine cluster drain headroom: %w", err)
+	}
+	if headroom > 0 && parallelism > headroom {
+		log.Printf("Reducing update parallelism from %d to %d to preserve service capacity", parallelism, headroom)
+		parallelism = headroom
+	}
+
+	// unavailableCap bounds how many instances may be DRAINING or mid-update
+	// at once, separately from parallelism: parallelism lets workers run
+	// their SSM check/apply/reboot phases concurrently, but the cluster can
+	// only ever afford to have so many instances unavailable at a time.
+	unavailableCap := parallelism
+	if headroom > 0 && headroom < unavailableCap {
+		unavailableCap = headroom
+	}
+	if maxUnavailable := s.resolveMaxUnavailable(totalInstances); maxUnavailable > 0 && maxUnavailable < unavailableCap {
+		unavailableCap = maxUnavailable
+	}
+
+	maxFailures := len(ordered)
+	if s.maxFailureRatio < 1.0 {
+		maxFailures = int(s.maxFailureRatio * float64(len(ordered)))
+	}
+
+	type result struct {
+		instanceID string
+		outcome    string
+		failed     bool
+	}
+
+	sem := make(chan struct{}, parallelism)
+	unavailableSem := make(chan struct{}, unavailableCap)
+	azSems := s.azSemaphores(ordered)
+	groupSems := s.instanceGroupSemaphores(ordered)
+	resultsCh := make(chan result, len(ordered))
+	var wg sync.WaitGroup
+	var aborted int32
+	var mu sync.Mutex
+	failures := 0
+
+dispatch:
+	for _, inst := range ordered {
+		if atomic.LoadInt32(&aborted) == 1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i instance) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			select {
+			case unavailableSem <- struct{}{}:
+				defer func() { <-unavailableSem }()
+			case <-ctx.Done():
+				resultsCh <- result{instanceID: i.instanceID, outcome: fmt.Sprintf("Skipped: %v", ctx.Err()), failed: true}
+				return
+			}
+
+			if azSem, ok := azSems[i.availabilityZone]; ok {
+				select {
+				case azSem <- struct{}{}:
+					defer func() { <-azSem }()
+				case <-ctx.Done():
+					resultsCh <- result{instanceID: i.instanceID, outcome: fmt.Sprintf("Skipped: %v", ctx.Err()), failed: true}
+					return
+				}
+			}
+
+			if groupSem, ok := groupSems[i.updateMaxUnavailable]; ok {
+				select {
+				case groupSem <- struct{}{}:
+					defer func() { <-groupSem }()
+				case <-ctx.Done():
+					resultsCh <- result{instanceID: i.instanceID, outcome: fmt.Sprintf("Skipped: %v", ctx.Err()), failed: true}
+					return
+				}
+			}
+
+			outcome, failed := s.updater.updateOne(ctx, i, time.Duration(s.monitorSeconds)*time.Second)
+			resultsCh <- result{instanceID: i.instanceID, outcome: outcome, failed: failed}
+			if !failed {
+				return
+			}
+
+			mu.Lock()
+			failures++
+			exceeded := failures > maxFailures
+			mu.Unlock()
+			// failureActionContinue deliberately leaves aborted unset: the
+			// budget still gets reported below, but dispatch keeps going
+			// rather than stopping the batch partway through.
+			if exceeded && s.failureAction == failureActionPause {
+				atomic.StoreInt32(&aborted, 1)
+			}
+		}(inst)
+	}
+	wg.Wait()
+	close(resultsCh)
+	for r := range resultsCh {
+		summary[r.instanceID] = r.outcome
+	}
+
+	// Published once per run/runCanary batch (runCanary calls run twice: once
+	// for the canary batch, once for the remainder), so a canary strategy
+	// produces two RunSummary events rather than a single one for the whole
+	// invocation.
+	s.updater.publish(ctx, updateEvent{
+		Cluster:            s.updater.cluster,
+		Status:             eventRunSummary,
+		Timestamp:          time.Now(),
+		TotalInstances:     len(summary),
+		SucceededInstances: len(summary) - failures,
+		FailedInstances:    failures,
+	})
+	s.updater.publishMetric(ctx, metricInstancesUpdated, float64(len(summary)-failures), cloudwatchtypes.StandardUnitCount)
+	s.updater.publishMetric(ctx, metricInstancesFailed, float64(failures), cloudwatchtypes.StandardUnitCount)
+
+	if atomic.LoadInt32(&aborted) == 1 {
+		log.Printf("Failure budget exceeded (%d failures allowed); pausing remaining instances for this run (%s=%s)", maxFailures, updateFailureActionEnv, failureActionPause)
+		return summary, fmt.Errorf("aborting update run: more than %d instance(s) failed to update", maxFailures)
+	}
+	if failures > maxFailures {
+		log.Printf("Failure budget exceeded (%d failures allowed, %d actual) but continuing per %s=%s", maxFailures, failures, updateFailureActionEnv, failureActionContinue)
+	}
+	if ctx.Err() != nil {
+		return summary, fmt.Errorf("update run cancelled after updating %d of %d instance(s): %w", len(summary), len(ordered), ctx.Err())
+	}
+	return summary, nil
+}
+
+// drainHeadroom returns the maximum number of instances that can safely be
+// drained at once without leaving any ECS service short of its desired
+// count. It returns 0 (no limit) if the cluster has no services.
+func (s *updateSupervisor) drainHeadroom(ctx context.Context, totalInstances int) (int, error) {
+	list, err := s.updater.ecs.ListServices(ctx, &ecs.ListServicesInput{Cluster: &s.updater.cluster})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list services: %w", err)
+	}
+	if len(list.ServiceArns) == 0 {
+		return 0, nil
+	}
+
+	desc, err := s.updater.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  &s.updater.cluster,
+		Services: list.ServiceArns,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe services: %w", err)
+	}
+
+	var maxDesired int32
+	for _, svc := range desc.Services {
+		if d := svc.DesiredCount; d > maxDesired {
+			maxDesired = d
+		}
+	}
+
+	headroom := totalInstances - int(maxDesired)
+	if headroom < 1 {
+		headroom = 1
+	}
+	return headroom, nil
+}
+
+// updateOne runs the eligible -> drain -> update -> activate -> verify flow
+// for a single instance and returns a human-readable outcome for the
+// after-action summary along with whether the instance failed to update.
+func (u *updater) updateOne(ctx context.Context, i instance, monitorDuration time.Duration) (string, bool) {
+	resumed := u.resumeState(ctx, i.containerInstanceID, i.targetVersion)
+	if resumed == stateDone {
+		log.Printf("Instance %#q already completed its update in a previous run; skipping", i)
+		return "Instance already updated in a previous run", false
+	}
+
+	// Only gate a fresh start on the instance's policy attribute: resumed
+	// (non-empty, non-Done) state means a previous run left it mid-flight
+	// (e.g. DRAINING), and that must always be carried through to a safe
+	// terminal state regardless of a policy attribute set since then.
+	if resumed == "" {
+		if allowed, reason := instanceUpdateGate(i, time.Now()); !allowed {
+			log.Printf("Instance %#q is not updated this run: %s", i, reason)
+			if u.dryRun {
+				u.plan.add(planEntry{
+					ContainerInstanceID: i.containerInstanceID,
+					EC2InstanceID:       i.instanceID,
+					CurrentVersion:      i.bottlerocketVersion,
+					TargetVersion:       i.targetVersion,
+					BlockingReason:      reason,
+				})
+				return "Dry run: blocked, " + reason, false
+			}
+			return "Skipped: " + reason, false
+		}
+	}
+
+	u.setState(ctx, i.containerInstanceID, stateChecking, i.targetVersion)
+	eligible, err := u.eligible(ctx, i.containerInstanceID)
+	if err != nil {
+		log.Printf("Failed to determine eligibility for update of instance %#q: %v", i, err)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed to determine eligibility for update: %v", err), true
+	}
+	if !eligible {
+		log.Printf("Instance %#q is not eligible for updates because it contains non-service task", i)
+		if u.dryRun {
+			u.plan.add(planEntry{
+				ContainerInstanceID: i.containerInstanceID,
+				EC2InstanceID:       i.instanceID,
+				CurrentVersion:      i.bottlerocketVersion,
+				TargetVersion:       i.targetVersion,
+				BlockingReason:      "instance contains non-service task(s)",
+			})
+			return "Dry run: blocked, not eligible for updates", false
+		}
+		// Ineligibility is a routine skip, not a failure: plenty of clusters
+		// run a normal share of instances with ad-hoc/standalone tasks, and
+		// that must not eat into the failure budget (run, below) or inflate
+		// metricInstancesFailed, which chunk5-5 wired up to back a
+		// failure-rate alarm for things that actually went wrong.
+		return "Skipped: instance is not eligible for updates because it contains non-service task(s)", false
+	}
+	log.Printf("Instance %q is eligible for update", i)
+
+	if u.dryRun {
+		u.plan.add(planEntry{
+			ContainerInstanceID: i.containerInstanceID,
+			EC2InstanceID:       i.instanceID,
+			CurrentVersion:      i.bottlerocketVersion,
+			TargetVersion:       i.targetVersion,
+		})
+		log.Printf("Dry run: would update instance %#q from %q to %q", i, i.bottlerocketVersion, i.targetVersion)
+		return "Dry run: would update", false
+	}
+
+	u.setState(ctx, i.containerInstanceID, stateDraining, i.targetVersion)
+	// ECS container-instance state transitions are serialized across workers
+	// (unlike the SSM check/apply/reboot calls below, which run fully
+	// concurrently) to avoid racing concurrent DRAINING/ACTIVE transitions
+	// against each other from different goroutines.
+	u.ecsStateMu.Lock()
+	services, err := u.drainInstance(ctx, i.containerInstanceID)
+	u.ecsStateMu.Unlock()
+	if err != nil {
+		log.Printf("Failed to drain instance %#q: %v", i, err)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed to drain: %v", err), true
+	}
+	log.Printf("Instance %#q successfully drained!", i)
+
+	u.setState(ctx, i.containerInstanceID, stateApplying, i.targetVersion)
+	updateErr := u.updateInstance(ctx, i)
+	if errors.Is(updateErr, errInstancePowerCycleFailed) {
+		log.Printf("Failed to power-cycle instance %#q: %v; leaving it drained for inspection", i, updateErr)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed to update: %v", updateErr), true
+	}
+
+	u.setState(ctx, i.containerInstanceID, stateRebooting, i.targetVersion)
+	u.ecsStateMu.Lock()
+	activateErr := u.activateInstance(ctx, i.containerInstanceID)
+	u.ecsStateMu.Unlock()
+	if updateErr != nil && activateErr != nil {
+		log.Printf("Failed to update instance %#q: %v", i, updateErr)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed to re-activate after failing to update: %v", activateErr), true
+	} else if updateErr != nil {
+		log.Printf("Failed to update instance %#q: %v", i, updateErr)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed to update: %v", updateErr), true
+	} else if activateErr != nil {
+		log.Printf("Failed to re-activate instance %#q after update: %v", i, activateErr)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed to re-activate after update: %v", activateErr), true
+	}
+
+	if err := u.postUpdateHealthGate(ctx, i); err != nil {
+		log.Printf("Instance %#q failed its post-update health gate: %v", i, err)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Failed post-update health gate: %v", err), true
+	}
+
+	u.setState(ctx, i.containerInstanceID, stateVerifyingServices, i.targetVersion)
+	if err := u.waitForServicesStable(ctx, services); err != nil {
+		log.Printf("Services did not stabilize on instance %#q after reactivation: %v", i, err)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return fmt.Sprintf("Instance reactivated but services did not stabilize: %v", err), true
+	}
+
+	if monitorDuration <= 0 {
+		monitorDuration = defaultMonitorSeconds * time.Second
+	}
+
+	u.setState(ctx, i.containerInstanceID, stateAwaitingSSMAgent, i.targetVersion)
+	var verified bool
+	var verifyErr error
+	var verifyReason, verifyTarget string
+	pollErr := poll(verifyPollInterval, monitorDuration, func() (bool, error) {
+		u.setState(ctx, i.containerInstanceID, stateVerifying, i.targetVersion)
+		ok, target, reason, err := u.verifyUpdate(ctx, i)
+		verifyReason = reason
+		verifyTarget = target
+		if err != nil {
+			// The SSM agent may not be ready to accept commands yet right
+			// after a reboot (or the instance may be stuck on a version/policy
+			// violation, which also reports a non-nil err here); keep polling
+			// rather than failing immediately, but remember reason/target from
+			// this attempt so a final timeout still logs something specific
+			// instead of the generic "Update failed".
+			verifyErr = err
+			return false, nil
+		}
+		verified = ok
+		return true, nil
+	})
+	if pollErr != nil {
+		log.Printf("Failed to verify update for instance %#q: %v", i, pollErr)
+	}
+	if verifyErr != nil {
+		log.Printf("Last verification attempt for instance %#q returned an error: %v", i, verifyErr)
+	}
+	if !verified {
+		msg := "Update failed"
+		if verifyReason != "" {
+			msg = fmt.Sprintf("Update failed: %s", verifyReason)
+		}
+		log.Printf("%s for instance %#q", msg, i)
+		u.setState(ctx, i.containerInstanceID, stateFailed, i.targetVersion)
+		return msg, true
+	}
+	log.Printf("Instance %#q updated successfully to version %q!", i, verifyTarget)
+	u.setState(ctx, i.containerInstanceID, stateDone, i.targetVersion)
+	return "Instance updated successfully", false
+}
@@ -0,0 +1,1191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamotypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpdateSupervisorFailureBudgetPauseAborts simulates a batch where more
+// instances fail to drain than the configured max-failure-ratio allows with
+// UPDATE_FAILURE_ACTION=pause, and asserts that the run is reported as
+// aborted while still reporting every attempted instance.
+func TestUpdateSupervisorFailureBudgetPauseAborts(t *testing.T) {
+	failingContainerInstances := map[string]bool{
+		"ci-2": true,
+		"ci-3": true,
+	}
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			containerInstance := input.ContainerInstances[0]
+			if input.Status == types.ContainerInstanceStatusDraining && failingContainerInstances[containerInstance] {
+				return &ecs.UpdateContainerInstancesStateOutput{
+					Failures: []types.Failure{{Reason: aws.String("boom")}},
+				}, nil
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     4,
+		maxFailureRatio: 0.25,
+		failureAction:   failureActionPause,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-3", containerInstanceID: "ci-3", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-4", containerInstanceID: "ci-4", bottlerocketVersion: "v1.0.0"},
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 4)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "aborting update run")
+	assert.Len(t, summary, 4)
+	assert.Equal(t, "Instance updated successfully", summary["i-1"])
+	assert.Equal(t, "Instance updated successfully", summary["i-4"])
+	assert.Contains(t, summary["i-2"], "Failed to drain")
+	assert.Contains(t, summary["i-3"], "Failed to drain")
+}
+
+// TestUpdateSupervisorFailureBudgetContinueRunsToCompletion covers the same
+// over-budget batch as TestUpdateSupervisorFailureBudgetPauseAborts, but with
+// UPDATE_FAILURE_ACTION=continue (the default): every candidate must still be
+// attempted and run must not report an error, since "continue" means the run
+// proceeds past the failure budget rather than stopping at it.
+func TestUpdateSupervisorFailureBudgetContinueRunsToCompletion(t *testing.T) {
+	failingContainerInstances := map[string]bool{
+		"ci-2": true,
+		"ci-3": true,
+	}
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			containerInstance := input.ContainerInstances[0]
+			if input.Status == types.ContainerInstanceStatusDraining && failingContainerInstances[containerInstance] {
+				return &ecs.UpdateContainerInstancesStateOutput{
+					Failures: []types.Failure{{Reason: aws.String("boom")}},
+				}, nil
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     1,
+		maxFailureRatio: 0.25,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-3", containerInstanceID: "ci-3", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-4", containerInstanceID: "ci-4", bottlerocketVersion: "v1.0.0"},
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 4)
+	require.NoError(t, err)
+	assert.Len(t, summary, 4, "every candidate must be attempted despite exceeding the failure budget")
+	assert.Equal(t, "Instance updated successfully", summary["i-1"])
+	assert.Equal(t, "Instance updated successfully", summary["i-4"])
+	assert.Contains(t, summary["i-2"], "Failed to drain")
+	assert.Contains(t, summary["i-3"], "Failed to drain")
+}
+
+// TestUpdateSupervisorWithinBudget covers the common case where failures
+// stay within the allowed ratio and the run completes without error.
+func TestUpdateSupervisorWithinBudget(t *testing.T) {
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     2,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0"},
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Instance updated successfully", summary["i-1"])
+	assert.Equal(t, "Instance updated successfully", summary["i-2"])
+}
+
+// recordingEventPublisher collects every published event for assertions,
+// guarded by a mutex since run() publishes from multiple worker goroutines.
+type recordingEventPublisher struct {
+	mu     sync.Mutex
+	events []updateEvent
+}
+
+func (r *recordingEventPublisher) Publish(ctx context.Context, e updateEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// recordingMetricsPublisher collects every published metric for assertions,
+// guarded by a mutex since run() publishes from multiple worker goroutines.
+type recordingMetricsPublisher struct {
+	mu      sync.Mutex
+	metrics []runMetric
+}
+
+func (r *recordingMetricsPublisher) Publish(ctx context.Context, m runMetric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// TestUpdateSupervisorPublishesRunSummary asserts that run() publishes a
+// single eventRunSummary event reflecting the outcome of every candidate,
+// once the batch completes.
+func TestUpdateSupervisorPublishesRunSummary(t *testing.T) {
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	recorder := &recordingEventPublisher{}
+	metricsRecorder := &recordingMetricsPublisher{}
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+		events:        recorder,
+		metrics:       metricsRecorder,
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     2,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0"},
+	}
+
+	_, err := supervisor.run(context.Background(), candidates, 2)
+	require.NoError(t, err)
+
+	var summaries []updateEvent
+	for _, e := range recorder.events {
+		if e.Status == eventRunSummary {
+			summaries = append(summaries, e)
+		}
+	}
+	require.Len(t, summaries, 1, "expected exactly one RunSummary event for a single run() call")
+	assert.Equal(t, 2, summaries[0].TotalInstances)
+	assert.Equal(t, 2, summaries[0].SucceededInstances)
+	assert.Equal(t, 0, summaries[0].FailedInstances)
+
+	var updated, failed *runMetric
+	for i, m := range metricsRecorder.metrics {
+		switch m.Name {
+		case metricInstancesUpdated:
+			updated = &metricsRecorder.metrics[i]
+		case metricInstancesFailed:
+			failed = &metricsRecorder.metrics[i]
+		}
+	}
+	require.NotNil(t, updated, "expected an InstancesUpdated metric")
+	require.NotNil(t, failed, "expected an InstancesFailed metric")
+	assert.Equal(t, 2.0, updated.Value)
+	assert.Equal(t, 0.0, failed.Value)
+}
+
+// TestUpdateSupervisorMaxUnavailableLimitsConcurrentDrains asserts that no
+// more than maxUnavailable instances are ever DRAINING (or mid-update) at
+// once, even though parallelism alone would allow far more to run at a time.
+func TestUpdateSupervisorMaxUnavailableLimitsConcurrentDrains(t *testing.T) {
+	var mu sync.Mutex
+	unavailable := 0
+	peak := 0
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			mu.Lock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				unavailable++
+				if unavailable > peak {
+					peak = unavailable
+				}
+			} else {
+				unavailable--
+			}
+			mu.Unlock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				// Hold the DRAINING window open long enough that, with six
+				// workers contending for two unavailable slots, the cap
+				// actually gets exercised rather than the workers happening
+				// to run one after another.
+				time.Sleep(20 * time.Millisecond)
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     6,
+		maxUnavailable:  2,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := make([]instance, 0, 6)
+	for i := 1; i <= 6; i++ {
+		id := fmt.Sprintf("%d", i)
+		candidates = append(candidates, instance{instanceID: "i-" + id, containerInstanceID: "ci-" + id, bottlerocketVersion: "v1.0.0"})
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 6)
+	require.NoError(t, err)
+	assert.Len(t, summary, 6)
+	assert.Equal(t, 2, peak, "at most maxUnavailable instances should ever be DRAINING at once")
+}
+
+// TestUpdateSupervisorMaxPerAZLimitsConcurrentDrainsWithinAZ asserts that no
+// more than maxPerAZ instances in the same availability zone are ever
+// DRAINING at once, even though maxUnavailable alone would allow a run to
+// concentrate all its unavailable instances in a single AZ.
+func TestUpdateSupervisorMaxPerAZLimitsConcurrentDrainsWithinAZ(t *testing.T) {
+	var mu sync.Mutex
+	unavailableByAZ := map[string]int{}
+	peakByAZ := map[string]int{}
+	azByContainerInstance := map[string]string{
+		"ci-1": "az-1", "ci-2": "az-1", "ci-3": "az-1",
+		"ci-4": "az-2", "ci-5": "az-2", "ci-6": "az-2",
+	}
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			az := azByContainerInstance[input.ContainerInstances[0]]
+			mu.Lock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				unavailableByAZ[az]++
+				if unavailableByAZ[az] > peakByAZ[az] {
+					peakByAZ[az] = unavailableByAZ[az]
+				}
+			} else {
+				unavailableByAZ[az]--
+			}
+			mu.Unlock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				// Hold the DRAINING window open long enough that, with six
+				// workers contending for per-AZ slots, the cap actually gets
+				// exercised rather than the workers happening to run one
+				// after another.
+				time.Sleep(20 * time.Millisecond)
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     6,
+		maxPerAZ:        1,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := make([]instance, 0, 6)
+	for id, az := range azByContainerInstance {
+		candidates = append(candidates, instance{instanceID: "i-" + id, containerInstanceID: id, availabilityZone: az, bottlerocketVersion: "v1.0.0"})
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 6)
+	require.NoError(t, err)
+	assert.Len(t, summary, 6)
+	assert.Equal(t, 1, peakByAZ["az-1"], "at most maxPerAZ instances in az-1 should ever be DRAINING at once")
+	assert.Equal(t, 1, peakByAZ["az-2"], "at most maxPerAZ instances in az-2 should ever be DRAINING at once")
+}
+
+// TestUpdateSupervisorMaxUnavailableAttributeLimitsConcurrentDrainsWithinGroup
+// asserts that instances carrying an identical
+// bottlerocket.updater/max-unavailable attribute value are capped at that
+// value's concurrent DRAINING count, even though parallelism/maxUnavailable
+// alone would allow a run to drain every one of them at once.
+func TestUpdateSupervisorMaxUnavailableAttributeLimitsConcurrentDrainsWithinGroup(t *testing.T) {
+	var mu sync.Mutex
+	unavailableByGroup := map[string]int{}
+	peakByGroup := map[string]int{}
+	groupByContainerInstance := map[string]string{
+		"ci-1": "1", "ci-2": "1", "ci-3": "1",
+		"ci-4": "", "ci-5": "", "ci-6": "",
+	}
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			group := groupByContainerInstance[input.ContainerInstances[0]]
+			mu.Lock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				unavailableByGroup[group]++
+				if unavailableByGroup[group] > peakByGroup[group] {
+					peakByGroup[group] = unavailableByGroup[group]
+				}
+			} else {
+				unavailableByGroup[group]--
+			}
+			mu.Unlock()
+			if input.Status == types.ContainerInstanceStatusDraining && group == "1" {
+				// Hold the DRAINING window open long enough that, with three
+				// workers contending for the group's one slot, the cap
+				// actually gets exercised rather than the workers happening
+				// to run one after another.
+				time.Sleep(20 * time.Millisecond)
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     6,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := make([]instance, 0, 6)
+	for id, group := range groupByContainerInstance {
+		candidates = append(candidates, instance{instanceID: "i-" + id, containerInstanceID: id, updateMaxUnavailable: group, bottlerocketVersion: "v1.0.0"})
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 6)
+	require.NoError(t, err)
+	assert.Len(t, summary, 6)
+	assert.Equal(t, 1, peakByGroup["1"], "at most the group's bottlerocket.updater/max-unavailable value should ever be DRAINING at once")
+}
+
+// TestInstanceGroupSemaphores asserts the semaphore-sizing and
+// invalid-value-tolerance behavior of instanceGroupSemaphores directly,
+// without exercising a full run.
+func TestInstanceGroupSemaphores(t *testing.T) {
+	supervisor := &updateSupervisor{}
+	candidates := []instance{
+		{instanceID: "i-1", updateMaxUnavailable: "2"},
+		{instanceID: "i-2", updateMaxUnavailable: "2"},
+		{instanceID: "i-3", updateMaxUnavailable: "not-a-number"},
+		{instanceID: "i-4"},
+	}
+	sems := supervisor.instanceGroupSemaphores(candidates)
+	require.Contains(t, sems, "2")
+	assert.Equal(t, 2, cap(sems["2"]))
+	assert.NotContains(t, sems, "not-a-number")
+	assert.NotContains(t, sems, "")
+}
+
+// TestUpdateSupervisorMaxUnavailablePercentLimitsConcurrentDrains asserts
+// that maxUnavailablePercent resolves against the cluster's total instance
+// count and caps concurrent drains the same way an absolute maxUnavailable
+// would.
+func TestUpdateSupervisorMaxUnavailablePercentLimitsConcurrentDrains(t *testing.T) {
+	var mu sync.Mutex
+	unavailable := 0
+	peak := 0
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			mu.Lock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				unavailable++
+				if unavailable > peak {
+					peak = unavailable
+				}
+			} else {
+				unavailable--
+			}
+			mu.Unlock()
+			if input.Status == types.ContainerInstanceStatusDraining {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:               u,
+		parallelism:           6,
+		maxUnavailablePercent: 40,
+		maxFailureRatio:       1.0,
+		failureAction:         failureActionContinue,
+		monitorSeconds:        1,
+	}
+
+	candidates := make([]instance, 0, 6)
+	for i := 1; i <= 6; i++ {
+		id := fmt.Sprintf("%d", i)
+		candidates = append(candidates, instance{instanceID: "i-" + id, containerInstanceID: "ci-" + id, bottlerocketVersion: "v1.0.0"})
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 6)
+	require.NoError(t, err)
+	assert.Len(t, summary, 6)
+	assert.Equal(t, 2, peak, "40% of 6 instances should cap concurrent drains at 2")
+}
+
+// TestEnvMaxUnavailable covers the absolute-count, percentage, unset, and
+// invalid-percentage forms of UPDATE_MAX_UNAVAILABLE.
+func TestEnvMaxUnavailable(t *testing.T) {
+	t.Run("unset falls back to default", func(t *testing.T) {
+		os.Unsetenv(updateMaxUnavailableEnv)
+		count, percent := envMaxUnavailable(updateMaxUnavailableEnv)
+		assert.Equal(t, defaultMaxUnavailable, count)
+		assert.Equal(t, 0, percent)
+	})
+
+	t.Run("absolute count", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateMaxUnavailableEnv, "3"))
+		defer os.Unsetenv(updateMaxUnavailableEnv)
+		count, percent := envMaxUnavailable(updateMaxUnavailableEnv)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, 0, percent)
+	})
+
+	t.Run("percentage", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateMaxUnavailableEnv, "20%"))
+		defer os.Unsetenv(updateMaxUnavailableEnv)
+		count, percent := envMaxUnavailable(updateMaxUnavailableEnv)
+		assert.Equal(t, 0, count)
+		assert.Equal(t, 20, percent)
+	})
+
+	t.Run("invalid percentage falls back to default", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateMaxUnavailableEnv, "150%"))
+		defer os.Unsetenv(updateMaxUnavailableEnv)
+		count, percent := envMaxUnavailable(updateMaxUnavailableEnv)
+		assert.Equal(t, defaultMaxUnavailable, count)
+		assert.Equal(t, 0, percent)
+	})
+}
+
+// TestResolveMaxUnavailable covers both the plain-count passthrough and
+// percentage-resolution paths, including the floor of 1 for a nonzero
+// percentage of a small cluster.
+func TestResolveMaxUnavailable(t *testing.T) {
+	s := &updateSupervisor{maxUnavailable: 4}
+	assert.Equal(t, 4, s.resolveMaxUnavailable(100))
+
+	s = &updateSupervisor{maxUnavailablePercent: 20}
+	assert.Equal(t, 2, s.resolveMaxUnavailable(10))
+
+	s = &updateSupervisor{maxUnavailablePercent: 1}
+	assert.Equal(t, 1, s.resolveMaxUnavailable(3), "a nonzero percentage should never resolve below 1")
+}
+
+// TestNewUpdateSupervisorFlagsOverrideEnv asserts that the -max-parallel and
+// -max-unavailable flags take precedence over UPDATE_PARALLELISM and
+// UPDATE_MAX_UNAVAILABLE when set, and that both env vars still apply when
+// the flags are left at their zero values.
+func TestNewUpdateSupervisorFlagsOverrideEnv(t *testing.T) {
+	t.Run("flags unset defers to env", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateParallelismEnv, "5"))
+		defer os.Unsetenv(updateParallelismEnv)
+		require.NoError(t, os.Setenv(updateMaxUnavailableEnv, "30%"))
+		defer os.Unsetenv(updateMaxUnavailableEnv)
+
+		s, err := newUpdateSupervisor(&updater{}, 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, 5, s.parallelism)
+		assert.Equal(t, 30, s.maxUnavailablePercent)
+	})
+
+	t.Run("flags set override env", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateParallelismEnv, "5"))
+		defer os.Unsetenv(updateParallelismEnv)
+		require.NoError(t, os.Setenv(updateMaxUnavailableEnv, "30%"))
+		defer os.Unsetenv(updateMaxUnavailableEnv)
+
+		s, err := newUpdateSupervisor(&updater{}, 2, "3")
+		require.NoError(t, err)
+		assert.Equal(t, 2, s.parallelism)
+		assert.Equal(t, 3, s.maxUnavailable)
+		assert.Equal(t, 0, s.maxUnavailablePercent)
+	})
+
+	t.Run("invalid -max-unavailable flag is rejected", func(t *testing.T) {
+		_, err := newUpdateSupervisor(&updater{}, 0, "not-a-number")
+		assert.Error(t, err)
+	})
+}
+
+// TestNewUpdateSupervisorValidatesFailureAction asserts that
+// UPDATE_FAILURE_ACTION is restricted to the values run actually implements
+// distinct behavior for, rather than silently accepting a value (rollback,
+// or a typo) that behaves identically to continue.
+func TestNewUpdateSupervisorValidatesFailureAction(t *testing.T) {
+	t.Run("continue and pause are accepted", func(t *testing.T) {
+		for _, action := range []string{failureActionContinue, failureActionPause} {
+			require.NoError(t, os.Setenv(updateFailureActionEnv, action))
+			s, err := newUpdateSupervisor(&updater{}, 0, "")
+			require.NoError(t, err)
+			assert.Equal(t, action, s.failureAction)
+		}
+		os.Unsetenv(updateFailureActionEnv)
+	})
+
+	t.Run("rollback is rejected as unsupported", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateFailureActionEnv, failureActionRollback))
+		defer os.Unsetenv(updateFailureActionEnv)
+		_, err := newUpdateSupervisor(&updater{}, 0, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("an unrecognized value is rejected", func(t *testing.T) {
+		require.NoError(t, os.Setenv(updateFailureActionEnv, "abort-immediately"))
+		defer os.Unsetenv(updateFailureActionEnv)
+		_, err := newUpdateSupervisor(&updater{}, 0, "")
+		assert.Error(t, err)
+	})
+}
+
+// TestUpdateSupervisorRespectsContextCancellation asserts that a cancelled
+// context surfaces through run as a wrapped context.Canceled error, rather
+// than being swallowed or reported only through the failure-budget path.
+func TestUpdateSupervisorRespectsContextCancellation(t *testing.T) {
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	checkOutputJSON := `{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     1,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-3", containerInstanceID: "ci-3", bottlerocketVersion: "v1.0.0"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := supervisor.run(ctx, candidates, 3)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Contains(t, err.Error(), "update run cancelled")
+}
+
+// TestUpdateOneRestoresActiveAcrossWorkersOnGenericFailure covers a non
+// power-cycle failure (in contrast to
+// TestUpdateOneLeavesInstanceDrainedOnPowerCycleFailure): every worker that
+// fails to apply an update must still reactivate its instance, and that must
+// hold concurrently across a whole batch, not just for a single instance.
+func TestUpdateOneRestoresActiveAcrossWorkersOnGenericFailure(t *testing.T) {
+	var mu sync.Mutex
+	activated := map[string]bool{}
+
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			if input.Status == types.ContainerInstanceStatusActive {
+				mu.Lock()
+				activated[input.ContainerInstances[0]] = true
+				mu.Unlock()
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	sendErr := errors.New("ssm unavailable")
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return nil, sendErr
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+		updateMode:    updateModeReboot,
+	}
+	supervisor := &updateSupervisor{
+		updater:         u,
+		parallelism:     4,
+		maxFailureRatio: 1.0,
+		failureAction:   failureActionContinue,
+		monitorSeconds:  1,
+	}
+
+	candidates := []instance{
+		{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-2", containerInstanceID: "ci-2", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-3", containerInstanceID: "ci-3", bottlerocketVersion: "v1.0.0"},
+		{instanceID: "i-4", containerInstanceID: "ci-4", bottlerocketVersion: "v1.0.0"},
+	}
+
+	summary, err := supervisor.run(context.Background(), candidates, 4)
+	require.NoError(t, err, "failures stay within the 1.0 max-failure-ratio budget")
+	require.Len(t, summary, 4)
+	for _, c := range candidates {
+		assert.Contains(t, summary[c.instanceID], "Failed to update")
+		assert.True(t, activated[c.containerInstanceID], "instance %q should be reactivated after a failed update", c.containerInstanceID)
+	}
+}
+
+// TestUpdateOneDryRunDoesNotMutateState asserts that a dry-run updater skips
+// drain/update/activate entirely and records the instance in its plan instead.
+func TestUpdateOneDryRunDoesNotMutateState(t *testing.T) {
+	mutated := false
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			mutated = true
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+
+	u := &updater{
+		cluster: "test-cluster",
+		ecs:     mockECS,
+		dryRun:  true,
+		plan:    &UpdatePlan{},
+	}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v1.1.0"}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.False(t, failed)
+	assert.Contains(t, outcome, "Dry run")
+	assert.False(t, mutated, "dry run must not call UpdateContainerInstancesState")
+	require.Len(t, u.plan.Entries, 1)
+	assert.Equal(t, "ci-1", u.plan.Entries[0].ContainerInstanceID)
+	assert.Equal(t, "v1.1.0", u.plan.Entries[0].TargetVersion)
+}
+
+// TestUpdateOneSkipsInstanceAlreadyDoneInPreviousRun covers the resume path:
+// if a previous (possibly crashed) updater run persisted stateDone for this
+// container instance, updateOne must not re-drive it through the flow again.
+func TestUpdateOneSkipsInstanceAlreadyDoneInPreviousRun(t *testing.T) {
+	mockDynamo := MockDynamoDB{
+		GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: map[string]dynamotypes.AttributeValue{
+				stateTableStateAttr:         &dynamotypes.AttributeValueMemberS{Value: string(stateDone)},
+				stateTableTargetVersionAttr: &dynamotypes.AttributeValueMemberS{Value: "v1.1.0"},
+			}}, nil
+		},
+	}
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			t.Fatal("updateOne must not re-check eligibility for an instance already marked Done")
+			return nil, nil
+		},
+	}
+
+	u := &updater{
+		cluster:    "test-cluster",
+		ecs:        mockECS,
+		stateStore: newDynamoStateStore(mockDynamo, "update-state"),
+	}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v1.1.0"}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.False(t, failed)
+	assert.Contains(t, outcome, "already updated")
+}
+
+// TestUpdateOneSkipsInstanceDisabledViaPolicyAttribute asserts that an
+// instance carrying bottlerocket.updater/policy=disabled is left untouched,
+// without ever checking eligibility or touching the state store.
+func TestUpdateOneSkipsInstanceDisabledViaPolicyAttribute(t *testing.T) {
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			t.Fatal("updateOne must not check eligibility for an instance opted out via its policy attribute")
+			return nil, nil
+		},
+	}
+
+	u := &updater{cluster: "test-cluster", ecs: mockECS}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v1.1.0", updatePolicy: instancePolicyDisabled}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.False(t, failed)
+	assert.Contains(t, outcome, "opted out via bottlerocket.updater/policy=disabled")
+}
+
+// TestUpdateOneDoesNotGateAResumedInFlightInstance asserts that an instance
+// left mid-flight by a previous, interrupted run (persisted state other than
+// Done) is carried through to completion even if a policy attribute opting
+// it out was set in the meantime, since abandoning it mid-flight (e.g.
+// DRAINING) would be unsafe.
+func TestUpdateOneDoesNotGateAResumedInFlightInstance(t *testing.T) {
+	mockDynamo := MockDynamoDB{
+		GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: map[string]dynamotypes.AttributeValue{
+				stateTableStateAttr:         &dynamotypes.AttributeValueMemberS{Value: string(stateDraining)},
+				stateTableTargetVersionAttr: &dynamotypes.AttributeValueMemberS{Value: "v1.1.0"},
+			}}, nil
+		},
+		PutItemFn: func(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+	eligibilityChecked := false
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			eligibilityChecked = true
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(`{"update_state": "Idle", "active_partition": { "image": { "version": "v9.9.9"}}}`),
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		checkDocument: "check-document",
+		stateStore:    newDynamoStateStore(mockDynamo, "update-state"),
+	}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v1.1.0", updatePolicy: instancePolicyDisabled}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.False(t, failed)
+	assert.NotContains(t, outcome, "opted out")
+	assert.True(t, eligibilityChecked, "a resumed in-flight instance must still run the eligible -> drain -> update -> verify flow")
+}
+
+// TestUpdateOneDoesNotSkipStaleDoneStateForANewerTargetVersion covers the
+// other side of the resume path: a stateDone record left over from a prior,
+// already-completed update (to an older target version) must not block this
+// run from updating the instance again to a newer target version.
+func TestUpdateOneDoesNotSkipStaleDoneStateForANewerTargetVersion(t *testing.T) {
+	mockDynamo := MockDynamoDB{
+		GetItemFn: func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: map[string]dynamotypes.AttributeValue{
+				stateTableStateAttr:         &dynamotypes.AttributeValueMemberS{Value: string(stateDone)},
+				stateTableTargetVersionAttr: &dynamotypes.AttributeValueMemberS{Value: "v1.0.0"},
+			}}, nil
+		},
+		PutItemFn: func(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+	eligibilityChecked := false
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			eligibilityChecked = true
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:    "test-cluster",
+		ecs:        mockECS,
+		stateStore: newDynamoStateStore(mockDynamo, "update-state"),
+		dryRun:     true,
+		plan:       &UpdatePlan{},
+	}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0", targetVersion: "v1.1.0"}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.False(t, failed)
+	assert.True(t, eligibilityChecked, "a stateDone record for a different target version must not be treated as already updated")
+	assert.Contains(t, outcome, "Dry run")
+}
+
+// TestUpdateOneLeavesInstanceDrainedOnPowerCycleFailure covers stop-start
+// mode: when the power-cycle fails, the instance's state through it is
+// unknown, so updateOne must leave it DRAINING rather than reactivate it.
+func TestUpdateOneLeavesInstanceDrainedOnPowerCycleFailure(t *testing.T) {
+	activated := false
+	mockECS := MockECS{
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			if input.Status == types.ContainerInstanceStatusActive {
+				activated = true
+			}
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+	}
+	checkOutputJSON := `{"update_state": "Ready", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	stopErr := errors.New("failed to stop instance")
+	mockEC2 := MockEC2{
+		StopInstancesFn: func(ctx context.Context, input *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+			return nil, stopErr
+		},
+	}
+
+	u := &updater{
+		cluster:       "test-cluster",
+		ecs:           mockECS,
+		ssm:           mockSSM,
+		ec2:           mockEC2,
+		checkDocument: "check-document",
+		updateMode:    updateModeStopStart,
+	}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.True(t, failed)
+	assert.Contains(t, outcome, "Failed to update")
+	assert.False(t, activated, "instance must not be reactivated after a failed power-cycle")
+}
+
+// TestUpdateOneRollsBackWhenPostUpdateHealthGateFails runs the full
+// drain/update/activate sequence with a rollback document configured, and an
+// instance whose container instance never reports agentConnected after
+// reactivation. It asserts updateOne invokes the rollback document and
+// reports the instance as failed, rather than proceeding to verify/done.
+func TestUpdateOneRollsBackWhenPostUpdateHealthGateFails(t *testing.T) {
+	restoreSleep := fakeSleep(t)
+	defer restoreSleep()
+
+	var rolledBack bool
+	mockECS := MockECS{
+		ListServicesFn: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{}}, nil
+		},
+		ListTasksFn: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{}}, nil
+		},
+		UpdateContainerInstancesStateFn: func(ctx context.Context, input *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+			return &ecs.UpdateContainerInstancesStateOutput{Failures: []types.Failure{}}, nil
+		},
+		DescribeContainerInstancesFn: func(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+			return &ecs.DescribeContainerInstancesOutput{
+				ContainerInstances: []types.ContainerInstance{{
+					Status:         aws.String(string(types.ContainerInstanceStatusActive)),
+					AgentConnected: false,
+				}},
+			}, nil
+		},
+	}
+	checkOutputJSON := `{"update_state": "Ready", "active_partition": { "image": { "version": "v9.9.9"}}}`
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			if aws.ToString(input.DocumentName) == "rollback-document" {
+				rolledBack = true
+			}
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{
+				Status:                ssmtypes.CommandInvocationStatusSuccess,
+				StandardOutputContent: aws.String(checkOutputJSON),
+			}, nil
+		},
+	}
+	mockEC2 := MockEC2{
+		DescribeInstanceStatusFn: func(ctx context.Context, input *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+			return &ec2.DescribeInstanceStatusOutput{
+				InstanceStatuses: []ec2types.InstanceStatus{{
+					InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+				}},
+			}, nil
+		},
+	}
+
+	u := &updater{
+		cluster:                 "test-cluster",
+		ecs:                     mockECS,
+		ssm:                     mockSSM,
+		ec2:                     mockEC2,
+		checkDocument:           "check-document",
+		rebootDocument:          "reboot-document",
+		updateMode:              updateModeReboot,
+		rollbackDocument:        "rollback-document",
+		postUpdateHealthTimeout: 30 * time.Millisecond,
+	}
+
+	i := instance{instanceID: "i-1", containerInstanceID: "ci-1", bottlerocketVersion: "v1.0.0"}
+	outcome, failed := u.updateOne(context.Background(), i, 1)
+	assert.True(t, failed)
+	assert.Contains(t, outcome, "Failed post-update health gate")
+	assert.True(t, rolledBack, "rollback document should be sent when the post-update health gate fails")
+}
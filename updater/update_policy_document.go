@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// updatePolicyS3URIEnv, set to an s3://bucket/key URI, loads an
+	// UpdatePolicyDocument from S3 before every run, so operators can steer
+	// pin/skip_versions/max_unavailable/canary/window rules per cluster or
+	// tag without redeploying the updater task. Overridden by
+	// -update-policy-s3-uri. If both this and
+	// UPDATE_POLICY_SSM_PARAMETER/-update-policy-ssm-parameter resolve to a
+	// value, the S3 URI wins.
+	updatePolicyS3URIEnv = "UPDATE_POLICY_S3_URI"
+	// updatePolicySSMParameterEnv, set to an SSM parameter name, loads the
+	// same document from Parameter Store instead. Overridden by
+	// -update-policy-ssm-parameter.
+	updatePolicySSMParameterEnv = "UPDATE_POLICY_SSM_PARAMETER"
+)
+
+// CanaryPolicy requests the canary rollout strategy, in the same units as
+// -canary-count/-bake-duration (see canary.go).
+type CanaryPolicy struct {
+	Count       int `json:"count,omitempty" yaml:"count,omitempty"`
+	BakeMinutes int `json:"bake_minutes,omitempty" yaml:"bake_minutes,omitempty"`
+}
+
+// UpdatePolicyRule is one rule of an UpdatePolicyDocument: the knobs an
+// operator can steer for a cluster or a tag without redeploying the updater
+// task. A zero-value field leaves the corresponding behavior at whatever the
+// updater's flags/environment variables already say.
+type UpdatePolicyRule struct {
+	// Pin holds the only version verifyUpdate will accept as a final
+	// target; any other version an instance ends up running is treated as a
+	// policy violation, the same as landing on a SkipVersions entry.
+	Pin string `json:"pin,omitempty" yaml:"pin,omitempty"`
+	// SkipVersions blocks moving to (or having moved to) any of these
+	// versions, alongside VersionPolicy's BR_SKIP_VERSIONS.
+	SkipVersions []string `json:"skip_versions,omitempty" yaml:"skip_versions,omitempty"`
+	// MaxUnavailable is a count or percentage, in the same syntax as
+	// -max-unavailable/UPDATE_MAX_UNAVAILABLE; see parseMaxUnavailable.
+	MaxUnavailable string `json:"max_unavailable,omitempty" yaml:"max_unavailable,omitempty"`
+	// Canary, if set, requests the canary rollout strategy with these
+	// parameters instead of whatever -strategy/-canary-count/-bake-duration
+	// say.
+	Canary *CanaryPolicy `json:"canary,omitempty" yaml:"canary,omitempty"`
+	// Window is a maintenance window in the same "HH:MM-HH:MM" or
+	// "<days> HH:MM-HH:MM" syntax as UPDATE_MAINTENANCE_WINDOW (see
+	// maintenance_window.go), not a cron expression, so operators configure
+	// every window in this updater -- cluster-wide, per-instance, and
+	// per-policy-rule -- the same way.
+	Window string `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// UpdatePolicyDocument is the schema of the YAML (or JSON, which parses as a
+// YAML subset) document operators publish to S3 or SSM Parameter Store.
+// Clusters is keyed by whatever string -cluster was given as (a short name
+// or a full ARN); Tags is keyed by "key=value" and matched against each
+// container instance's ECS attributes (the same attributes
+// bottlerocket.updater/policy and bottlerocket.updater/window are read
+// from), not ECS resource tags -- this way resolving a rule costs no extra
+// AWS API calls beyond the DescribeContainerInstances call already made to
+// discover Bottlerocket instances.
+type UpdatePolicyDocument struct {
+	Clusters map[string]UpdatePolicyRule `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+	Tags     map[string]UpdatePolicyRule `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// updatePolicyS3URI resolves the S3 URI an UpdatePolicyDocument is loaded
+// from: the -update-policy-s3-uri flag if set, otherwise
+// UPDATE_POLICY_S3_URI. Empty disables loading from S3.
+func updatePolicyS3URI(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(updatePolicyS3URIEnv)
+}
+
+// updatePolicySSMParameter resolves the SSM parameter name an
+// UpdatePolicyDocument is loaded from: the -update-policy-ssm-parameter flag
+// if set, otherwise UPDATE_POLICY_SSM_PARAMETER. Empty disables loading from
+// Parameter Store.
+func updatePolicySSMParameter(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(updatePolicySSMParameterEnv)
+}
+
+// loadUpdatePolicyDocument loads and parses the UpdatePolicyDocument from
+// s3URI (preferred) or ssmParameter. With both empty, the feature is
+// disabled and loadUpdatePolicyDocument returns a nil document; every
+// UpdatePolicyDocument method tolerates a nil receiver the same way
+// *MaintenanceWindow does, so callers don't need to special-case it.
+func loadUpdatePolicyDocument(ctx context.Context, s3Client S3API, ssmClient SSMAPI, s3URI, ssmParameter string) (*UpdatePolicyDocument, error) {
+	var raw []byte
+	switch {
+	case s3URI != "":
+		bucket, key, err := parseS3URI(s3URI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid update policy document S3 URI %q: %w", s3URI, err)
+		}
+		resp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch update policy document from %q: %w", s3URI, err)
+		}
+		defer resp.Body.Close()
+		raw, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read update policy document from %q: %w", s3URI, err)
+		}
+	case ssmParameter != "":
+		resp, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(ssmParameter),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch update policy document from SSM parameter %q: %w", ssmParameter, err)
+		}
+		raw = []byte(aws.ToString(resp.Parameter.Value))
+	default:
+		return nil, nil
+	}
+
+	var doc UpdatePolicyDocument
+	if err := parseUpdatePolicyDocument(raw, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// parseUpdatePolicyDocument unmarshals raw YAML (JSON parses as a YAML
+// subset) into doc.
+func parseUpdatePolicyDocument(raw []byte, doc *UpdatePolicyDocument) error {
+	if err := yaml.Unmarshal(raw, doc); err != nil {
+		return fmt.Errorf("failed to parse update policy document: %w", err)
+	}
+	return nil
+}
+
+// ruleFor resolves the UpdatePolicyRule that applies to cluster/tags: the
+// cluster-keyed rule, if any, overlaid by every tag-keyed rule whose
+// "key=value" matches an entry in tags. A nil document, or one with no
+// matching rules, resolves to the zero UpdatePolicyRule, which changes
+// nothing.
+func (d *UpdatePolicyDocument) ruleFor(cluster string, tags map[string]string) UpdatePolicyRule {
+	if d == nil {
+		return UpdatePolicyRule{}
+	}
+	rule := d.Clusters[cluster]
+	for key, value := range tags {
+		if tagRule, ok := d.Tags[key+"="+value]; ok {
+			rule = mergeUpdatePolicyRules(rule, tagRule)
+		}
+	}
+	return rule
+}
+
+// mergeUpdatePolicyRules overlays override onto base, field by field: any
+// field override sets wins, leaving base's value wherever override leaves
+// its own at the zero value.
+func mergeUpdatePolicyRules(base, override UpdatePolicyRule) UpdatePolicyRule {
+	merged := base
+	if override.Pin != "" {
+		merged.Pin = override.Pin
+	}
+	if len(override.SkipVersions) > 0 {
+		merged.SkipVersions = override.SkipVersions
+	}
+	if override.MaxUnavailable != "" {
+		merged.MaxUnavailable = override.MaxUnavailable
+	}
+	if override.Canary != nil {
+		merged.Canary = override.Canary
+	}
+	if override.Window != "" {
+		merged.Window = override.Window
+	}
+	return merged
+}
+
+// resolve decides whether candidateVersion -- the version an instance is
+// running, or was just updated to -- is acceptable under r, alongside
+// VersionPolicy's own BR_SKIP_VERSIONS/BR_VERSION_CONSTRAINT checks. It
+// returns the target version r actually wants (Pin, if set and violated,
+// otherwise candidateVersion unchanged) and a reason when candidateVersion
+// isn't acceptable. An empty candidateVersion is always accepted, since
+// there's nothing to evaluate.
+func (r UpdatePolicyRule) resolve(candidateVersion string) (shouldUpdate bool, targetVersion string, reason string) {
+	if candidateVersion == "" {
+		return true, "", ""
+	}
+	for _, skip := range r.SkipVersions {
+		if skip == candidateVersion {
+			return false, "", fmt.Sprintf("version %q is on the update policy document's skip_versions list", candidateVersion)
+		}
+	}
+	if r.Pin != "" && r.Pin != candidateVersion {
+		return false, r.Pin, fmt.Sprintf("version %q does not match the update policy document's pinned version %q", candidateVersion, r.Pin)
+	}
+	return true, candidateVersion, ""
+}
+
+// maxUnavailable parses r.MaxUnavailable via parseMaxUnavailable, logging
+// and ignoring an invalid value rather than failing the run. ok is false
+// when MaxUnavailable is unset or invalid, in which case callers should fall
+// back to their own -max-unavailable/UPDATE_MAX_UNAVAILABLE configuration.
+func (r UpdatePolicyRule) maxUnavailable() (count, percent int, ok bool) {
+	if r.MaxUnavailable == "" {
+		return 0, 0, false
+	}
+	count, percent, err := parseMaxUnavailable(r.MaxUnavailable)
+	if err != nil {
+		log.Printf("Ignoring invalid max_unavailable %q in update policy document: %v", r.MaxUnavailable, err)
+		return 0, 0, false
+	}
+	return count, percent, true
+}
+
+// window parses r.Window via parseMaintenanceWindow, logging and ignoring an
+// invalid value rather than failing the run.
+func (r UpdatePolicyRule) window() (window *MaintenanceWindow, ok bool) {
+	if r.Window == "" {
+		return nil, false
+	}
+	window, err := parseMaintenanceWindow(r.Window)
+	if err != nil {
+		log.Printf("Ignoring invalid window %q in update policy document: %v", r.Window, err)
+		return nil, false
+	}
+	return window, true
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadUpdatePolicyDocumentYAML(t *testing.T) {
+	doc, err := loadUpdatePolicyDocument(context.Background(), nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Nil(t, doc, "loadUpdatePolicyDocument should no-op with no source configured")
+}
+
+func TestUpdatePolicyDocumentParsesYAML(t *testing.T) {
+	raw := []byte(`
+clusters:
+  prod:
+    pin: "1.19.0"
+    max_unavailable: "1"
+    window: "Mon-Fri 02:00-06:00"
+  canary-cluster:
+    canary:
+      count: 2
+      bake_minutes: 30
+tags:
+  env=staging:
+    skip_versions: ["1.19.1", "1.19.2"]
+`)
+	var doc UpdatePolicyDocument
+	err := parseUpdatePolicyDocument(raw, &doc)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.19.0", doc.Clusters["prod"].Pin)
+	assert.Equal(t, "1", doc.Clusters["prod"].MaxUnavailable)
+	assert.Equal(t, "Mon-Fri 02:00-06:00", doc.Clusters["prod"].Window)
+	require.NotNil(t, doc.Clusters["canary-cluster"].Canary)
+	assert.Equal(t, 2, doc.Clusters["canary-cluster"].Canary.Count)
+	assert.Equal(t, 30, doc.Clusters["canary-cluster"].Canary.BakeMinutes)
+	assert.Equal(t, []string{"1.19.1", "1.19.2"}, doc.Tags["env=staging"].SkipVersions)
+}
+
+func TestUpdatePolicyDocumentRuleForMergesClusterAndTagRules(t *testing.T) {
+	doc := &UpdatePolicyDocument{
+		Clusters: map[string]UpdatePolicyRule{
+			"prod": {MaxUnavailable: "1", Window: "Mon-Fri 02:00-06:00"},
+		},
+		Tags: map[string]UpdatePolicyRule{
+			"env=canary": {Pin: "1.19.0"},
+		},
+	}
+
+	t.Run("no matching tags leaves the cluster rule untouched", func(t *testing.T) {
+		rule := doc.ruleFor("prod", map[string]string{"env": "staging"})
+		assert.Equal(t, "1", rule.MaxUnavailable)
+		assert.Equal(t, "", rule.Pin)
+	})
+
+	t.Run("a matching tag overlays its rule onto the cluster rule", func(t *testing.T) {
+		rule := doc.ruleFor("prod", map[string]string{"env": "canary"})
+		assert.Equal(t, "1", rule.MaxUnavailable, "cluster-level field not touched by the tag rule survives")
+		assert.Equal(t, "1.19.0", rule.Pin, "tag-level field overlays the zero-value cluster field")
+	})
+
+	t.Run("unknown cluster resolves to the zero rule", func(t *testing.T) {
+		rule := doc.ruleFor("unknown", nil)
+		assert.Equal(t, UpdatePolicyRule{}, rule)
+	})
+
+	t.Run("nil document resolves to the zero rule", func(t *testing.T) {
+		var nilDoc *UpdatePolicyDocument
+		rule := nilDoc.ruleFor("prod", map[string]string{"env": "canary"})
+		assert.Equal(t, UpdatePolicyRule{}, rule)
+	})
+}
+
+func TestUpdatePolicyRuleResolve(t *testing.T) {
+	cases := []struct {
+		name               string
+		rule               UpdatePolicyRule
+		candidateVersion   string
+		expectedShould     bool
+		expectedTarget     string
+		expectedReasonPart string
+	}{
+		{
+			name:             "zero rule accepts any version",
+			rule:             UpdatePolicyRule{},
+			candidateVersion: "1.19.0",
+			expectedShould:   true,
+			expectedTarget:   "1.19.0",
+		},
+		{
+			name:             "empty candidate is always accepted",
+			rule:             UpdatePolicyRule{Pin: "1.19.0"},
+			candidateVersion: "",
+			expectedShould:   true,
+		},
+		{
+			name:             "pin matches",
+			rule:             UpdatePolicyRule{Pin: "1.19.0"},
+			candidateVersion: "1.19.0",
+			expectedShould:   true,
+			expectedTarget:   "1.19.0",
+		},
+		{
+			name:               "pin violated -- candidate moved past the pinned version",
+			rule:               UpdatePolicyRule{Pin: "1.19.0"},
+			candidateVersion:   "1.20.0",
+			expectedShould:     false,
+			expectedTarget:     "1.19.0",
+			expectedReasonPart: "pinned version",
+		},
+		{
+			name:               "skip_versions blocks a listed version",
+			rule:               UpdatePolicyRule{SkipVersions: []string{"1.19.1", "1.19.2"}},
+			candidateVersion:   "1.19.1",
+			expectedShould:     false,
+			expectedReasonPart: "skip_versions",
+		},
+		{
+			name:             "skip_versions doesn't block an unlisted version",
+			rule:             UpdatePolicyRule{SkipVersions: []string{"1.19.1"}},
+			candidateVersion: "1.19.2",
+			expectedShould:   true,
+			expectedTarget:   "1.19.2",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			shouldUpdate, target, reason := tc.rule.resolve(tc.candidateVersion)
+			assert.Equal(t, tc.expectedShould, shouldUpdate)
+			assert.Equal(t, tc.expectedTarget, target)
+			if tc.expectedReasonPart != "" {
+				assert.Contains(t, reason, tc.expectedReasonPart)
+			} else {
+				assert.Empty(t, reason)
+			}
+		})
+	}
+}
+
+func TestUpdatePolicyRuleMaxUnavailable(t *testing.T) {
+	cases := []struct {
+		name            string
+		rule            UpdatePolicyRule
+		expectedOk      bool
+		expectedCount   int
+		expectedPercent int
+	}{
+		{name: "unset", rule: UpdatePolicyRule{}, expectedOk: false},
+		{name: "count", rule: UpdatePolicyRule{MaxUnavailable: "2"}, expectedOk: true, expectedCount: 2},
+		{name: "percent", rule: UpdatePolicyRule{MaxUnavailable: "25%"}, expectedOk: true, expectedPercent: 25},
+		{name: "invalid falls back to the caller's own configuration", rule: UpdatePolicyRule{MaxUnavailable: "not-a-number"}, expectedOk: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			count, percent, ok := tc.rule.maxUnavailable()
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedCount, count)
+			assert.Equal(t, tc.expectedPercent, percent)
+		})
+	}
+}
+
+func TestUpdatePolicyRuleWindow(t *testing.T) {
+	// A Tuesday at 03:00 UTC, inside "Mon-Fri 02:00-06:00" and outside
+	// "Mon-Fri 07:00-09:00".
+	tuesdayEarlyMorning := time.Date(2026, time.August, 4, 3, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name          string
+		rule          UpdatePolicyRule
+		at            time.Time
+		expectedOk    bool
+		expectedAllow bool
+	}{
+		{name: "unset window", rule: UpdatePolicyRule{}, at: tuesdayEarlyMorning, expectedOk: false},
+		{
+			name:          "inside the window",
+			rule:          UpdatePolicyRule{Window: "Mon-Fri 02:00-06:00"},
+			at:            tuesdayEarlyMorning,
+			expectedOk:    true,
+			expectedAllow: true,
+		},
+		{
+			name:          "window closed at this time",
+			rule:          UpdatePolicyRule{Window: "Mon-Fri 07:00-09:00"},
+			at:            tuesdayEarlyMorning,
+			expectedOk:    true,
+			expectedAllow: false,
+		},
+		{
+			name:       "invalid window falls back to the caller's own configuration",
+			rule:       UpdatePolicyRule{Window: "not a window"},
+			at:         tuesdayEarlyMorning,
+			expectedOk: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			window, ok := tc.rule.window()
+			assert.Equal(t, tc.expectedOk, ok)
+			if ok {
+				assert.Equal(t, tc.expectedAllow, window.Allows(tc.at))
+			}
+		})
+	}
+}
+
+func TestUpdatePolicyRuleCanary(t *testing.T) {
+	rule := UpdatePolicyRule{Canary: &CanaryPolicy{Count: 3, BakeMinutes: 45}}
+	require.NotNil(t, rule.Canary)
+	assert.Equal(t, 3, rule.Canary.Count)
+	assert.Equal(t, 45, rule.Canary.BakeMinutes)
+
+	merged := mergeUpdatePolicyRules(UpdatePolicyRule{}, rule)
+	require.NotNil(t, merged.Canary, "canary-in-progress rule survives a merge onto an empty base")
+	assert.Equal(t, 3, merged.Canary.Count)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+const (
+	versionConstraintEnv = "BR_VERSION_CONSTRAINT"
+	skipVersionsEnv      = "BR_SKIP_VERSIONS"
+	allowDowngradeEnv    = "BR_ALLOW_DOWNGRADE"
+)
+
+// VersionPolicy gates which Bottlerocket versions the updater is willing to
+// move an instance to: a semver constraint, an explicit skip list, and
+// whether downgrades are permitted.
+type VersionPolicy struct {
+	constraint       *semver.Constraints
+	constraintSource string
+	skipVersions     map[string]bool
+	allowDowngrade   bool
+}
+
+// newVersionPolicyFromEnv builds a VersionPolicy from BR_VERSION_CONSTRAINT,
+// BR_SKIP_VERSIONS, and BR_ALLOW_DOWNGRADE. With none of them set it allows
+// any upgrade and refuses downgrades, matching the updater's prior behavior
+// of always moving to whatever version SSM reports as available.
+func newVersionPolicyFromEnv() (*VersionPolicy, error) {
+	policy := &VersionPolicy{skipVersions: map[string]bool{}}
+
+	if raw := os.Getenv(versionConstraintEnv); raw != "" {
+		constraint, err := semver.NewConstraint(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", versionConstraintEnv, raw, err)
+		}
+		policy.constraint = constraint
+		policy.constraintSource = raw
+	}
+
+	if raw := os.Getenv(skipVersionsEnv); raw != "" {
+		for _, v := range strings.Split(raw, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				policy.skipVersions[v] = true
+			}
+		}
+	}
+
+	if raw := os.Getenv(allowDowngradeEnv); raw != "" {
+		allow, err := parseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", allowDowngradeEnv, raw, err)
+		}
+		policy.allowDowngrade = allow
+	}
+
+	return policy, nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "1", "yes":
+		return true, nil
+	case "false", "0", "no":
+		return false, nil
+	default:
+		return false, fmt.Errorf("not a boolean")
+	}
+}
+
+// Allow reports whether target is an acceptable version to update current
+// to: it must satisfy the version constraint (if any), must not be on the
+// skip list, and must not be a downgrade unless downgrades are allowed. An
+// empty target (e.g. because the check document didn't report one) is
+// always allowed, since there is nothing to evaluate.
+func (p *VersionPolicy) Allow(current, target string) (bool, string) {
+	if p == nil || target == "" {
+		return true, ""
+	}
+	if p.skipVersions[target] {
+		return false, fmt.Sprintf("version %q is on the skip list", target)
+	}
+	if ok, reason := p.satisfiesConstraint(target); !ok {
+		return false, reason
+	}
+	if !p.allowDowngrade && current != "" {
+		currentVer, err := semver.NewVersion(current)
+		targetVer, targetErr := semver.NewVersion(target)
+		if err == nil && targetErr == nil && targetVer.LessThan(currentVer) {
+			return false, fmt.Sprintf("version %q is older than current version %q and downgrades are disabled", target, current)
+		}
+	}
+	return true, ""
+}
+
+// satisfiesConstraint reports whether version satisfies the configured
+// BR_VERSION_CONSTRAINT, if one was set.
+func (p *VersionPolicy) satisfiesConstraint(version string) (bool, string) {
+	if p.constraint == nil {
+		return true, ""
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		log.Printf("Failed to parse version %q as semver, allowing it through unconstrained: %v", version, err)
+		return true, ""
+	}
+	if !p.constraint.Check(v) {
+		return false, fmt.Sprintf("version %q does not satisfy constraint %q", version, p.constraintSource)
+	}
+	return true, ""
+}
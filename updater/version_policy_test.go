@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withEnv(t *testing.T, key, value string) {
+	t.Helper()
+	old, had := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestVersionPolicyAllowDefaults(t *testing.T) {
+	policy := &VersionPolicy{skipVersions: map[string]bool{}}
+
+	ok, reason := policy.Allow("1.10.0", "1.11.0")
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+
+	ok, reason = policy.Allow("", "")
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+}
+
+func TestVersionPolicyAllowSkipList(t *testing.T) {
+	policy := &VersionPolicy{skipVersions: map[string]bool{"1.14.0": true}}
+	ok, reason := policy.Allow("1.13.0", "1.14.0")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "skip list")
+}
+
+func TestVersionPolicyAllowConstraint(t *testing.T) {
+	policy, err := newVersionPolicyFromEnv()
+	require.NoError(t, err)
+	_ = policy
+	withEnv(t, versionConstraintEnv, "~1.10")
+	policy, err = newVersionPolicyFromEnv()
+	require.NoError(t, err)
+
+	ok, _ := policy.Allow("1.10.0", "1.10.5")
+	assert.True(t, ok)
+
+	ok, reason := policy.Allow("1.10.0", "2.0.0")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "does not satisfy constraint")
+}
+
+func TestVersionPolicyAllowDowngradeProtection(t *testing.T) {
+	policy := &VersionPolicy{skipVersions: map[string]bool{}}
+	ok, reason := policy.Allow("1.10.0", "1.9.0")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "downgrades are disabled")
+
+	policy.allowDowngrade = true
+	ok, reason = policy.Allow("1.10.0", "1.9.0")
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+}
+
+func TestNewVersionPolicyFromEnv(t *testing.T) {
+	withEnv(t, versionConstraintEnv, ">=1.9, <2.0")
+	withEnv(t, skipVersionsEnv, "1.9.5, 1.9.6")
+	withEnv(t, allowDowngradeEnv, "true")
+
+	policy, err := newVersionPolicyFromEnv()
+	require.NoError(t, err)
+	assert.True(t, policy.allowDowngrade)
+	assert.True(t, policy.skipVersions["1.9.5"])
+	assert.True(t, policy.skipVersions["1.9.6"])
+
+	ok, reason := policy.Allow("1.9.0", "1.9.5")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "skip list")
+
+	ok, reason = policy.Allow("1.9.0", "2.1.0")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "does not satisfy constraint")
+}
+
+func TestNewVersionPolicyFromEnvInvalidConstraint(t *testing.T) {
+	withEnv(t, versionConstraintEnv, "not-a-constraint-!!!")
+	_, err := newVersionPolicyFromEnv()
+	require.Error(t, err)
+}
+
+func TestNilVersionPolicyAllowsEverything(t *testing.T) {
+	var policy *VersionPolicy
+	ok, reason := policy.Allow("1.0.0", "0.1.0")
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const (
+	ssmWaiterDelaySecondsEnv = "SSM_WAITER_DELAY_SECONDS"
+	ssmWaiterAcceptorsEnv    = "SSM_WAITER_ACCEPTORS"
+)
+
+// WaiterAcceptorState is the terminal state an SSMWaiterAcceptor resolves a
+// wait attempt to, mirroring the state names used by the AWS SDK's own
+// generated waiter acceptors.
+type WaiterAcceptorState string
+
+const (
+	WaiterAcceptorSuccess WaiterAcceptorState = "success"
+	WaiterAcceptorRetry   WaiterAcceptorState = "retry"
+	WaiterAcceptorFailure WaiterAcceptorState = "failure"
+)
+
+// WaiterMatcher is what an SSMWaiterAcceptor inspects on each
+// GetCommandInvocation attempt to decide whether it applies.
+type WaiterMatcher string
+
+const (
+	// WaiterMatchStatus compares the command invocation's Status field.
+	WaiterMatchStatus WaiterMatcher = "status"
+	// WaiterMatchError compares the error returned by a failed GetCommandInvocation call.
+	WaiterMatchError WaiterMatcher = "error"
+)
+
+// SSMWaiterAcceptor is one rule evaluated, in declaration order, against
+// each GetCommandInvocation response while sendCommand waits for an SSM
+// command to finish. The first acceptor whose Matcher/Expected pair matches
+// wins; if none match, the waiter falls back to its built-in Status-based
+// terminal-state logic.
+type SSMWaiterAcceptor struct {
+	State    WaiterAcceptorState
+	Matcher  WaiterMatcher
+	Expected string
+}
+
+// SSMWaiterConfig configures the updater's ssm.CommandExecutedWaiter beyond
+// what BackoffPolicy's MinDelay/MaxDelay expose. It lets operators of
+// clusters with slow or flaky SSM agents add acceptor rules -- e.g. treat
+// "InProgress" as a non-fatal state after N attempts rather than waiting out
+// the full waiterMaxDuration -- without a code change.
+type SSMWaiterConfig struct {
+	// Delay, if set, overrides both MinDelay and MaxDelay on the
+	// CommandExecutedWaiter in place of the policy's own backoff schedule.
+	Delay time.Duration
+	// Acceptors are evaluated in order before the waiter's own Status-based
+	// terminal-state check.
+	Acceptors []SSMWaiterAcceptor
+}
+
+// newSSMWaiterConfigFromEnv builds an SSMWaiterConfig from
+// SSM_WAITER_DELAY_SECONDS and SSM_WAITER_ACCEPTORS. SSM_WAITER_ACCEPTORS is
+// a semicolon-separated list of "state:matcher:expected" rules, e.g.
+// "retry:status:InProgress;failure:status:Cancelled". With neither set, the
+// updater keeps its existing waiter schedule and terminal-state behavior.
+func newSSMWaiterConfigFromEnv() (SSMWaiterConfig, error) {
+	var cfg SSMWaiterConfig
+
+	if raw := os.Getenv(ssmWaiterDelaySecondsEnv); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil {
+			return SSMWaiterConfig{}, fmt.Errorf("invalid %s %q: %w", ssmWaiterDelaySecondsEnv, raw, err)
+		}
+		cfg.Delay = time.Duration(seconds) * time.Second
+	}
+
+	if raw := os.Getenv(ssmWaiterAcceptorsEnv); raw != "" {
+		for _, rule := range strings.Split(raw, ";") {
+			rule = strings.TrimSpace(rule)
+			if rule == "" {
+				continue
+			}
+			acceptor, err := parseSSMWaiterAcceptor(rule)
+			if err != nil {
+				return SSMWaiterConfig{}, fmt.Errorf("invalid %s rule %q: %w", ssmWaiterAcceptorsEnv, rule, err)
+			}
+			cfg.Acceptors = append(cfg.Acceptors, acceptor)
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseSSMWaiterAcceptor parses a single "state:matcher:expected" rule.
+func parseSSMWaiterAcceptor(rule string) (SSMWaiterAcceptor, error) {
+	fields := strings.SplitN(rule, ":", 3)
+	if len(fields) != 3 {
+		return SSMWaiterAcceptor{}, fmt.Errorf(`expected "state:matcher:expected"`)
+	}
+	acceptor := SSMWaiterAcceptor{
+		State:    WaiterAcceptorState(fields[0]),
+		Matcher:  WaiterMatcher(fields[1]),
+		Expected: fields[2],
+	}
+	switch acceptor.State {
+	case WaiterAcceptorSuccess, WaiterAcceptorRetry, WaiterAcceptorFailure:
+	default:
+		return SSMWaiterAcceptor{}, fmt.Errorf("unknown state %q", acceptor.State)
+	}
+	switch acceptor.Matcher {
+	case WaiterMatchStatus, WaiterMatchError:
+	default:
+		return SSMWaiterAcceptor{}, fmt.Errorf("unknown matcher %q", acceptor.Matcher)
+	}
+	return acceptor, nil
+}
+
+// commandExecutedWaiterOptions adapts c into ssm.CommandExecutedWaiter
+// options: Delay, if set, pins MinDelay/MaxDelay; Acceptors, if any, install
+// a custom Retryable that checks them before falling back to the waiter's
+// own Status-based default.
+func (c SSMWaiterConfig) commandExecutedWaiterOptions(o *ssm.CommandExecutedWaiterOptions) {
+	if c.Delay > 0 {
+		o.MinDelay = c.Delay
+		o.MaxDelay = c.Delay
+	}
+	if len(c.Acceptors) == 0 {
+		return
+	}
+	o.Retryable = c.retryable
+}
+
+// retryable evaluates c.Acceptors, in order, against a GetCommandInvocation
+// attempt. If none match, it falls back to the same Status-based terminal
+// states the SDK's generated waiter uses by default, since that default
+// logic isn't exported for reuse here.
+func (c SSMWaiterConfig) retryable(_ context.Context, _ *ssm.GetCommandInvocationInput, out *ssm.GetCommandInvocationOutput, err error) (bool, error) {
+	for _, a := range c.Acceptors {
+		var matched bool
+		switch a.Matcher {
+		case WaiterMatchStatus:
+			matched = err == nil && string(out.Status) == a.Expected
+		case WaiterMatchError:
+			matched = err != nil && strings.Contains(err.Error(), a.Expected)
+		}
+		if !matched {
+			continue
+		}
+		switch a.State {
+		case WaiterAcceptorSuccess:
+			return false, nil
+		case WaiterAcceptorFailure:
+			return false, fmt.Errorf("waiter acceptor %q matched failure state", a.Expected)
+		case WaiterAcceptorRetry:
+			return true, nil
+		}
+	}
+
+	if err != nil {
+		// The SDK's own default waiter logic never fails a GetCommandInvocation
+		// call outright; it retries any error (including the eventual-consistency
+		// InvocationDoesNotExist right after SendCommand) and leaves giving up to
+		// waiterMaxDuration. Match that here so an unmatched error doesn't turn
+		// into a premature failure for callers who only configured status rules.
+		return true, nil
+	}
+	switch out.Status {
+	case ssmtypes.CommandInvocationStatusSuccess:
+		return false, nil
+	case ssmtypes.CommandInvocationStatusCancelled, ssmtypes.CommandInvocationStatusTimedOut,
+		ssmtypes.CommandInvocationStatusFailed, ssmtypes.CommandInvocationStatusCancelling:
+		return false, fmt.Errorf("command invocation reached terminal status %q", out.Status)
+	default:
+		return true, nil
+	}
+}
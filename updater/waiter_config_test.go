@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSSMWaiterConfigFromEnv(t *testing.T) {
+	cases := []struct {
+		name        string
+		delay       string
+		acceptors   string
+		expected    SSMWaiterConfig
+		expectedErr string
+	}{
+		{
+			name:     "unset",
+			expected: SSMWaiterConfig{},
+		},
+		{
+			name:     "delay only",
+			delay:    "10",
+			expected: SSMWaiterConfig{Delay: 10 * time.Second},
+		},
+		{
+			name:      "single acceptor",
+			acceptors: "retry:status:InProgress",
+			expected: SSMWaiterConfig{
+				Acceptors: []SSMWaiterAcceptor{
+					{State: WaiterAcceptorRetry, Matcher: WaiterMatchStatus, Expected: "InProgress"},
+				},
+			},
+		},
+		{
+			name:      "multiple acceptors",
+			acceptors: "success:status:InProgress; failure:error:ThrottlingException",
+			expected: SSMWaiterConfig{
+				Acceptors: []SSMWaiterAcceptor{
+					{State: WaiterAcceptorSuccess, Matcher: WaiterMatchStatus, Expected: "InProgress"},
+					{State: WaiterAcceptorFailure, Matcher: WaiterMatchError, Expected: "ThrottlingException"},
+				},
+			},
+		},
+		{
+			name:        "invalid delay",
+			delay:       "not-a-number",
+			expectedErr: "invalid SSM_WAITER_DELAY_SECONDS",
+		},
+		{
+			name:        "malformed acceptor rule",
+			acceptors:   "retry:status",
+			expectedErr: `expected "state:matcher:expected"`,
+		},
+		{
+			name:        "unknown acceptor state",
+			acceptors:   "maybe:status:InProgress",
+			expectedErr: `unknown state "maybe"`,
+		},
+		{
+			name:        "unknown acceptor matcher",
+			acceptors:   "retry:output:InProgress",
+			expectedErr: `unknown matcher "output"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			restoreDelay := setEnv(t, ssmWaiterDelaySecondsEnv, tc.delay)
+			defer restoreDelay()
+			restoreAcceptors := setEnv(t, ssmWaiterAcceptorsEnv, tc.acceptors)
+			defer restoreAcceptors()
+
+			cfg, err := newSSMWaiterConfigFromEnv()
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg)
+		})
+	}
+}
+
+// setEnv sets key to value for the duration of the test, unless value is
+// empty, and returns a func that restores the previous value.
+func setEnv(t *testing.T, key, value string) func() {
+	t.Helper()
+	prev, had := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	return func() {
+		if had {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestSSMWaiterConfigRetryable(t *testing.T) {
+	cases := []struct {
+		name      string
+		acceptors []SSMWaiterAcceptor
+		out       *ssm.GetCommandInvocationOutput
+		err       error
+		wantRetry bool
+		wantErr   string
+	}{
+		{
+			name:      "acceptor matches success status",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorSuccess, Matcher: WaiterMatchStatus, Expected: "InProgress"}},
+			out:       &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress},
+			wantRetry: false,
+		},
+		{
+			name:      "acceptor matches retry status",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorRetry, Matcher: WaiterMatchStatus, Expected: "Pending"}},
+			out:       &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusPending},
+			wantRetry: true,
+		},
+		{
+			name:      "acceptor matches failure status",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorFailure, Matcher: WaiterMatchStatus, Expected: "Delayed"}},
+			out:       &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusDelayed},
+			wantErr:   `waiter acceptor "Delayed" matched failure state`,
+		},
+		{
+			name:      "acceptor matches error",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorRetry, Matcher: WaiterMatchError, Expected: "ThrottlingException"}},
+			err:       errors.New("operation error SSM: GetCommandInvocation, ThrottlingException"),
+			wantRetry: true,
+		},
+		{
+			name:      "no acceptor matches, falls back to default success",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorRetry, Matcher: WaiterMatchStatus, Expected: "Delayed"}},
+			out:       &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess},
+			wantRetry: false,
+		},
+		{
+			name:      "no acceptor matches, falls back to default retry",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorRetry, Matcher: WaiterMatchStatus, Expected: "Delayed"}},
+			out:       &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress},
+			wantRetry: true,
+		},
+		{
+			name:      "no acceptor matches, falls back to default failure",
+			acceptors: []SSMWaiterAcceptor{{State: WaiterAcceptorRetry, Matcher: WaiterMatchStatus, Expected: "Delayed"}},
+			out:       &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusFailed},
+			wantErr:   `reached terminal status "Failed"`,
+		},
+		{
+			name: "no acceptors configured, falls back to default",
+			out:  &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusSuccess},
+		},
+		{
+			name:      "unmatched error falls back to default retry",
+			err:       errors.New("boom"),
+			wantRetry: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := SSMWaiterConfig{Acceptors: tc.acceptors}
+			retryable, err := cfg.retryable(nil, nil, tc.out, tc.err)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRetry, retryable)
+		})
+	}
+}
+
+// TestSendCommandWithWaiterAcceptors mirrors TestSendCommandWaitErr but
+// configures an acceptor that treats a command stuck InProgress as a soft
+// success, so sendCommand returns instead of waiting out waiterMaxDuration.
+func TestSendCommandWithWaiterAcceptors(t *testing.T) {
+	mockSSM := MockSSM{
+		SendCommandFn: func(ctx context.Context, input *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+			return &ssm.SendCommandOutput{Command: &ssmtypes.Command{CommandId: aws.String("command-id")}}, nil
+		},
+		GetCommandInvocationFn: func(ctx context.Context, input *ssm.GetCommandInvocationInput, optFns ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+			return &ssm.GetCommandInvocationOutput{Status: ssmtypes.CommandInvocationStatusInProgress}, nil
+		},
+	}
+	u := updater{
+		ssm: mockSSM,
+		ssmWaiterConfig: SSMWaiterConfig{
+			Acceptors: []SSMWaiterAcceptor{
+				{State: WaiterAcceptorSuccess, Matcher: WaiterMatchStatus, Expected: "InProgress"},
+			},
+		},
+	}
+	commandID, err := u.sendCommand(context.Background(), []string{"inst-id-1"}, "test-doc")
+	require.NoError(t, err)
+	assert.Equal(t, "command-id", commandID)
+}